@@ -4,13 +4,16 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"network-monitor-client/config"
 	"network-monitor-client/devicemonitor"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
 )
 
 // BandwidthStats 带宽统计结构
@@ -23,10 +26,20 @@ type BandwidthStats struct {
 	UploadPackets uint64
 	// 下行数据包数量
 	DownloadPackets uint64
+	// 内网（东西向）数据总量（字节）
+	InternalBytes uint64
+	// 内网数据包数量
+	InternalPackets uint64
 	// 上次计算的上行速率（字节/秒）
 	UploadSpeed float64
 	// 上次计算的下行速率（字节/秒）
 	DownloadSpeed float64
+	// 上次计算的内网速率（字节/秒）
+	InternalSpeed float64
+	// 采样时上行、下行、内网速率的误差范围（字节/秒，95%置信区间半宽）
+	UploadSpeedError   float64
+	DownloadSpeedError float64
+	InternalSpeedError float64
 	// 上行平均包大小（字节）
 	AvgUploadPacketSize float64
 	// 下行平均包大小（字节）
@@ -35,20 +48,21 @@ type BandwidthStats struct {
 	StartTime time.Time
 	// 上次更新时间
 	LastUpdate time.Time
-	// 本地IP地址（用于判断上下行）
-	LocalIPs []net.IP
-	// 本地子网（用于更精确判断本地流量）
-	LocalNetworks []*net.IPNet
+	// 本地IP地址和子网（用于判断上下行），刷新时整体替换，读取无需加锁
+	localAddrs atomic.Pointer[localAddresses]
 	// 上行带宽历史数据（用于计算滑动平均）
 	UploadHistory []float64
 	// 下行带宽历史数据（用于计算滑动平均）
 	DownloadHistory []float64
+	// 内网带宽历史数据（用于计算滑动平均）
+	InternalHistory []float64
+	// 本间隔字节数估算的方差，以及各采样点速率的方差历史（用于计算误差范围）
+	variance        [3]float64
+	varianceHistory [3][]float64
 	// 历史窗口大小（记录多少个采样点）
 	HistorySize int
 	// 互斥锁（保护并发访问）
 	mutex sync.Mutex
-	// 过滤器集合（存储五元组以去重）
-	flowTracker map[string]bool
 }
 
 // NewBandwidthStats 创建新的带宽统计对象
@@ -57,22 +71,40 @@ func NewBandwidthStats(historySize int) *BandwidthStats {
 		historySize = 10 // 默认保存10个历史采样点
 	}
 
-	// 获取本地IP地址和子网
-	localIPs, localNetworks, err := getLocalNetworks()
-	if err != nil {
-		log.Printf("获取本地网络信息失败: %v", err)
-	}
-
-	return &BandwidthStats{
+	bs := &BandwidthStats{
 		StartTime:       time.Now(),
 		LastUpdate:      time.Now(),
-		LocalIPs:        localIPs,
-		LocalNetworks:   localNetworks,
 		UploadHistory:   make([]float64, 0, historySize),
 		DownloadHistory: make([]float64, 0, historySize),
+		InternalHistory: make([]float64, 0, historySize),
 		HistorySize:     historySize,
-		flowTracker:     make(map[string]bool),
 	}
+	bs.localAddrs.Store(&localAddresses{})
+
+	// 获取本地IP地址和子网
+	bs.refreshLocalNetworks()
+	return bs
+}
+
+// localAddresses 本地IP地址和子网列表，创建后不再修改
+type localAddresses struct {
+	// 本地IP地址
+	ips []net.IP
+	// 本地子网（用于更精确判断本地流量）
+	networks []*net.IPNet
+}
+
+// equal 判断两个地址列表是否相同
+func (a *localAddresses) equal(other *localAddresses) bool {
+	if len(a.networks) != len(other.networks) {
+		return false
+	}
+	for i := range a.networks {
+		if a.networks[i].String() != other.networks[i].String() {
+			return false
+		}
+	}
+	return true
 }
 
 // 获取本地IP地址和子网列表
@@ -122,28 +154,43 @@ func getLocalNetworks() ([]net.IP, []*net.IPNet, error) {
 		}
 	}
 
-	// 输出调试信息
-	for i, ip := range ips {
-		if i < len(networks) {
-			ones, _ := networks[i].Mask.Size()
-			log.Printf("本地网络: %s/%d", ip.String(), ones)
-		}
+	return ips, networks, nil
+}
+
+// 重新获取本地IP地址和子网，地址变化时整体替换，不影响正在进行的抓包
+func (bs *BandwidthStats) refreshLocalNetworks() {
+	localIPs, localNetworks, err := getLocalNetworks()
+	if err != nil {
+		log.Printf("获取本地网络信息失败: %v", err)
+		return
 	}
 
-	return ips, networks, nil
+	addrs := &localAddresses{ips: localIPs, networks: localNetworks}
+	if addrs.equal(bs.localAddrs.Load()) {
+		return
+	}
+	bs.localAddrs.Store(addrs)
+
+	// 输出调试信息
+	for _, network := range localNetworks {
+		ones, _ := network.Mask.Size()
+		log.Printf("本地网络: %s/%d", network.IP.String(), ones)
+	}
 }
 
 // 检查IP是否是本地IP
 func (bs *BandwidthStats) isLocalIP(ip net.IP) bool {
+	addrs := bs.localAddrs.Load()
+
 	// 检查是否是本地IP
-	for _, localIP := range bs.LocalIPs {
+	for _, localIP := range addrs.ips {
 		if localIP.Equal(ip) {
 			return true
 		}
 	}
 
 	// 检查是否在本地子网内
-	for _, network := range bs.LocalNetworks {
+	for _, network := range addrs.networks {
 		if network.Contains(ip) {
 			return true
 		}
@@ -152,39 +199,29 @@ func (bs *BandwidthStats) isLocalIP(ip net.IP) bool {
 	return false
 }
 
-// 生成五元组标识符
-func (bs *BandwidthStats) generateFlowID(srcIP, dstIP string, srcPort, dstPort uint16, protocol string) string {
-	// 根据源目IP、端口、协议生成唯一标识
-	return fmt.Sprintf("%s:%d-%s:%d-%s", srcIP, srcPort, dstIP, dstPort, protocol)
-}
-
-// 记录流量
-func (bs *BandwidthStats) recordFlow(flowID string) {
-	bs.mutex.Lock()
-	defer bs.mutex.Unlock()
-	bs.flowTracker[flowID] = true
+// 检查IP是否是本机地址（不含子网）
+func (bs *BandwidthStats) isHostIP(ip net.IP) bool {
+	for _, localIP := range bs.localAddrs.Load().ips {
+		if localIP.Equal(ip) {
+			return true
+		}
+	}
+	return false
 }
 
-// 更新带宽统计
-func (bs *BandwidthStats) Update(packet gopacket.Packet, isUpload bool) {
+// add 累加各处理协程本间隔的字节数和数据包数
+func (bs *BandwidthStats) add(totals *trafficTotals) {
 	bs.mutex.Lock()
 	defer bs.mutex.Unlock()
 
-	// 使用更精确的包大小计算方法（获取捕获的实际大小）
-	var packetSize uint64
-	if metadata := packet.Metadata(); metadata != nil {
-		packetSize = uint64(metadata.CaptureInfo.Length)
-	} else {
-		// 如果没有元数据，使用包数据大小
-		packetSize = uint64(len(packet.Data()))
-	}
-
-	if isUpload {
-		bs.UploadBytes += packetSize
-		bs.UploadPackets++
-	} else {
-		bs.DownloadBytes += packetSize
-		bs.DownloadPackets++
+	bs.UploadBytes += totals.bytes[DirectionUpload]
+	bs.UploadPackets += totals.packets[DirectionUpload]
+	bs.DownloadBytes += totals.bytes[DirectionDownload]
+	bs.DownloadPackets += totals.packets[DirectionDownload]
+	bs.InternalBytes += totals.bytes[DirectionInternal]
+	bs.InternalPackets += totals.packets[DirectionInternal]
+	for i := range bs.variance {
+		bs.variance[i] += totals.variance[i]
 	}
 }
 
@@ -201,10 +238,13 @@ func (bs *BandwidthStats) CalculateSpeeds() {
 		currentUploadSpeed := float64(bs.UploadBytes) / duration
 		// 计算下行速率（字节/秒）
 		currentDownloadSpeed := float64(bs.DownloadBytes) / duration
+		// 计算内网速率（字节/秒）
+		currentInternalSpeed := float64(bs.InternalBytes) / duration
 
 		// 添加到历史记录
 		bs.UploadHistory = append(bs.UploadHistory, currentUploadSpeed)
 		bs.DownloadHistory = append(bs.DownloadHistory, currentDownloadSpeed)
+		bs.InternalHistory = append(bs.InternalHistory, currentInternalSpeed)
 
 		// 保持历史记录不超过指定大小
 		if len(bs.UploadHistory) > bs.HistorySize {
@@ -213,10 +253,14 @@ func (bs *BandwidthStats) CalculateSpeeds() {
 		if len(bs.DownloadHistory) > bs.HistorySize {
 			bs.DownloadHistory = bs.DownloadHistory[1:]
 		}
+		if len(bs.InternalHistory) > bs.HistorySize {
+			bs.InternalHistory = bs.InternalHistory[1:]
+		}
 
 		// 计算滑动平均值
 		bs.UploadSpeed = calculateMovingAverage(bs.UploadHistory)
 		bs.DownloadSpeed = calculateMovingAverage(bs.DownloadHistory)
+		bs.InternalSpeed = calculateMovingAverage(bs.InternalHistory)
 
 		// 计算平均包大小
 		if bs.UploadPackets > 0 {
@@ -226,18 +270,26 @@ func (bs *BandwidthStats) CalculateSpeeds() {
 			bs.AvgDownloadPacketSize = float64(bs.DownloadBytes) / float64(bs.DownloadPackets)
 		}
 
+		// 采样时按滑动窗口内的方差计算误差范围
+		for i := range bs.varianceHistory {
+			bs.varianceHistory[i] = append(bs.varianceHistory[i], bs.variance[i]/(duration*duration))
+			if len(bs.varianceHistory[i]) > bs.HistorySize {
+				bs.varianceHistory[i] = bs.varianceHistory[i][1:]
+			}
+			bs.variance[i] = 0
+		}
+		bs.UploadSpeedError = speedError(bs.varianceHistory[DirectionUpload])
+		bs.DownloadSpeedError = speedError(bs.varianceHistory[DirectionDownload])
+		bs.InternalSpeedError = speedError(bs.varianceHistory[DirectionInternal])
+
 		// 重置计数器
 		bs.UploadBytes = 0
 		bs.DownloadBytes = 0
 		bs.UploadPackets = 0
 		bs.DownloadPackets = 0
+		bs.InternalBytes = 0
+		bs.InternalPackets = 0
 		bs.LastUpdate = now
-
-		// 每隔一段时间清空流量跟踪器以防止内存泄漏
-		if len(bs.flowTracker) > 10000 || now.Sub(bs.StartTime).Minutes() > 5 {
-			bs.flowTracker = make(map[string]bool)
-			bs.StartTime = now
-		}
 	}
 }
 
@@ -286,37 +338,111 @@ func formatBandwidth(bytesPerSec float64) string {
 	return fmt.Sprintf("%.2f %s", value, units[unitIndex])
 }
 
+// 刷新本地IP地址和子网的周期
+const localAddrRefreshInterval = 10 * time.Second
+
 // BandwidthMonitor 带宽监控器结构
 type BandwidthMonitor struct {
 	deviceMonitor *devicemonitor.DeviceMonitor
 	stats         *BandwidthStats
-	stopChan      chan struct{}
-	interval      time.Duration // 统计间隔
+	direction     *directionClassifier
+	segments      *segmentTracker
+	encapsulation *encapsulationTracker
+	loss          lossTracker
+	health        healthTracker
+	// 各处理协程的解码器和计数器，按抓包句柄序号分配
+	workersMutex sync.Mutex
+	workers      []*packetWorker
+	// 数据包采样方式，运行时可修改
+	sampling atomic.Pointer[samplingPolicy]
+	// 是否按连接统计流量，用于归属到本机进程
+	attributeProcesses bool
+	// 是否按远端地址统计流量
+	trackRemotes bool
+	// 是否从TLS SNI和HTTP Host识别连接的服务器名称
+	trackHostnames bool
+	// 从DNS应答学习地址对应名称的缓存，各网卡共用主机监控器的缓存，未开启时为nil
+	reverseDNS *reverseDNSCache
+	// 是否按单向流统计，用于导出NetFlow、IPFIX流记录
+	exportFlows bool
+	// 处理协程的流计数表写满时通知导出协程，未开启导出时为nil
+	flowWake chan<- struct{}
+	// 计数器模式下读取的网卡内核计数器，只由统计协程访问
+	kernelCounters counterSource
+	// 抓包中断事件及链路检查发现的中断原因
+	gapMutex   sync.Mutex
+	gaps       []CaptureGap
+	linkReason string
+	recovering atomic.Bool
+	stopChan   chan struct{}
+	interval   time.Duration // 统计间隔
 	// 新增：使用BPF过滤器
 	filter string
 }
 
 // NewBandwidthMonitor 创建新的带宽监控器
 func NewBandwidthMonitor(deviceMonitor *devicemonitor.DeviceMonitor, interval time.Duration) *BandwidthMonitor {
+	bm := newBandwidthMonitor(deviceMonitor.GetDevice(), interval)
+	bm.deviceMonitor = deviceMonitor
+	// 其他命名空间内的网卡在命名空间内重新获取地址，不使用当前命名空间同名网卡的网关
+	if deviceMonitor.Namespaced() {
+		bm.segments = newSegmentTracker(bm.stats.HistorySize)
+		bm.refreshAddresses()
+	}
+	return bm
+}
+
+// newBandwidthMonitor 为指定网卡创建统计器，不关联设备监控器（用于回放pcap文件）
+func newBandwidthMonitor(device string, interval time.Duration) *BandwidthMonitor {
 	if interval <= 0 {
 		interval = 500 * time.Millisecond // 默认0.5秒统计一次
 	}
 
-	return &BandwidthMonitor{
-		deviceMonitor: deviceMonitor,
-		stats:         NewBandwidthStats(int(time.Second/interval) * 2), // 保存2秒的历史数据
+	stats := NewBandwidthStats(int(time.Second/interval) * 2) // 保存2秒的历史数据
+
+	bm := &BandwidthMonitor{
+		stats:         stats,
+		direction:     newDirectionClassifier(device, stats),
+		segments:      newSegmentTracker(stats.HistorySize),
+		encapsulation: newEncapsulationTracker(),
 		stopChan:      make(chan struct{}),
 		interval:      interval,
 		// 默认不过滤任何数据包
-		filter: "",
+		filter:             "",
+		attributeProcesses: config.Config.Processes.Enabled,
+		trackRemotes:       config.Config.Remotes.Enabled,
+		trackHostnames:     config.Config.Hostnames.Enabled,
+		exportFlows:        config.Config.FlowExport.Enabled,
+	}
+	bm.segments.refreshGateways(device)
+	bm.SetSampling(config.Config.Capture.Sampling)
+	return bm
+}
+
+// refreshAddresses 刷新本地地址、网卡MAC和网关MAC
+// 其他命名空间内的网卡在命名空间内通过netlink获取地址和MAC；网关MAC读取自/proc/net，
+// 只反映当前命名空间，命名空间内的网卡只通过路由通告学习网关
+func (bm *BandwidthMonitor) refreshAddresses() {
+	device := bm.deviceMonitor.GetDevice()
+	err := bm.deviceMonitor.InNamespace(func() error {
+		bm.stats.refreshLocalNetworks()
+		bm.direction.refreshMAC(device)
+		return nil
+	})
+	if err != nil {
+		log.Printf("刷新网卡 %s 的地址失败: %v", bm.deviceMonitor.Name(), err)
+	}
+	if !bm.deviceMonitor.Namespaced() {
+		bm.segments.refreshGateways(device)
 	}
 }
 
 // SetFilter 设置BPF过滤器
 func (bm *BandwidthMonitor) SetFilter(filter string) error {
-	handle := bm.deviceMonitor.GetHandle()
-	if err := handle.SetBPFFilter(filter); err != nil {
-		return fmt.Errorf("设置BPF过滤器失败: %v", err)
+	for _, capture := range bm.deviceMonitor.GetCaptures() {
+		if err := capture.SetBPFFilter(filter); err != nil {
+			return fmt.Errorf("设置BPF过滤器失败: %v", err)
+		}
 	}
 
 	bm.filter = filter
@@ -325,129 +451,214 @@ func (bm *BandwidthMonitor) SetFilter(filter string) error {
 
 // Start 开始监控带宽
 func (bm *BandwidthMonitor) Start() {
-	handle := bm.deviceMonitor.GetHandle()
+	// 每次启动使用新的停止信号，支持停止后重新启动
+	stop := make(chan struct{})
+	bm.stopChan = stop
 
-	// 设置过滤器去除ARP等链路层流量
-	if bm.filter == "" {
-		// 默认只捕获IPv4和IPv6流量
-		bm.SetFilter("ip or ip6")
-	}
-
-	packetSource := gopacket.NewPacketSource(handle, handle.LinkType())
-	packetSource.NoCopy = true
-
-	// 设置解码器选项，指定需要解码的层
-	packetSource.DecodeOptions.Lazy = false
-	packetSource.DecodeOptions.NoCopy = true
-
-	// 统计协程
+	// 统计协程，同时定期检查网卡链路状态和刷新本地地址
 	go func() {
 		ticker := time.NewTicker(bm.interval)
 		defer ticker.Stop()
+		linkTicker := time.NewTicker(linkCheckInterval)
+		defer linkTicker.Stop()
+		addrTicker := time.NewTicker(localAddrRefreshInterval)
+		defer addrTicker.Stop()
 
 		for {
 			select {
 			case <-ticker.C:
+				totals := bm.takeTotals()
+				bm.stats.add(&totals)
 				bm.stats.CalculateSpeeds()
-			case <-bm.stopChan:
+				bm.segments.CalculateSpeeds(totals.segments)
+			case <-linkTicker.C:
+				bm.checkLink()
+			case <-addrTicker.C:
+				// DHCP续租、IPv6地址变化或VPN上线后更新本地地址
+				bm.refreshAddresses()
+			case <-stop:
 				return
 			}
 		}
 	}()
 
-	// 数据包处理协程
-	go func() {
-		for packet := range packetSource.Packets() {
-			select {
-			case <-bm.stopChan:
-				return
-			default:
-				// 跳过不完整的包
-				if packet.ErrorLayer() != nil {
-					continue
-				}
+	// 数据包处理协程，计数器模式下不抓包
+	if !bm.counterMode() {
+		go bm.capturePackets(stop)
+	}
+}
 
-				// 识别上下行方向
-				isUpload := bm.isUploadPacket(packet)
+// readPackets 从当前抓包句柄读取并处理数据包，停止时返回nil，句柄出错时返回错误
+// AF_PACKET开启fanout时每个句柄由一个协程处理，任一句柄出错时中断其余句柄
+func (bm *BandwidthMonitor) readPackets(stop chan struct{}) error {
+	captures := bm.deviceMonitor.GetCaptures()
+	if len(captures) == 1 {
+		return bm.readCapture(captures[0], bm.worker(0), stop)
+	}
 
-				// 更新统计数据
-				bm.stats.Update(packet, isUpload)
-			}
+	errs := make(chan error, len(captures))
+	for i, capture := range captures {
+		go func(capture devicemonitor.Capture, w *packetWorker) {
+			errs <- bm.readCapture(capture, w, stop)
+		}(capture, bm.worker(i))
+	}
+	var firstErr error
+	for range captures {
+		if err := <-errs; err != nil && firstErr == nil {
+			firstErr = err
+			bm.deviceMonitor.Interrupt()
 		}
-	}()
+	}
+	return firstErr
 }
 
-// Stop 停止监控
-func (bm *BandwidthMonitor) Stop() {
-	close(bm.stopChan)
+// readCapture 从单个抓包句柄读取并处理数据包，数据直接指向抓包缓冲区，不构造gopacket.Packet
+func (bm *BandwidthMonitor) readCapture(capture devicemonitor.Capture, w *packetWorker, stop chan struct{}) error {
+	// BPF过滤器已在打开设备时按配置设置（默认捕获IPv4和IPv6流量，包括VLAN内的IP流量）
+	linkType := capture.LinkType()
+	// 停止后不再读取，已关闭的句柄由此释放
+	defer devicemonitor.EndRead(capture)
+
+	for {
+		data, ci, err := capture.ZeroCopyReadPacketData()
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+		if err == pcap.NextErrorTimeoutExpired {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		bm.processPacket(w, data, ci, linkType)
+	}
 }
 
-// isUploadPacket 判断数据包是上行还是下行
-func (bm *BandwidthMonitor) isUploadPacket(packet gopacket.Packet) bool {
-	// 获取IP层
-	ipLayer := packet.Layer(layers.LayerTypeIPv4)
-	if ipLayer == nil {
-		ipLayer = packet.Layer(layers.LayerTypeIPv6)
-	}
-
-	if ipLayer != nil {
-		var srcIP, dstIP net.IP
-		var srcPort, dstPort uint16
-		protocol := "IP"
-
-		// 根据IP版本获取源目IP
-		if ipv4Layer := packet.Layer(layers.LayerTypeIPv4); ipv4Layer != nil {
-			ipv4, _ := ipv4Layer.(*layers.IPv4)
-			srcIP = ipv4.SrcIP
-			dstIP = ipv4.DstIP
-		} else if ipv6Layer := packet.Layer(layers.LayerTypeIPv6); ipv6Layer != nil {
-			ipv6, _ := ipv6Layer.(*layers.IPv6)
-			srcIP = ipv6.SrcIP
-			dstIP = ipv6.DstIP
-		}
+// processPacket 解码一个数据包的头部，更新带宽、WAN/LAN、VLAN和隧道、TCP及DNS统计
+func (bm *BandwidthMonitor) processPacket(w *packetWorker, data []byte, ci gopacket.CaptureInfo, linkType layers.LinkType) {
+	// 未被采样的数据包不解码，被采样的数据包按采样率放大计入带宽
+	policy := bm.sampling.Load()
+	if !policy.sample(w) {
+		return
+	}
 
-		// 获取传输层端口信息
-		if tcpLayer := packet.Layer(layers.LayerTypeTCP); tcpLayer != nil {
-			tcp, _ := tcpLayer.(*layers.TCP)
-			srcPort = uint16(tcp.SrcPort)
-			dstPort = uint16(tcp.DstPort)
-			protocol += "/TCP"
-		} else if udpLayer := packet.Layer(layers.LayerTypeUDP); udpLayer != nil {
-			udp, _ := udpLayer.(*layers.UDP)
-			srcPort = uint16(udp.SrcPort)
-			dstPort = uint16(udp.DstPort)
-			protocol += "/UDP"
-		}
+	pl := w.decoderFor(linkType).decode(data, ci)
+	if pl == nil {
+		return
+	}
 
-		// 生成五元组
-		flowID := bm.stats.generateFlowID(srcIP.String(), dstIP.String(), srcPort, dstPort, protocol)
-		// 记录流量（可选，目前仅用于防止内存泄漏）
-		bm.stats.recordFlow(flowID)
+	// 识别上行、下行或内网流量，隧道封装的数据包按内层地址判断
+	direction := bm.direction.classify(pl)
 
-		// 检查源IP和目的IP是否在本地网络
-		srcIsLocal := bm.stats.isLocalIP(srcIP)
-		dstIsLocal := bm.stats.isLocalIP(dstIP)
+	// 更新本协程的计数，统计协程每个间隔汇总一次
+	size := uint64(ci.Length)
+	w.counters.add(direction, size, policy.rate)
+	scaled := size * policy.rate
 
-		// 如果源IP是本地IP且目的IP不是本地IP，则是上行流量
-		if srcIsLocal && !dstIsLocal {
-			return true
+	// 按网关MAC统计WAN/LAN带宽，路由通告的发送方即为IPv6网关
+	if pl.eth != nil {
+		if pl.routerAdvertisement {
+			bm.segments.learnGateway(pl.eth.SrcMAC)
 		}
-
-		// 如果目的IP是本地IP且源IP不是本地IP，则是下行流量
-		if !srcIsLocal && dstIsLocal {
-			return false
+		if segment, ok := bm.segments.classify(pl.eth, bm.direction.ownMAC()); ok {
+			w.counters.segments[segment].Add(scaled)
 		}
+	}
+
+	// 按VLAN和隧道统计带宽
+	w.encapsulation.Update(pl, scaled, direction)
+
+	// 按连接统计流量，上报时归属到本机进程
+	if bm.attributeProcesses {
+		w.processes.Update(pl, scaled, direction)
+	}
+
+	// 按远端地址统计流量，上报时聚合为网段并查询ASN和国家
+	if bm.trackRemotes {
+		w.remotes.Update(pl, scaled, direction)
+	}
+
+	// 按连接统计流量，上报时归属到识别出的服务器名称
+	if bm.trackHostnames {
+		w.hostnames.Update(pl, scaled, direction)
+	}
+
+	// 按单向流统计，由导出协程按超时导出到收集器
+	if bm.exportFlows {
+		w.flowExports.Update(pl, scaled, policy.rate, ci.Timestamp)
+	}
+
+	// 更新TCP健康指标和握手RTT，内网流量按发出方向计入上行
+	// 采样时只统计被采样的数据包，不放大；同一连接两个方向的数据包不会同时被采样，不统计连接失败和DNS超时
+	sampled := policy.rate > 1
+	bm.updateTCPMetrics(w, pl, ci.Timestamp, direction != DirectionDownload, sampled)
+
+	// 更新被动DNS统计
+	bm.updateDNS(w, pl, ci.Timestamp, sampled)
+}
+
+// Stop 停止监控
+func (bm *BandwidthMonitor) Stop() {
+	close(bm.stopChan)
+}
 
-		// 对于内网流量，根据端口号判断
-		// 常见服务端口通常是目的地为服务端
-		if srcIsLocal && dstIsLocal {
-			// 如果目的端口小于1024，通常是服务器端口，认为是上行
-			return dstPort < 1024 && srcPort >= 1024
+// updateTCPMetrics 使用最内层TCP层更新本协程的重传、零窗口、RST、SYN统计及握手RTT
+func (bm *BandwidthMonitor) updateTCPMetrics(w *packetWorker, pl *packetLayers, ts time.Time, isUpload, sampled bool) {
+	if pl.network == nil || pl.tcp == nil {
+		return
+	}
+	w.tcpHealth.Update(pl.network.NetworkFlow(), pl.tcp, isUpload, ts, sampled)
+	w.tcpRTT.Update(pl.network.NetworkFlow(), pl.tcp, ts)
+}
+
+// updateDNS 使用DNS层更新本协程的查询、应答和时延统计，开启反向解析时记录应答中的地址和名称
+func (bm *BandwidthMonitor) updateDNS(w *packetWorker, pl *packetLayers, ts time.Time, sampled bool) {
+	if pl.dns == nil || pl.network == nil || pl.transport == nil {
+		return
+	}
+	w.dns.Update(pl.network.NetworkFlow(), pl.transport.TransportFlow(), pl.dns, ts, sampled)
+	if bm.reverseDNS != nil {
+		if ts.IsZero() {
+			ts = time.Now()
 		}
+		bm.reverseDNS.Learn(pl.dns, ts)
 	}
+}
 
-	// 默认情况，假设IP分类不明确的包是内部通信
-	return true
+// TakeEncapsulation 获取自上次上报以来按VLAN和隧道区分的流量，没有封装流量时返回nil
+func (bm *BandwidthMonitor) TakeEncapsulation() *EncapsulationStats {
+	return bm.encapsulation.Take(bm.deviceMonitor.Name(), bm.packetWorkers())
+}
+
+// Snapshot 获取当前带宽统计的快照（带网卡名称）
+func (bm *BandwidthMonitor) Snapshot() InterfaceStats {
+	bm.stats.mutex.Lock()
+	defer bm.stats.mutex.Unlock()
+
+	// 计数器模式只有网卡收发速率，没有WAN/LAN区分，也不采样
+	if bm.counterMode() {
+		return InterfaceStats{
+			Interface:             bm.deviceMonitor.Name(),
+			UploadSpeed:           bm.stats.UploadSpeed,
+			DownloadSpeed:         bm.stats.DownloadSpeed,
+			AvgUploadPacketSize:   bm.stats.AvgUploadPacketSize,
+			AvgDownloadPacketSize: bm.stats.AvgDownloadPacketSize,
+			Source:                sourceCounters,
+		}
+	}
+	return InterfaceStats{
+		Interface:             bm.deviceMonitor.Name(),
+		UploadSpeed:           bm.stats.UploadSpeed,
+		DownloadSpeed:         bm.stats.DownloadSpeed,
+		InternalSpeed:         bm.stats.InternalSpeed,
+		Segments:              bm.segments.Stats(),
+		AvgUploadPacketSize:   bm.stats.AvgUploadPacketSize,
+		AvgDownloadPacketSize: bm.stats.AvgDownloadPacketSize,
+		Sampling:              bm.samplingStats(),
+	}
 }
 
 // GetStats 获取当前带宽统计
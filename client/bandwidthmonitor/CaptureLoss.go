@@ -0,0 +1,86 @@
+package bandwidthmonitor
+
+import (
+	"log"
+	"sync"
+
+	"network-monitor-client/config"
+
+	"github.com/google/gopacket/pcap"
+)
+
+// CaptureStats 单个网卡自上次上报以来的抓包统计
+// 有丢包时带宽统计偏低，服务端据此将样本标记为lossy
+type CaptureStats struct {
+	Interface string `json:"interface"`
+	// 内核交给抓包缓冲区的数据包数量（Linux上包含因缓冲区满被丢弃的包）
+	Received uint64 `json:"received"`
+	// 因抓包缓冲区满被内核丢弃的数据包数量
+	Dropped uint64 `json:"dropped"`
+	// 被网卡或驱动丢弃的数据包数量
+	IfDropped uint64 `json:"if_dropped"`
+	// 丢包率（0-1）
+	LossRatio float64 `json:"loss_ratio"`
+}
+
+// lossTracker 记录上次读取的抓包统计，用于计算两次上报之间的增量
+type lossTracker struct {
+	mutex      sync.Mutex
+	last       pcap.Stats
+	generation uint64
+	valid      bool
+}
+
+// take 根据句柄的累计统计计算增量，重新打开设备后统计从0开始
+func (t *lossTracker) take(stats *pcap.Stats, generation uint64) (received, dropped, ifDropped uint64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	last := t.last
+	if !t.valid || t.generation != generation {
+		last = pcap.Stats{}
+	}
+	t.last = *stats
+	t.generation = generation
+	t.valid = true
+	return counterDelta(stats.PacketsReceived, last.PacketsReceived),
+		counterDelta(stats.PacketsDropped, last.PacketsDropped),
+		counterDelta(stats.PacketsIfDropped, last.PacketsIfDropped)
+}
+
+// counterDelta 计算计数器增量，处理libpcap的32位计数器回绕
+func counterDelta(current, last int) uint64 {
+	if current < last {
+		return uint64(current) + 1<<32 - uint64(last)
+	}
+	return uint64(current - last)
+}
+
+// TakeCaptureStats 获取自上次上报以来的抓包统计，丢包率超过阈值时输出告警
+// 句柄已关闭（抓包中断）或平台不支持时返回nil
+func (bm *BandwidthMonitor) TakeCaptureStats() *CaptureStats {
+	stats, generation, err := bm.deviceMonitor.Stats()
+	if err != nil {
+		return nil
+	}
+
+	received, dropped, ifDropped := bm.loss.take(stats, generation)
+	result := &CaptureStats{
+		Interface: bm.deviceMonitor.Name(),
+		Received:  received,
+		Dropped:   dropped,
+		IfDropped: ifDropped,
+	}
+	if total := received + ifDropped; total > 0 {
+		result.LossRatio = float64(dropped+ifDropped) / float64(total)
+		if result.LossRatio > 1 {
+			result.LossRatio = 1
+		}
+	}
+
+	if dropped+ifDropped > 0 && result.LossRatio > config.Config.Capture.LossWarnThreshold {
+		log.Printf("网卡 %s 抓包丢包率 %.2f%%（接收 %d，内核丢弃 %d，网卡丢弃 %d），带宽统计偏低",
+			result.Interface, result.LossRatio*100, received, dropped, ifDropped)
+	}
+	return result
+}
@@ -0,0 +1,137 @@
+package bandwidthmonitor
+
+import (
+	"log"
+	"time"
+)
+
+const (
+	// 检查网卡链路状态的周期
+	linkCheckInterval = 2 * time.Second
+	// 抓包中断后重新打开设备的间隔
+	reopenInterval = 5 * time.Second
+	// 等待上报的中断事件最大数量
+	maxPendingCaptureGaps = 100
+)
+
+// CaptureGap 抓包中断事件
+// 中断开始时上报一次（End为空），恢复后以相同的Start再上报一次
+type CaptureGap struct {
+	// 中断的网卡
+	Interface string `json:"interface"`
+	// 中断开始时间
+	Start time.Time `json:"start"`
+	// 恢复时间，未恢复时为空
+	End *time.Time `json:"end,omitempty"`
+	// 中断时长（秒），未恢复时为0
+	Duration float64 `json:"duration"`
+	// 中断原因
+	Reason string `json:"reason"`
+}
+
+// capturePackets 数据包处理循环，抓包句柄出错或网卡变化时重新打开设备
+func (bm *BandwidthMonitor) capturePackets(stop chan struct{}) {
+	for {
+		err := bm.readPackets(stop)
+		if err == nil {
+			return
+		}
+
+		reason := bm.takeLinkReason()
+		if reason == "" {
+			reason = err.Error()
+		}
+		if !bm.recoverCapture(reason, stop) {
+			return
+		}
+	}
+}
+
+// checkLink 检查网卡是否被删除、重建或停用，发现变化时中断当前读取，计数器模式下没有抓包句柄，不检查
+func (bm *BandwidthMonitor) checkLink() {
+	if bm.recovering.Load() || bm.counterMode() {
+		return
+	}
+	err := bm.deviceMonitor.CheckLink()
+	if err == nil {
+		return
+	}
+
+	bm.gapMutex.Lock()
+	bm.linkReason = err.Error()
+	bm.gapMutex.Unlock()
+	bm.deviceMonitor.Interrupt()
+}
+
+// takeLinkReason 获取并清除链路检查发现的中断原因
+func (bm *BandwidthMonitor) takeLinkReason() string {
+	bm.gapMutex.Lock()
+	defer bm.gapMutex.Unlock()
+	reason := bm.linkReason
+	bm.linkReason = ""
+	return reason
+}
+
+// recoverCapture 记录中断事件并反复尝试重新打开设备，停止监控时返回false
+func (bm *BandwidthMonitor) recoverCapture(reason string, stop chan struct{}) bool {
+	bm.recovering.Store(true)
+	defer bm.recovering.Store(false)
+
+	device := bm.deviceMonitor.Name()
+	start := time.Now()
+	log.Printf("网卡 %s 抓包中断: %s，%v后尝试重新打开", device, reason, reopenInterval)
+	bm.addCaptureGap(CaptureGap{Interface: device, Start: start, Reason: reason})
+
+	for {
+		select {
+		case <-stop:
+			return false
+		case <-time.After(reopenInterval):
+		}
+
+		if err := bm.deviceMonitor.Reopen(); err != nil {
+			log.Printf("网卡 %s 重新打开失败: %v", device, err)
+			continue
+		}
+		break
+	}
+
+	// 恢复通过SetFilter设置的过滤器
+	if bm.filter != "" {
+		if err := bm.SetFilter(bm.filter); err != nil {
+			log.Printf("网卡 %s 恢复BPF过滤器失败: %v", device, err)
+		}
+	}
+	// 网卡重建或切换后地址可能变化
+	bm.refreshAddresses()
+
+	end := time.Now()
+	log.Printf("网卡 %s 抓包已恢复（当前设备 %s），中断 %v", device, bm.deviceMonitor.Name(), end.Sub(start))
+	bm.addCaptureGap(CaptureGap{
+		Interface: device,
+		Start:     start,
+		End:       &end,
+		Duration:  end.Sub(start).Seconds(),
+		Reason:    reason,
+	})
+	return true
+}
+
+// addCaptureGap 记录抓包中断事件
+func (bm *BandwidthMonitor) addCaptureGap(gap CaptureGap) {
+	bm.gapMutex.Lock()
+	defer bm.gapMutex.Unlock()
+	if len(bm.gaps) >= maxPendingCaptureGaps {
+		bm.gaps = bm.gaps[1:]
+	}
+	bm.gaps = append(bm.gaps, gap)
+}
+
+// TakeCaptureGaps 获取自上次上报以来的抓包中断事件
+func (bm *BandwidthMonitor) TakeCaptureGaps() []CaptureGap {
+	bm.gapMutex.Lock()
+	defer bm.gapMutex.Unlock()
+	gaps := bm.gaps
+	bm.gaps = nil
+	return gaps
+}
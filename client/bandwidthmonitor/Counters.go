@@ -0,0 +1,66 @@
+package bandwidthmonitor
+
+import (
+	"log"
+
+	"network-monitor-client/devicemonitor"
+)
+
+// 计数器模式上报的数据来源
+const sourceCounters = "counters"
+
+// counterSource 计数器模式下按相邻两次读取网卡内核计数器的差值统计流量
+// 接收计入下行，发送计入上行，无法区分内网流量
+type counterSource struct {
+	last   *devicemonitor.InterfaceCounters
+	device string
+	// 上次读取是否失败，只在状态变化时输出日志
+	failing bool
+}
+
+// take 读取网卡计数器并返回与上次读取之间的流量，首次读取或读取失败时返回零值
+func (s *counterSource) take(deviceMonitor *devicemonitor.DeviceMonitor) trafficTotals {
+	var totals trafficTotals
+	device := deviceMonitor.Name()
+	current, err := deviceMonitor.ReadCounters()
+	if err != nil {
+		if !s.failing {
+			log.Printf("读取网卡 %s 的计数器失败: %v", device, err)
+			s.failing = true
+		}
+		s.last = nil
+		return totals
+	}
+	s.failing = false
+
+	// 网卡重建后计数器从0开始，切换网卡后重新建立基准
+	if last := s.last; last != nil && s.device == device {
+		totals.bytes[DirectionDownload] = kernelCounterDelta(current.RxBytes, last.RxBytes)
+		totals.packets[DirectionDownload] = kernelCounterDelta(current.RxPackets, last.RxPackets)
+		totals.bytes[DirectionUpload] = kernelCounterDelta(current.TxBytes, last.TxBytes)
+		totals.packets[DirectionUpload] = kernelCounterDelta(current.TxPackets, last.TxPackets)
+	}
+	s.last, s.device = current, device
+	return totals
+}
+
+// kernelCounterDelta 计算内核计数器的增量，计数器变小时视为网卡重建后重新计数
+func kernelCounterDelta(current, last uint64) uint64 {
+	if current < last {
+		return current
+	}
+	return current - last
+}
+
+// counterMode 是否为计数器模式（不抓包，只读取网卡的内核计数器）
+func (bm *BandwidthMonitor) counterMode() bool {
+	return bm.deviceMonitor != nil && bm.deviceMonitor.CounterMode()
+}
+
+// takeTotals 获取本间隔的流量，抓包时汇总各处理协程的计数，计数器模式下读取网卡的内核计数器
+func (bm *BandwidthMonitor) takeTotals() trafficTotals {
+	if bm.counterMode() {
+		return bm.kernelCounters.take(bm.deviceMonitor)
+	}
+	return bm.drainCounters()
+}
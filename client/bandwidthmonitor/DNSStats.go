@@ -0,0 +1,138 @@
+package bandwidthmonitor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	// 查询超过该时间未收到应答视为超时
+	dnsQueryTimeout = 5 * time.Second
+	// 等待应答的查询最大数量
+	maxPendingDNSQueries = 65536
+)
+
+// DNSStats 被动DNS统计
+type DNSStats struct {
+	// 查询数量
+	Queries uint64 `json:"queries"`
+	// 应答数量
+	Responses uint64 `json:"responses"`
+	// NOERROR应答数量
+	NoError uint64 `json:"noerror"`
+	// NXDOMAIN应答数量
+	NXDomain uint64 `json:"nxdomain"`
+	// SERVFAIL应答数量
+	ServFail uint64 `json:"servfail"`
+	// 其他错误应答数量（REFUSED、FORMERR等）
+	OtherErrors uint64 `json:"other_errors"`
+	// 未收到应答的查询数量
+	Timeouts uint64 `json:"timeouts"`
+	// 查询到应答的时延统计
+	Latency RTTSummary `json:"latency"`
+	// 采样时为采样率：计数只来自被采样的数据包，未按采样率放大；查询和应答很少同时被采样，不统计超时
+	SampleRate int `json:"sample_rate,omitempty"`
+}
+
+// dnsQueryKey 查询标识：查询方向的五元组和事务ID
+type dnsQueryKey struct {
+	network   gopacket.Flow
+	transport gopacket.Flow
+	id        uint16
+}
+
+// dnsPendingQuery 等待应答的查询
+type dnsPendingQuery struct {
+	ts time.Time
+	// 查询在采样时被记录，未收到应答多半是应答未被采样，超时不计数
+	sampled bool
+}
+
+// DNSTracker 从捕获的数据包中统计DNS查询和应答，每个处理协程一个，只在上报时与处理协程竞争锁
+type DNSTracker struct {
+	mutex   sync.Mutex
+	pending map[dnsQueryKey]dnsPendingQuery
+	stats   DNSStats
+	latency []float64
+}
+
+// NewDNSTracker 创建DNS统计器
+func NewDNSTracker() *DNSTracker {
+	return &DNSTracker{
+		pending: make(map[dnsQueryKey]dnsPendingQuery),
+	}
+}
+
+// Update 根据DNS报文更新统计，sampled表示数据包采样开启
+func (t *DNSTracker) Update(netFlow, transportFlow gopacket.Flow, dns *layers.DNS, ts time.Time, sampled bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	if !dns.QR {
+		t.stats.Queries++
+		key := dnsQueryKey{network: netFlow, transport: transportFlow, id: dns.ID}
+		if _, ok := t.pending[key]; !ok {
+			if len(t.pending) >= maxPendingDNSQueries {
+				t.pending = make(map[dnsQueryKey]dnsPendingQuery)
+			}
+			t.pending[key] = dnsPendingQuery{ts: ts, sampled: sampled}
+		}
+		return
+	}
+
+	t.stats.Responses++
+	switch dns.ResponseCode {
+	case layers.DNSResponseCodeNoErr:
+		t.stats.NoError++
+	case layers.DNSResponseCodeNXDomain:
+		t.stats.NXDomain++
+	case layers.DNSResponseCodeServFail:
+		t.stats.ServFail++
+	default:
+		t.stats.OtherErrors++
+	}
+
+	// 应答方向与查询相反
+	key := dnsQueryKey{network: netFlow.Reverse(), transport: transportFlow.Reverse(), id: dns.ID}
+	if query, ok := t.pending[key]; ok {
+		delete(t.pending, key)
+		if latency := ts.Sub(query.ts); latency >= 0 && len(t.latency) < maxRTTSamples {
+			t.latency = append(t.latency, float64(latency)/float64(time.Millisecond))
+		}
+	}
+}
+
+// drainInto 将自上次调用以来的计数累加到汇总结果，返回追加了时延样本的切片，并重置
+func (t *DNSTracker) drainInto(stats *DNSStats, latency []float64) []float64 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	for key, query := range t.pending {
+		if now.Sub(query.ts) > dnsQueryTimeout {
+			if !query.sampled {
+				t.stats.Timeouts++
+			}
+			delete(t.pending, key)
+		}
+	}
+
+	stats.Queries += t.stats.Queries
+	stats.Responses += t.stats.Responses
+	stats.NoError += t.stats.NoError
+	stats.NXDomain += t.stats.NXDomain
+	stats.ServFail += t.stats.ServFail
+	stats.OtherErrors += t.stats.OtherErrors
+	stats.Timeouts += t.stats.Timeouts
+	latency = append(latency, t.latency...)
+	t.stats = DNSStats{}
+	t.latency = nil
+	return latency
+}
@@ -0,0 +1,294 @@
+package bandwidthmonitor
+
+import (
+	"encoding/binary"
+	"net"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// packetLayers 数据包的链路层、VLAN、隧道信息以及最内层的网络层和传输层
+// 各字段指向解码器预先分配的层，只在下一个数据包解码前有效
+type packetLayers struct {
+	// 最外层的链路层，Linux cooked抓包时为sll
+	eth *layers.Ethernet
+	sll *layers.LinuxSLL
+	// 是否为IPv6路由通告（发送方即为网关）
+	routerAdvertisement bool
+	// 最内层的网络层和传输层，隧道封装的数据包按内层地址判断方向和统计TCP、DNS指标
+	network   gopacket.NetworkLayer
+	transport gopacket.TransportLayer
+	srcIP     net.IP
+	dstIP     net.IP
+	tcp       *layers.TCP
+	dns       *layers.DNS
+	// 最外层802.1Q标签的VLAN ID
+	vlan    uint16
+	hasVLAN bool
+	// 最外层隧道的类型和标识（VXLAN/GENEVE的VNI，GRE的Key，没有标识时为0）
+	tunnel   string
+	tunnelID uint32
+}
+
+// vlanLayer 记录第一个802.1Q标签的Dot1Q解码层，QinQ时内层标签会覆盖同一个Dot1Q
+type vlanLayer struct {
+	layers.Dot1Q
+	first uint16
+	count int
+}
+
+// DecodeFromBytes 解码802.1Q标签并记录最外层的VLAN ID
+func (v *vlanLayer) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if err := v.Dot1Q.DecodeFromBytes(data, df); err != nil {
+		return err
+	}
+	if v.count == 0 {
+		v.first = v.VLANIdentifier
+	}
+	v.count++
+	return nil
+}
+
+// geneveLayer 可用于DecodingLayerParser的GENEVE解码层
+type geneveLayer struct {
+	layers.Geneve
+}
+
+// CanDecode GENEVE解码层可解码的层类型
+func (g *geneveLayer) CanDecode() gopacket.LayerClass {
+	return layers.LayerTypeGeneve
+}
+
+// DecodeFromBytes 解码GENEVE头部，复用解码层时清空上一个数据包的选项
+func (g *geneveLayer) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	g.Options = g.Options[:0]
+	return g.Geneve.DecodeFromBytes(data, df)
+}
+
+// DNS服务端口
+const dnsPort = 53
+
+// tcpLayer TCP解码层，DNS over TCP的报文带2字节长度前缀，不交给DNS解码层，由collectLayers解析
+type tcpLayer struct {
+	layers.TCP
+}
+
+// NextLayerType DNS端口的载荷不继续解码
+func (t *tcpLayer) NextLayerType() gopacket.LayerType {
+	if t.SrcPort == dnsPort || t.DstPort == dnsPort {
+		return gopacket.LayerTypePayload
+	}
+	return t.TCP.NextLayerType()
+}
+
+// decodeTCPDNS 解码TCP段开头带长度前缀的DNS报文，报文跨越多个TCP段或被snaplen截断时不解码
+func decodeTCPDNS(dns *layers.DNS, payload []byte) bool {
+	if len(payload) < 2 {
+		return false
+	}
+	length := int(binary.BigEndian.Uint16(payload))
+	if length == 0 || len(payload) < 2+length {
+		return false
+	}
+	return dns.DecodeFromBytes(payload[2:2+length], gopacket.NilDecodeFeedback) == nil
+}
+
+// headerLayers 一组预先分配的头部解码层
+type headerLayers struct {
+	eth    layers.Ethernet
+	vlan   vlanLayer
+	ipv4   layers.IPv4
+	ipv6   layers.IPv6
+	ipv6x  layers.IPv6ExtensionSkipper
+	tcp    tcpLayer
+	udp    layers.UDP
+	dns    layers.DNS
+	parser *gopacket.DecodingLayerParser
+}
+
+// packetDecoder 使用DecodingLayerParser只解码需要的头部，各层预先分配，每个处理协程一个
+// 隧道（VXLAN、GENEVE、GRE）内层使用另一组解码层，避免覆盖外层的以太网头部
+type packetDecoder struct {
+	linkType layers.LinkType
+	// 外层，链路层类型为raw时按IP版本选择parser或parser6
+	outer   headerLayers
+	parser6 *gopacket.DecodingLayerParser
+	sll     layers.LinuxSLL
+	lo      layers.Loopback
+	icmpv6  layers.ICMPv6
+	// 隧道内层，按隧道类型选择起始的解码层
+	inner   headerLayers
+	vxlan   layers.VXLAN
+	geneve  geneveLayer
+	gre     layers.GRE
+	tunnels map[gopacket.LayerType]*gopacket.DecodingLayerParser
+
+	decoded      []gopacket.LayerType
+	innerDecoded []gopacket.LayerType
+	layers       packetLayers
+}
+
+// newPacketDecoder 为指定链路层类型创建解码器
+func newPacketDecoder(linkType layers.LinkType) *packetDecoder {
+	d := &packetDecoder{
+		linkType:     linkType,
+		decoded:      make([]gopacket.LayerType, 0, 16),
+		innerDecoded: make([]gopacket.LayerType, 0, 16),
+	}
+
+	o := &d.outer
+	outerLayers := []gopacket.DecodingLayer{
+		&o.eth, &o.vlan, &o.ipv4, &o.ipv6, &o.ipv6x, &o.tcp, &o.udp, &o.dns, &d.sll, &d.lo, &d.icmpv6,
+	}
+	first := layers.LayerTypeEthernet
+	switch linkType {
+	case layers.LinkTypeLinuxSLL:
+		first = layers.LayerTypeLinuxSLL
+	case layers.LinkTypeNull, layers.LinkTypeLoop:
+		first = layers.LayerTypeLoopback
+	case layers.LinkTypeRaw, layers.LinkTypeIPv4:
+		first = layers.LayerTypeIPv4
+		d.parser6 = gopacket.NewDecodingLayerParser(layers.LayerTypeIPv6, outerLayers...)
+	case layers.LinkTypeIPv6:
+		first = layers.LayerTypeIPv6
+	}
+	o.parser = gopacket.NewDecodingLayerParser(first, outerLayers...)
+
+	i := &d.inner
+	innerLayers := []gopacket.DecodingLayer{
+		&d.vxlan, &d.geneve, &d.gre, &i.eth, &i.vlan, &i.ipv4, &i.ipv6, &i.ipv6x, &i.tcp, &i.udp, &i.dns,
+	}
+	d.tunnels = make(map[gopacket.LayerType]*gopacket.DecodingLayerParser)
+	for _, tunnel := range []gopacket.LayerType{layers.LayerTypeVXLAN, layers.LayerTypeGeneve, layers.LayerTypeGRE} {
+		parser := gopacket.NewDecodingLayerParser(tunnel, innerLayers...)
+		parser.IgnoreUnsupported = true
+		d.tunnels[tunnel] = parser
+	}
+	return d
+}
+
+// decode 解码数据包头部，解码失败且不是截断导致时返回nil
+func (d *packetDecoder) decode(data []byte, ci gopacket.CaptureInfo) *packetLayers {
+	parser := d.outer.parser
+	if d.parser6 != nil && len(data) > 0 && data[0]>>4 == 6 {
+		parser = d.parser6
+	}
+	d.outer.vlan.count = 0
+	err := parser.DecodeLayers(data, &d.decoded)
+	truncated := parser.Truncated || ci.CaptureLength < ci.Length
+
+	// 外层遇到隧道头部时停止，由隧道解码层继续解码内层
+	var tunnel *gopacket.DecodingLayerParser
+	if unsupported, ok := err.(gopacket.UnsupportedLayerType); ok {
+		tunnel = d.tunnels[gopacket.LayerType(unsupported)]
+		err = nil
+	}
+	// 跳过不完整的包，snaplen截断导致的解码失败仍计入带宽
+	if err != nil && !truncated {
+		return nil
+	}
+
+	pl := &d.layers
+	*pl = packetLayers{}
+	ipLayers := collectLayers(pl, &d.outer, d.decoded)
+	for _, typ := range d.decoded {
+		switch typ {
+		case layers.LayerTypeLinuxSLL:
+			pl.sll = &d.sll
+		case layers.LayerTypeICMPv6:
+			pl.routerAdvertisement = d.icmpv6.TypeCode.Type() == layers.ICMPv6TypeRouterAdvertisement
+		}
+	}
+	if d.outer.vlan.count > 0 {
+		pl.vlan = d.outer.vlan.first
+		pl.hasVLAN = true
+	}
+	// IP报头直接承载IP报头时视为IP-in-IP隧道，同类型的内层会覆盖外层
+	if ipLayers > 1 {
+		pl.tunnel = tunnelIPIP
+	}
+
+	if tunnel != nil {
+		d.decodeTunnel(pl, tunnel, d.lastPayload())
+	}
+	return pl
+}
+
+// decodeTunnel 解码隧道头部及内层，内层有IP报头时使用内层的网络层和传输层
+func (d *packetDecoder) decodeTunnel(pl *packetLayers, parser *gopacket.DecodingLayerParser, payload []byte) {
+	if err := parser.DecodeLayers(payload, &d.innerDecoded); err != nil && !parser.Truncated {
+		return
+	}
+	if len(d.innerDecoded) == 0 {
+		return
+	}
+	if pl.tunnel == "" {
+		switch d.innerDecoded[0] {
+		case layers.LayerTypeVXLAN:
+			pl.tunnel, pl.tunnelID = tunnelVXLAN, d.vxlan.VNI
+		case layers.LayerTypeGeneve:
+			pl.tunnel, pl.tunnelID = tunnelGeneve, d.geneve.VNI
+		case layers.LayerTypeGRE:
+			pl.tunnel = tunnelGRE
+			if d.gre.KeyPresent {
+				pl.tunnelID = d.gre.Key
+			}
+		}
+	}
+
+	inner := packetLayers{}
+	if collectLayers(&inner, &d.inner, d.innerDecoded) > 0 {
+		pl.network, pl.srcIP, pl.dstIP = inner.network, inner.srcIP, inner.dstIP
+		pl.transport, pl.tcp, pl.dns = inner.transport, inner.tcp, inner.dns
+	}
+}
+
+// collectLayers 从已解码的层中取以太网、IP、传输层和DNS，返回IP层的数量
+func collectLayers(pl *packetLayers, h *headerLayers, decoded []gopacket.LayerType) int {
+	ipLayers := 0
+	for _, typ := range decoded {
+		switch typ {
+		case layers.LayerTypeEthernet:
+			if pl.eth == nil {
+				pl.eth = &h.eth
+			}
+		case layers.LayerTypeIPv4:
+			pl.network, pl.srcIP, pl.dstIP = &h.ipv4, h.ipv4.SrcIP, h.ipv4.DstIP
+			pl.transport, pl.tcp = nil, nil
+			ipLayers++
+		case layers.LayerTypeIPv6:
+			pl.network, pl.srcIP, pl.dstIP = &h.ipv6, h.ipv6.SrcIP, h.ipv6.DstIP
+			pl.transport, pl.tcp = nil, nil
+			ipLayers++
+		case layers.LayerTypeTCP:
+			pl.transport, pl.tcp = &h.tcp.TCP, &h.tcp.TCP
+			if (h.tcp.SrcPort == dnsPort || h.tcp.DstPort == dnsPort) && decodeTCPDNS(&h.dns, h.tcp.Payload) {
+				pl.dns = &h.dns
+			}
+		case layers.LayerTypeUDP:
+			pl.transport = &h.udp
+		case layers.LayerTypeDNS:
+			pl.dns = &h.dns
+		}
+	}
+	return ipLayers
+}
+
+// lastPayload 获取外层最后一个解码层的载荷，即隧道头部开始的数据
+func (d *packetDecoder) lastPayload() []byte {
+	if len(d.decoded) == 0 {
+		return nil
+	}
+	switch d.decoded[len(d.decoded)-1] {
+	case layers.LayerTypeUDP:
+		return d.outer.udp.LayerPayload()
+	case layers.LayerTypeIPv4:
+		return d.outer.ipv4.LayerPayload()
+	case layers.LayerTypeIPv6:
+		return d.outer.ipv6.LayerPayload()
+	case layers.LayerTypeIPv6HopByHop, layers.LayerTypeIPv6Destination, layers.LayerTypeIPv6Routing:
+		return d.outer.ipv6x.LayerPayload()
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package bandwidthmonitor
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// dnsMessage 编码DNS查询或应答
+func dnsMessage(t *testing.T, response bool) []byte {
+	t.Helper()
+	dns := &layers.DNS{
+		ID:        0x1234,
+		QR:        response,
+		RD:        true,
+		RA:        response,
+		Questions: []layers.DNSQuestion{{Name: []byte("example.com"), Type: layers.DNSTypeA, Class: layers.DNSClassIN}},
+	}
+	if response {
+		dns.Answers = []layers.DNSResourceRecord{{
+			Name: []byte("example.com"), Type: layers.DNSTypeA, Class: layers.DNSClassIN, TTL: 300,
+			IP: net.IPv4(93, 184, 216, 34),
+		}}
+	}
+	buf := gopacket.NewSerializeBuffer()
+	if err := dns.SerializeTo(buf, gopacket.SerializeOptions{FixLengths: true}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// tcpPacket 编码以太网、IPv4、TCP数据包，response为true时由DNS服务器发往客户端
+func tcpPacket(t *testing.T, payload []byte, response bool) []byte {
+	t.Helper()
+	client, server := net.IPv4(10, 0, 0, 1), net.IPv4(192, 0, 2, 53)
+	var clientPort, serverPort layers.TCPPort = 40000, dnsPort
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: client, DstIP: server}
+	tcp := &layers.TCP{SrcPort: clientPort, DstPort: serverPort, ACK: true, PSH: true, Window: 65535}
+	if response {
+		ip.SrcIP, ip.DstIP = server, client
+		tcp.SrcPort, tcp.DstPort = serverPort, clientPort
+	}
+	tcp.SetNetworkLayerForChecksum(ip)
+	eth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 5},
+		DstMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 6},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, eth, ip, tcp, gopacket.Payload(payload)); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withLengthPrefix DNS over TCP的2字节长度前缀
+func withLengthPrefix(message []byte) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(len(message))), message...)
+}
+
+func TestDecodeTCPDNS(t *testing.T) {
+	d := newPacketDecoder(layers.LinkTypeEthernet)
+	tracker := NewDNSTracker()
+	start := time.Unix(1700000000, 0)
+
+	for i, packet := range []struct {
+		response bool
+		ts       time.Time
+	}{
+		{false, start},
+		{true, start.Add(20 * time.Millisecond)},
+	} {
+		data := tcpPacket(t, withLengthPrefix(dnsMessage(t, packet.response)), packet.response)
+		ci := gopacket.CaptureInfo{Timestamp: packet.ts, CaptureLength: len(data), Length: len(data)}
+		pl := d.decode(data, ci)
+		if pl == nil || pl.tcp == nil {
+			t.Fatalf("数据包 %d 解码失败", i)
+		}
+		if pl.dns == nil {
+			t.Fatalf("数据包 %d 未解码DNS over TCP报文", i)
+		}
+		if pl.dns.QR != packet.response || len(pl.dns.Questions) != 1 || string(pl.dns.Questions[0].Name) != "example.com" {
+			t.Fatalf("数据包 %d DNS报文 = %+v", i, pl.dns)
+		}
+		tracker.Update(pl.network.NetworkFlow(), pl.transport.TransportFlow(), pl.dns, packet.ts, false)
+	}
+
+	var stats DNSStats
+	latency := tracker.drainInto(&stats, nil)
+	if stats.Queries != 1 || stats.Responses != 1 || stats.NoError != 1 {
+		t.Errorf("查询 %d 应答 %d NOERROR %d，期望各1", stats.Queries, stats.Responses, stats.NoError)
+	}
+	if len(latency) != 1 || latency[0] != 20 {
+		t.Errorf("时延样本 = %v，期望 [20]", latency)
+	}
+}
+
+func TestDecodeTCPDNSPartial(t *testing.T) {
+	d := newPacketDecoder(layers.LinkTypeEthernet)
+	message := withLengthPrefix(dnsMessage(t, true))
+
+	// 报文跨越多个TCP段时只统计带宽，不解码DNS
+	for _, payload := range [][]byte{message[:len(message)/2], message[len(message)/2:], message[:1]} {
+		data := tcpPacket(t, payload, true)
+		pl := d.decode(data, gopacket.CaptureInfo{CaptureLength: len(data), Length: len(data)})
+		if pl == nil || pl.tcp == nil {
+			t.Fatal("不完整的DNS over TCP报文应仍能解码TCP层")
+		}
+		if pl.dns != nil {
+			t.Errorf("不完整的DNS over TCP报文不应解码: %+v", pl.dns)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package bandwidthmonitor
+
+import (
+	"bytes"
+	"net"
+	"sync/atomic"
+
+	"network-monitor-client/config"
+
+	"github.com/google/gopacket/layers"
+)
+
+// Direction 流量方向
+type Direction int
+
+const (
+	// DirectionUpload 本机或内网发往外部的流量
+	DirectionUpload Direction = iota
+	// DirectionDownload 外部发往本机或内网的流量
+	DirectionDownload
+	// DirectionInternal 内网之间（东西向）的流量，以及无法判断方向的流量
+	DirectionInternal
+)
+
+// 方向判断方式
+const (
+	// 按本机地址和内网网段判断
+	directionMethodIP = "ip"
+	// 按网卡MAC地址（Linux cooked抓包按包类型）判断
+	directionMethodLink = "link"
+)
+
+// directionClassifier 根据配置判断数据包的流量方向
+type directionClassifier struct {
+	method string
+	// 配置的内网网段，为空时使用本机网卡所在子网
+	internalNetworks []*net.IPNet
+	stats            *BandwidthStats
+	// 抓包网卡的MAC地址，网卡重建后刷新
+	mac atomic.Pointer[net.HardwareAddr]
+}
+
+// newDirectionClassifier 按配置为指定网卡创建方向判断器
+func newDirectionClassifier(device string, stats *BandwidthStats) *directionClassifier {
+	c := &directionClassifier{
+		method: config.Config.Direction.MethodFor(device),
+		stats:  stats,
+	}
+	if c.method == "" {
+		c.method = directionMethodIP
+	}
+	for _, cidr := range config.Config.Direction.InternalNetworks {
+		// 配置加载时已校验
+		if _, network, err := net.ParseCIDR(cidr); err == nil {
+			c.internalNetworks = append(c.internalNetworks, network)
+		}
+	}
+	c.refreshMAC(device)
+	return c
+}
+
+// refreshMAC 重新获取抓包网卡的MAC地址
+func (c *directionClassifier) refreshMAC(device string) {
+	var mac net.HardwareAddr
+	if iface, err := net.InterfaceByName(device); err == nil {
+		mac = iface.HardwareAddr
+	}
+	c.mac.Store(&mac)
+}
+
+// ownMAC 获取抓包网卡的MAC地址
+func (c *directionClassifier) ownMAC() net.HardwareAddr {
+	return *c.mac.Load()
+}
+
+// isInternal 判断地址是否为本机地址或在内网网段内
+func (c *directionClassifier) isInternal(ip net.IP) bool {
+	if len(c.internalNetworks) == 0 {
+		return c.stats.isLocalIP(ip)
+	}
+	if c.stats.isHostIP(ip) {
+		return true
+	}
+	for _, network := range c.internalNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// classify 判断数据包的流量方向，隧道封装的数据包按内层地址判断
+func (c *directionClassifier) classify(pl *packetLayers) Direction {
+	srcIP, dstIP := pl.srcIP, pl.dstIP
+	if c.method == directionMethodLink {
+		if direction, ok := c.linkDirection(pl); ok {
+			// 与内网对端之间的流量计入internal
+			if direction == DirectionUpload && dstIP != nil && c.isInternal(dstIP) {
+				return DirectionInternal
+			}
+			if direction == DirectionDownload && srcIP != nil && c.isInternal(srcIP) {
+				return DirectionInternal
+			}
+			return direction
+		}
+	}
+
+	if srcIP == nil || dstIP == nil {
+		return DirectionInternal
+	}
+	srcInternal := c.isInternal(srcIP)
+	dstInternal := c.isInternal(dstIP)
+	switch {
+	case srcInternal && !dstInternal:
+		return DirectionUpload
+	case !srcInternal && dstInternal:
+		return DirectionDownload
+	default:
+		return DirectionInternal
+	}
+}
+
+// linkDirection 根据链路层判断数据包是本网卡发出还是接收
+func (c *directionClassifier) linkDirection(pl *packetLayers) (Direction, bool) {
+	// any设备等Linux cooked抓包带有包类型
+	if sll := pl.sll; sll != nil {
+		if sll.PacketType == layers.LinuxSLLPacketTypeOutgoing {
+			return DirectionUpload, true
+		}
+		if sll.PacketType == layers.LinuxSLLPacketTypeHost {
+			return DirectionDownload, true
+		}
+		return DirectionInternal, false
+	}
+
+	eth := pl.eth
+	mac := c.ownMAC()
+	if eth == nil || len(mac) == 0 {
+		return DirectionInternal, false
+	}
+	switch {
+	case bytes.Equal(eth.SrcMAC, mac):
+		return DirectionUpload, true
+	case bytes.Equal(eth.DstMAC, mac):
+		return DirectionDownload, true
+	}
+	return DirectionInternal, false
+}
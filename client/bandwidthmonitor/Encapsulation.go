@@ -0,0 +1,203 @@
+package bandwidthmonitor
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// 隧道封装类型
+const (
+	tunnelVXLAN  = "vxlan"
+	tunnelGeneve = "geneve"
+	tunnelGRE    = "gre"
+	tunnelIPIP   = "ipip"
+)
+
+// 单个网卡统计的VLAN和隧道最大数量，超出后新出现的不再单独统计
+const maxEncapsulationKeys = 4096
+
+// VLANStats 单个VLAN的流量速率（字节/秒），方向按内层地址判断
+type VLANStats struct {
+	VLAN          uint16  `json:"vlan"`
+	UploadSpeed   float64 `json:"upload_speed"`
+	DownloadSpeed float64 `json:"download_speed"`
+	InternalSpeed float64 `json:"internal_speed"`
+}
+
+// TunnelStats 单个隧道（租户网络）的流量速率（字节/秒），方向按内层地址判断
+type TunnelStats struct {
+	// 隧道类型：vxlan、geneve、gre、ipip
+	Type string `json:"type"`
+	// VXLAN/GENEVE的VNI或GRE的Key，没有标识时为0
+	VNI           uint32  `json:"vni"`
+	UploadSpeed   float64 `json:"upload_speed"`
+	DownloadSpeed float64 `json:"download_speed"`
+	InternalSpeed float64 `json:"internal_speed"`
+}
+
+// EncapsulationStats 单个网卡自上次上报以来按VLAN和隧道区分的流量
+type EncapsulationStats struct {
+	Interface string        `json:"interface"`
+	VLANs     []VLANStats   `json:"vlans,omitempty"`
+	Tunnels   []TunnelStats `json:"tunnels,omitempty"`
+}
+
+// tunnelKey 隧道标识
+type tunnelKey struct {
+	tunnel string
+	id     uint32
+}
+
+// directionBytes 按流量方向累计的字节数
+type directionBytes [3]uint64
+
+// add 累加另一组字节数
+func (b *directionBytes) add(other *directionBytes) {
+	for i := range b {
+		b[i] += other[i]
+	}
+}
+
+// speeds 按时长换算为上行、下行和内网速率
+func (b *directionBytes) speeds(duration float64) (float64, float64, float64) {
+	return float64(b[DirectionUpload]) / duration,
+		float64(b[DirectionDownload]) / duration,
+		float64(b[DirectionInternal]) / duration
+}
+
+// encapsulationCounters 单个处理协程按VLAN和隧道累计的字节数
+// 只在汇总时与处理协程竞争锁
+type encapsulationCounters struct {
+	mutex   sync.Mutex
+	vlans   map[uint16]*directionBytes
+	tunnels map[tunnelKey]*directionBytes
+}
+
+// newEncapsulationCounters 创建VLAN和隧道字节计数
+func newEncapsulationCounters() *encapsulationCounters {
+	return &encapsulationCounters{
+		vlans:   make(map[uint16]*directionBytes),
+		tunnels: make(map[tunnelKey]*directionBytes),
+	}
+}
+
+// Update 按数据包的VLAN和隧道累计字节数
+func (c *encapsulationCounters) Update(pl *packetLayers, size uint64, direction Direction) {
+	if !pl.hasVLAN && pl.tunnel == "" {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if pl.hasVLAN {
+		counter, ok := c.vlans[pl.vlan]
+		if !ok && len(c.vlans) < maxEncapsulationKeys {
+			counter = &directionBytes{}
+			c.vlans[pl.vlan] = counter
+		}
+		if counter != nil {
+			counter[direction] += size
+		}
+	}
+	if pl.tunnel != "" {
+		key := tunnelKey{tunnel: pl.tunnel, id: pl.tunnelID}
+		counter, ok := c.tunnels[key]
+		if !ok && len(c.tunnels) < maxEncapsulationKeys {
+			counter = &directionBytes{}
+			c.tunnels[key] = counter
+		}
+		if counter != nil {
+			counter[direction] += size
+		}
+	}
+}
+
+// drainInto 将计数累加到汇总结果并重置
+func (c *encapsulationCounters) drainInto(vlans map[uint16]*directionBytes, tunnels map[tunnelKey]*directionBytes) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for vlan, counter := range c.vlans {
+		total, ok := vlans[vlan]
+		if !ok {
+			if len(vlans) >= maxEncapsulationKeys {
+				continue
+			}
+			total = &directionBytes{}
+			vlans[vlan] = total
+		}
+		total.add(counter)
+	}
+	for key, counter := range c.tunnels {
+		total, ok := tunnels[key]
+		if !ok {
+			if len(tunnels) >= maxEncapsulationKeys {
+				continue
+			}
+			total = &directionBytes{}
+			tunnels[key] = total
+		}
+		total.add(counter)
+	}
+	if len(c.vlans) > 0 {
+		c.vlans = make(map[uint16]*directionBytes)
+	}
+	if len(c.tunnels) > 0 {
+		c.tunnels = make(map[tunnelKey]*directionBytes)
+	}
+}
+
+// encapsulationTracker 汇总各处理协程的VLAN和隧道字节数并换算为速率
+type encapsulationTracker struct {
+	mutex    sync.Mutex
+	lastTake time.Time
+}
+
+// newEncapsulationTracker 创建VLAN和隧道流量统计器
+func newEncapsulationTracker() *encapsulationTracker {
+	return &encapsulationTracker{lastTake: time.Now()}
+}
+
+// Take 获取自上次上报以来各VLAN和隧道的平均速率并重置计数，没有封装流量时返回nil
+func (t *encapsulationTracker) Take(device string, workers []*packetWorker) *EncapsulationStats {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	vlans := make(map[uint16]*directionBytes)
+	tunnels := make(map[tunnelKey]*directionBytes)
+	for _, w := range workers {
+		w.encapsulation.drainInto(vlans, tunnels)
+	}
+
+	now := time.Now()
+	duration := now.Sub(t.lastTake).Seconds()
+	t.lastTake = now
+	if len(vlans) == 0 && len(tunnels) == 0 {
+		return nil
+	}
+	if duration <= 0 {
+		duration = 1
+	}
+
+	stats := &EncapsulationStats{Interface: device}
+	for vlan, counter := range vlans {
+		s := VLANStats{VLAN: vlan}
+		s.UploadSpeed, s.DownloadSpeed, s.InternalSpeed = counter.speeds(duration)
+		stats.VLANs = append(stats.VLANs, s)
+	}
+	for key, counter := range tunnels {
+		s := TunnelStats{Type: key.tunnel, VNI: key.id}
+		s.UploadSpeed, s.DownloadSpeed, s.InternalSpeed = counter.speeds(duration)
+		stats.Tunnels = append(stats.Tunnels, s)
+	}
+	sort.Slice(stats.VLANs, func(i, j int) bool { return stats.VLANs[i].VLAN < stats.VLANs[j].VLAN })
+	sort.Slice(stats.Tunnels, func(i, j int) bool {
+		if stats.Tunnels[i].Type != stats.Tunnels[j].Type {
+			return stats.Tunnels[i].Type < stats.Tunnels[j].Type
+		}
+		return stats.Tunnels[i].VNI < stats.Tunnels[j].VNI
+	})
+	return stats
+}
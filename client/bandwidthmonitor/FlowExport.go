@@ -0,0 +1,295 @@
+package bandwidthmonitor
+
+import (
+	"log"
+	"net/netip"
+	"sync"
+	"time"
+
+	"network-monitor-client/config"
+	"network-monitor-client/flowexport"
+
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	// 单个处理协程计数表的最大流数量，写满后交给导出协程并换用新表
+	maxExportFlows = 65536
+	// 单个处理协程等待导出协程汇总的已写满计数表数量，超出后新出现的流只计入丢弃数
+	maxFullExportMaps = 4
+	// 流缓存的最大流数量，超出后新出现的流立即导出
+	maxCachedFlows = 262144
+	// 检查流超时并导出的间隔
+	flowExportInterval = time.Second
+)
+
+// TCP标志位，与NetFlow、IPFIX的tcpControlBits一致
+const (
+	tcpFlagFIN = 1 << iota
+	tcpFlagSYN
+	tcpFlagRST
+	tcpFlagPSH
+	tcpFlagACK
+	tcpFlagURG
+	tcpFlagECE
+	tcpFlagCWR
+)
+
+// exportKey 单向流标识，NetFlow、IPFIX的流记录区分方向
+type exportKey struct {
+	protocol uint8
+	src      netip.AddrPort
+	dst      netip.AddrPort
+}
+
+// exportFlow 单向流的数据包数、字节数、首末数据包时间及TCP标志位
+type exportFlow struct {
+	packets  uint64
+	bytes    uint64
+	first    time.Time
+	last     time.Time
+	tcpFlags uint8
+}
+
+// merge 合并同一条流的计数
+func (f *exportFlow) merge(other *exportFlow) {
+	f.packets += other.packets
+	f.bytes += other.bytes
+	if other.first.Before(f.first) {
+		f.first = other.first
+	}
+	if other.last.After(f.last) {
+		f.last = other.last
+	}
+	f.tcpFlags |= other.tcpFlags
+}
+
+// tcpFlags 获取TCP数据包的标志位
+func tcpFlags(tcp *layers.TCP) uint8 {
+	var flags uint8
+	for _, flag := range []struct {
+		set bool
+		bit uint8
+	}{
+		{tcp.FIN, tcpFlagFIN}, {tcp.SYN, tcpFlagSYN}, {tcp.RST, tcpFlagRST}, {tcp.PSH, tcpFlagPSH},
+		{tcp.ACK, tcpFlagACK}, {tcp.URG, tcpFlagURG}, {tcp.ECE, tcpFlagECE}, {tcp.CWR, tcpFlagCWR},
+	} {
+		if flag.set {
+			flags |= flag.bit
+		}
+	}
+	return flags
+}
+
+// flowExportCounters 单个处理协程按单向流累计的计数，只在导出协程汇总时竞争锁
+type flowExportCounters struct {
+	mutex sync.Mutex
+	flows map[exportKey]*exportFlow
+	// 已写满、等待导出协程汇总的计数表
+	full []map[exportKey]*exportFlow
+	// 计数表全部写满时未统计的数据包数
+	dropped uint64
+	// 计数表写满时通知导出协程提前汇总，未开启导出时为nil
+	wake chan<- struct{}
+}
+
+// newFlowExportCounters 创建按单向流的计数
+func newFlowExportCounters(wake chan<- struct{}) *flowExportCounters {
+	return &flowExportCounters{flows: make(map[exportKey]*exportFlow), wake: wake}
+}
+
+// Update 累计TCP、UDP数据包所属单向流的计数，size和packets为按采样率放大后的值
+func (c *flowExportCounters) Update(pl *packetLayers, size, packets uint64, ts time.Time) {
+	protocol, src, dst, ok := flowEndpoints(pl)
+	if !ok {
+		return
+	}
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	var flags uint8
+	if pl.tcp != nil {
+		flags = tcpFlags(pl.tcp)
+	}
+	key := exportKey{protocol: protocol, src: src, dst: dst}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	flow, ok := c.flows[key]
+	if !ok {
+		if len(c.flows) >= maxExportFlows {
+			if len(c.full) >= maxFullExportMaps {
+				c.dropped += packets
+				return
+			}
+			c.full = append(c.full, c.flows)
+			c.flows = make(map[exportKey]*exportFlow)
+			select {
+			case c.wake <- struct{}{}:
+			default:
+			}
+		}
+		flow = &exportFlow{first: ts, last: ts}
+		c.flows[key] = flow
+	}
+	flow.packets += packets
+	flow.bytes += size
+	flow.tcpFlags |= flags
+	if ts.Before(flow.first) {
+		flow.first = ts
+	}
+	if ts.After(flow.last) {
+		flow.last = ts
+	}
+}
+
+// drainInto 将计数合并到汇总结果并重置，返回计数表写满时未统计的数据包数
+func (c *flowExportCounters) drainInto(flows map[exportKey]*exportFlow) uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, counted := range append(c.full, c.flows) {
+		for key, flow := range counted {
+			if total, ok := flows[key]; ok {
+				total.merge(flow)
+			} else {
+				flows[key] = flow
+			}
+		}
+	}
+	dropped := c.dropped
+	c.flows = make(map[exportKey]*exportFlow, len(c.flows))
+	c.full, c.dropped = nil, 0
+	return dropped
+}
+
+// flowExporter 汇总各网卡的流计数，按活跃、非活跃超时将流记录导出到各收集器
+// 流记录以数据包的五元组区分方向，抓包管道没有单独的流标识
+type flowExporter struct {
+	mutex     sync.Mutex
+	active    time.Duration
+	inactive  time.Duration
+	cache     map[exportKey]*exportFlow
+	exporters []*flowexport.Exporter
+	// 处理协程的计数表写满时提前汇总
+	wake     chan struct{}
+	stopChan chan struct{}
+	stopped  chan struct{}
+}
+
+// newFlowExporter 按配置创建导出器，未开启或所有收集器都无法连接时返回nil
+func newFlowExporter(flowExport config.FlowExportConfig) *flowExporter {
+	if !flowExport.Enabled {
+		return nil
+	}
+	e := &flowExporter{
+		active:   flowExport.ActiveTimeout,
+		inactive: flowExport.InactiveTimeout,
+		cache:    make(map[exportKey]*exportFlow),
+		wake:     make(chan struct{}, 1),
+		stopChan: make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	for _, collector := range flowExport.Collectors {
+		exporter, err := flowexport.NewExporter(collector.Address, collector.Version, flowExport.DomainID)
+		if err != nil {
+			log.Printf("%v，跳过该收集器", err)
+			continue
+		}
+		e.exporters = append(e.exporters, exporter)
+	}
+	if len(e.exporters) == 0 {
+		log.Printf("没有可用的流记录收集器，不导出流记录")
+		return nil
+	}
+	return e
+}
+
+// Start 启动导出协程，每秒及处理协程的计数表写满时汇总各网卡的流计数并导出超时的流
+func (e *flowExporter) Start(monitors []*BandwidthMonitor) {
+	go func() {
+		defer close(e.stopped)
+		ticker := time.NewTicker(flowExportInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-e.stopChan:
+				return
+			case <-ticker.C:
+				e.flush(monitors, time.Now(), false)
+			case <-e.wake:
+				e.flush(monitors, time.Now(), false)
+			}
+		}
+	}()
+}
+
+// Stop 停止导出协程，导出缓存中的所有流并关闭到收集器的连接
+func (e *flowExporter) Stop(monitors []*BandwidthMonitor) {
+	close(e.stopChan)
+	<-e.stopped
+	e.flush(monitors, time.Now(), true)
+	for _, exporter := range e.exporters {
+		exporter.Close()
+	}
+}
+
+// flush 汇总流计数，导出超过非活跃超时、活跃超时或已收到FIN、RST的流，all为true时导出所有流
+func (e *flowExporter) flush(monitors []*BandwidthMonitor, now time.Time, all bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	flows := make(map[exportKey]*exportFlow)
+	var dropped uint64
+	for _, bm := range monitors {
+		for _, w := range bm.packetWorkers() {
+			dropped += w.flowExports.drainInto(flows)
+		}
+	}
+	if dropped > 0 {
+		log.Printf("流计数表已满，%d 个数据包未计入导出的流记录", dropped)
+	}
+
+	var records []flowexport.Record
+	for key, flow := range flows {
+		if cached, ok := e.cache[key]; ok {
+			cached.merge(flow)
+		} else if len(e.cache) < maxCachedFlows {
+			e.cache[key] = flow
+		} else {
+			records = append(records, exportRecord(key, flow))
+		}
+	}
+	for key, flow := range e.cache {
+		if all || now.Sub(flow.last) >= e.inactive || now.Sub(flow.first) >= e.active ||
+			flow.tcpFlags&(tcpFlagFIN|tcpFlagRST) != 0 {
+			records = append(records, exportRecord(key, flow))
+			delete(e.cache, key)
+		}
+	}
+	if len(records) == 0 {
+		return
+	}
+
+	for _, exporter := range e.exporters {
+		if err := exporter.Export(records); err != nil {
+			log.Printf("导出流记录失败: %v", err)
+		}
+	}
+}
+
+// exportRecord 将缓存的流转换为导出的流记录
+func exportRecord(key exportKey, flow *exportFlow) flowexport.Record {
+	return flowexport.Record{
+		Protocol: key.protocol,
+		Src:      key.src,
+		Dst:      key.dst,
+		TCPFlags: flow.tcpFlags,
+		Packets:  flow.packets,
+		Bytes:    flow.bytes,
+		Start:    flow.first,
+		End:      flow.last,
+	}
+}
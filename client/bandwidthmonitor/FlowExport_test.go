@@ -0,0 +1,182 @@
+package bandwidthmonitor
+
+import (
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"network-monitor-client/flowexport"
+
+	"github.com/google/gopacket/layers"
+)
+
+// v5报文头及记录长度
+const (
+	testV5HeaderSize = 24
+	testV5RecordSize = 48
+)
+
+// testFlowExporter 创建导出到本地v5收集器的导出器，返回导出器和收集器连接
+func testFlowExporter(t *testing.T, active, inactive time.Duration) (*flowExporter, net.PacketConn) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	exporter, err := flowexport.NewExporter(conn.LocalAddr().String(), flowexport.VersionV5, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { exporter.Close() })
+	return &flowExporter{
+		active:    active,
+		inactive:  inactive,
+		cache:     make(map[exportKey]*exportFlow),
+		exporters: []*flowexport.Exporter{exporter},
+	}, conn
+}
+
+// receiveExported 接收收集器收到的所有v5记录，返回源端口到数据包数的映射
+func receiveExported(t *testing.T, conn net.PacketConn) map[uint16]uint32 {
+	t.Helper()
+	exported := make(map[uint16]uint32)
+	buf := make([]byte, 65535)
+	for {
+		conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		size, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return exported
+		}
+		count := int(binary.BigEndian.Uint16(buf[2:]))
+		if size != testV5HeaderSize+count*testV5RecordSize {
+			t.Fatalf("v5报文长度 %d 与记录数 %d 不符", size, count)
+		}
+		for i := 0; i < count; i++ {
+			r := buf[testV5HeaderSize+i*testV5RecordSize:]
+			exported[binary.BigEndian.Uint16(r[32:])] = binary.BigEndian.Uint32(r[16:])
+		}
+	}
+}
+
+// testExportKey 以源端口区分的测试流
+func testExportKey(port uint16) exportKey {
+	return exportKey{
+		protocol: 6,
+		src:      netip.AddrPortFrom(netip.MustParseAddr("10.0.0.1"), port),
+		dst:      netip.AddrPortFrom(netip.MustParseAddr("192.0.2.1"), 443),
+	}
+}
+
+// addTestFlow 向处理协程的计数中加入一条流
+func addTestFlow(w *packetWorker, port uint16, packets uint64, first, last time.Time, flags uint8) {
+	w.flowExports.mutex.Lock()
+	defer w.flowExports.mutex.Unlock()
+	w.flowExports.flows[testExportKey(port)] = &exportFlow{
+		packets: packets, bytes: packets * 1000, first: first, last: last, tcpFlags: flags,
+	}
+}
+
+// checkExported 检查导出的流及其数据包数
+func checkExported(t *testing.T, got, want map[uint16]uint32) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("导出的流 = %v，期望 %v", got, want)
+		return
+	}
+	for port, packets := range want {
+		if got[port] != packets {
+			t.Errorf("导出的流 = %v，期望 %v", got, want)
+			return
+		}
+	}
+}
+
+func TestFlowExporterFlush(t *testing.T) {
+	e, conn := testFlowExporter(t, time.Minute, 15*time.Second)
+	bm := newBandwidthMonitor("", 0)
+	w := bm.worker(0)
+	monitors := []*BandwidthMonitor{bm}
+	base := time.Unix(1700000000, 0)
+
+	// 1：超过非活跃超时；2：收到FIN；3：持续活跃；4：刚开始
+	addTestFlow(w, 1, 1, base, base, tcpFlagSYN)
+	addTestFlow(w, 2, 2, base.Add(15*time.Second), base.Add(19*time.Second), tcpFlagACK|tcpFlagFIN)
+	addTestFlow(w, 3, 3, base, base.Add(19*time.Second), tcpFlagACK)
+	addTestFlow(w, 4, 4, base.Add(18*time.Second), base.Add(19*time.Second), tcpFlagACK)
+	e.flush(monitors, base.Add(20*time.Second), false)
+	checkExported(t, receiveExported(t, conn), map[uint16]uint32{1: 1, 2: 2})
+	if len(e.cache) != 2 {
+		t.Errorf("缓存的流数量 = %d，期望 2", len(e.cache))
+	}
+
+	// 3的新计数合并到缓存后超过活跃超时；4超过非活跃超时
+	addTestFlow(w, 3, 5, base.Add(20*time.Second), base.Add(60*time.Second), tcpFlagACK)
+	e.flush(monitors, base.Add(61*time.Second), false)
+	checkExported(t, receiveExported(t, conn), map[uint16]uint32{3: 8, 4: 4})
+	if len(e.cache) != 0 {
+		t.Errorf("缓存的流数量 = %d，期望 0", len(e.cache))
+	}
+
+	// 未超时的流在all为true时全部导出
+	addTestFlow(w, 5, 6, base.Add(61*time.Second), base.Add(62*time.Second), tcpFlagACK)
+	e.flush(monitors, base.Add(62*time.Second), false)
+	checkExported(t, receiveExported(t, conn), map[uint16]uint32{})
+	e.flush(monitors, base.Add(62*time.Second), true)
+	checkExported(t, receiveExported(t, conn), map[uint16]uint32{5: 6})
+}
+
+func TestFlowExportCountersOverflow(t *testing.T) {
+	wake := make(chan struct{}, 1)
+	c := newFlowExportCounters(wake)
+	udp := &layers.UDP{}
+	pl := &packetLayers{transport: udp, srcIP: net.ParseIP("10.0.0.1"), dstIP: net.ParseIP("192.0.2.1")}
+	ts := time.Unix(1700000000, 0)
+	update := func(flow int) {
+		udp.SrcPort, udp.DstPort = layers.UDPPort(flow>>16), layers.UDPPort(flow)
+		c.Update(pl, 100, 1, ts)
+	}
+
+	// 写满的计数表交给导出协程，不丢弃新出现的流
+	for i := 0; i < maxExportFlows+1; i++ {
+		update(i)
+	}
+	select {
+	case <-wake:
+	default:
+		t.Error("计数表写满时应通知导出协程")
+	}
+	// 写满前已统计的流在新表中继续计数，汇总时合并
+	update(0)
+
+	flows := make(map[exportKey]*exportFlow)
+	if dropped := c.drainInto(flows); dropped != 0 {
+		t.Errorf("丢弃数据包数 = %d，期望 0", dropped)
+	}
+	if len(flows) != maxExportFlows+1 {
+		t.Fatalf("汇总的流数量 = %d，期望 %d", len(flows), maxExportFlows+1)
+	}
+	for key, flow := range flows {
+		if key.src.Port() == 0 && key.dst.Port() == 0 && flow.packets != 2 {
+			t.Errorf("跨计数表的流数据包数 = %d，期望 2", flow.packets)
+		}
+	}
+
+	// 等待汇总的计数表也写满后只计入丢弃数
+	total := maxExportFlows * (maxFullExportMaps + 1)
+	for i := 0; i < total+10; i++ {
+		update(i)
+	}
+	flows = make(map[exportKey]*exportFlow)
+	if dropped := c.drainInto(flows); dropped != 10 {
+		t.Errorf("丢弃数据包数 = %d，期望 10", dropped)
+	}
+	if len(flows) != total {
+		t.Errorf("汇总的流数量 = %d，期望 %d", len(flows), total)
+	}
+	if len(c.flows) != 0 || len(c.full) != 0 || c.dropped != 0 {
+		t.Error("汇总后计数应清零")
+	}
+}
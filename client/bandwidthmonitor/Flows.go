@@ -0,0 +1,48 @@
+package bandwidthmonitor
+
+import (
+	"net/netip"
+
+	"github.com/google/gopacket/layers"
+)
+
+// 传输层协议号
+const (
+	protocolTCP = 6
+	protocolUDP = 17
+)
+
+// flowEndpoints 获取TCP或UDP数据包的协议号及源、目的地址和端口，其他数据包返回false
+func flowEndpoints(pl *packetLayers) (protocol uint8, src, dst netip.AddrPort, ok bool) {
+	var srcPort, dstPort uint16
+	switch transport := pl.transport.(type) {
+	case *layers.TCP:
+		protocol, srcPort, dstPort = protocolTCP, uint16(transport.SrcPort), uint16(transport.DstPort)
+	case *layers.UDP:
+		protocol, srcPort, dstPort = protocolUDP, uint16(transport.SrcPort), uint16(transport.DstPort)
+	default:
+		return 0, src, dst, false
+	}
+	src = netip.AddrPortFrom(addrFromIP(pl.srcIP), srcPort)
+	dst = netip.AddrPortFrom(addrFromIP(pl.dstIP), dstPort)
+	return protocol, src, dst, true
+}
+
+// flowKey 与方向无关的连接标识，两端按地址和端口排序，同一连接两个方向的数据包对应同一个标识
+type flowKey struct {
+	protocol uint8
+	low      netip.AddrPort
+	high     netip.AddrPort
+}
+
+// newFlowKey 获取数据包所属连接的标识，非TCP、UDP数据包返回false
+func newFlowKey(pl *packetLayers) (flowKey, bool) {
+	protocol, src, dst, ok := flowEndpoints(pl)
+	if !ok {
+		return flowKey{}, false
+	}
+	if dst.Compare(src) < 0 {
+		src, dst = dst, src
+	}
+	return flowKey{protocol: protocol, low: src, high: dst}, true
+}
@@ -0,0 +1,266 @@
+package bandwidthmonitor
+
+import (
+	"time"
+
+	"network-monitor-client/config"
+	"network-monitor-client/devicemonitor"
+)
+
+// InterfaceStats 单个网卡（或主机汇总）的带宽统计
+type InterfaceStats struct {
+	// 网卡名称，主机汇总为"total"
+	Interface     string  `json:"interface"`
+	UploadSpeed   float64 `json:"upload_speed"`
+	DownloadSpeed float64 `json:"download_speed"`
+	// 内网（东西向）流量速率，不计入上下行
+	InternalSpeed float64 `json:"internal_speed"`
+	// 按网关MAC区分的WAN/LAN带宽，未获知网关MAC时为空
+	Segments              *SegmentStats `json:"segments,omitempty"`
+	AvgUploadPacketSize   float64       `json:"avg_upload_packet_size"`
+	AvgDownloadPacketSize float64       `json:"avg_download_packet_size"`
+	// 采样方式及速率的误差范围，不采样时为空
+	Sampling *SamplingStats `json:"sampling,omitempty"`
+	// 数据来源，计数器模式为counters（只有网卡收发速率），抓包时为空
+	Source string `json:"source,omitempty"`
+}
+
+// HostStats 主机汇总及各网卡的带宽统计
+type HostStats struct {
+	Total      InterfaceStats
+	Interfaces []InterfaceStats
+}
+
+// HostMonitor 管理多个网卡的带宽监控器
+// 每个网卡独立统计带宽，TCP和DNS指标在主机级别汇总
+type HostMonitor struct {
+	monitors []*BandwidthMonitor
+	// 按进程统计流量，未开启时为nil
+	processes *processTracker
+	// 按远端网段统计流量，未开启时为nil
+	remotes *remoteTracker
+	// 按服务器名称统计流量，未开启时为nil
+	hostnames *hostnameTracker
+	// 从DNS应答学习的地址名称，各网卡共享，未开启时为nil
+	reverseDNS *reverseDNSCache
+	// 导出NetFlow、IPFIX流记录，未开启时为nil
+	flows *flowExporter
+}
+
+// NewHostMonitor 为每个设备监控器创建带宽监控器
+func NewHostMonitor(deviceMonitors []*devicemonitor.DeviceMonitor, interval time.Duration) *HostMonitor {
+	hm := &HostMonitor{reverseDNS: newReverseDNSCache(config.Config.ReverseDNS)}
+	for _, d := range deviceMonitors {
+		bm := NewBandwidthMonitor(d, interval)
+		bm.reverseDNS = hm.reverseDNS
+		hm.monitors = append(hm.monitors, bm)
+	}
+	if config.Config.Processes.Enabled {
+		hm.processes = newProcessTracker(config.Config.Processes.Top)
+	}
+	if config.Config.Remotes.Enabled {
+		hm.remotes = newRemoteTracker(config.Config.Remotes, hm.reverseDNS)
+	}
+	if config.Config.Hostnames.Enabled {
+		hm.hostnames = newHostnameTracker(config.Config.Hostnames.Top, hm.reverseDNS)
+	}
+	hm.flows = newFlowExporter(config.Config.FlowExport)
+	if hm.flows != nil {
+		for _, bm := range hm.monitors {
+			bm.flowWake = hm.flows.wake
+		}
+	}
+	return hm
+}
+
+// Start 开始监控所有网卡
+func (hm *HostMonitor) Start() {
+	for _, bm := range hm.monitors {
+		bm.Start()
+	}
+	if hm.reverseDNS != nil {
+		hm.reverseDNS.Start()
+	}
+	if hm.flows != nil {
+		hm.flows.Start(hm.monitors)
+	}
+}
+
+// Stop 停止监控所有网卡
+func (hm *HostMonitor) Stop() {
+	for _, bm := range hm.monitors {
+		bm.Stop()
+	}
+	if hm.reverseDNS != nil {
+		hm.reverseDNS.Stop()
+	}
+	if hm.flows != nil {
+		hm.flows.Stop(hm.monitors)
+	}
+}
+
+// SetSampling 修改所有网卡的数据包采样方式
+func (hm *HostMonitor) SetSampling(sampling config.SamplingConfig) {
+	for _, bm := range hm.monitors {
+		bm.SetSampling(sampling)
+	}
+}
+
+// TakeCaptureGaps 获取所有网卡自上次上报以来的抓包中断事件
+func (hm *HostMonitor) TakeCaptureGaps() []CaptureGap {
+	var gaps []CaptureGap
+	for _, bm := range hm.monitors {
+		gaps = append(gaps, bm.TakeCaptureGaps()...)
+	}
+	return gaps
+}
+
+// TakeCaptureStats 获取各网卡自上次上报以来的抓包统计，跳过抓包中断的网卡
+func (hm *HostMonitor) TakeCaptureStats() []CaptureStats {
+	var stats []CaptureStats
+	for _, bm := range hm.monitors {
+		if s := bm.TakeCaptureStats(); s != nil {
+			stats = append(stats, *s)
+		}
+	}
+	return stats
+}
+
+// TakeEncapsulation 获取各网卡自上次上报以来按VLAN和隧道区分的流量，跳过没有封装流量的网卡
+func (hm *HostMonitor) TakeEncapsulation() []EncapsulationStats {
+	var stats []EncapsulationStats
+	for _, bm := range hm.monitors {
+		if s := bm.TakeEncapsulation(); s != nil {
+			stats = append(stats, *s)
+		}
+	}
+	return stats
+}
+
+// TakeInterfaceHealth 获取各网卡自上次上报以来的错误计数和链路状态，跳过无法读取计数器的网卡
+func (hm *HostMonitor) TakeInterfaceHealth() []InterfaceHealthStats {
+	var stats []InterfaceHealthStats
+	for _, bm := range hm.monitors {
+		if s := bm.TakeInterfaceHealth(); s != nil {
+			stats = append(stats, *s)
+		}
+	}
+	return stats
+}
+
+// TakeProcesses 获取自上次上报以来流量最大的进程和容器，未开启按进程统计时返回nil
+func (hm *HostMonitor) TakeProcesses() ([]ProcessTraffic, []ContainerTraffic) {
+	if hm.processes == nil {
+		return nil, nil
+	}
+	return hm.processes.Take(hm.monitors)
+}
+
+// TakeRemotes 获取自上次上报以来流量最大的远端网段、远端地址及按ASN、国家、分类汇总的流量，未开启时返回nil
+func (hm *HostMonitor) TakeRemotes() *RemoteStats {
+	if hm.remotes == nil {
+		return nil
+	}
+	return hm.remotes.Take(hm.monitors)
+}
+
+// TakeHostnames 获取自上次上报以来流量最大的服务器名称，未开启时返回nil
+func (hm *HostMonitor) TakeHostnames() []HostnameTraffic {
+	if hm.hostnames == nil {
+		return nil
+	}
+	return hm.hostnames.Take(hm.monitors)
+}
+
+// GetStats 获取各网卡的带宽统计及主机汇总
+func (hm *HostMonitor) GetStats() *HostStats {
+	if len(hm.monitors) == 0 {
+		return nil
+	}
+
+	stats := &HostStats{Total: InterfaceStats{Interface: "total"}}
+	var uploadPacketRate, downloadPacketRate float64
+	for _, bm := range hm.monitors {
+		s := bm.Snapshot()
+		stats.Interfaces = append(stats.Interfaces, s)
+
+		stats.Total.UploadSpeed += s.UploadSpeed
+		stats.Total.DownloadSpeed += s.DownloadSpeed
+		stats.Total.InternalSpeed += s.InternalSpeed
+		if s.Segments != nil {
+			if stats.Total.Segments == nil {
+				stats.Total.Segments = &SegmentStats{}
+			}
+			stats.Total.Segments.add(s.Segments)
+		}
+		if s.Sampling != nil {
+			if stats.Total.Sampling == nil {
+				stats.Total.Sampling = &SamplingStats{}
+			}
+			stats.Total.Sampling.add(s.Sampling)
+		}
+		// 通过速率和平均包大小估算包速率，用于计算汇总的平均包大小
+		if s.AvgUploadPacketSize > 0 {
+			uploadPacketRate += s.UploadSpeed / s.AvgUploadPacketSize
+		}
+		if s.AvgDownloadPacketSize > 0 {
+			downloadPacketRate += s.DownloadSpeed / s.AvgDownloadPacketSize
+		}
+	}
+	if uploadPacketRate > 0 {
+		stats.Total.AvgUploadPacketSize = stats.Total.UploadSpeed / uploadPacketRate
+	}
+	if downloadPacketRate > 0 {
+		stats.Total.AvgDownloadPacketSize = stats.Total.DownloadSpeed / downloadPacketRate
+	}
+	return stats
+}
+
+// TakeTCPHealth 汇总各网卡各处理协程自上次上报以来的TCP健康指标
+func (hm *HostMonitor) TakeTCPHealth() TCPHealthStats {
+	var stats TCPHealthStats
+	for _, bm := range hm.monitors {
+		for _, w := range bm.packetWorkers() {
+			stats.add(w.tcpHealth.Take())
+		}
+	}
+	stats.SampleRate = hm.sampleRate()
+	return stats
+}
+
+// TakeTCPRTT 汇总各网卡各处理协程自上次上报以来的握手RTT样本并计算统计
+func (hm *HostMonitor) TakeTCPRTT() TCPRTTStats {
+	samples := newRTTSamples()
+	for _, bm := range hm.monitors {
+		for _, w := range bm.packetWorkers() {
+			w.tcpRTT.drainInto(samples)
+		}
+	}
+	return samples.summarize()
+}
+
+// TakeDNS 汇总各网卡各处理协程自上次上报以来的被动DNS统计
+func (hm *HostMonitor) TakeDNS() DNSStats {
+	var stats DNSStats
+	var latency []float64
+	for _, bm := range hm.monitors {
+		for _, w := range bm.packetWorkers() {
+			latency = w.dns.drainInto(&stats, latency)
+		}
+	}
+	stats.Latency = summarizeRTT(latency)
+	stats.SampleRate = hm.sampleRate()
+	return stats
+}
+
+// sampleRate 各网卡当前的最大采样率，不采样时返回0（TCP和DNS统计不标注采样率）
+func (hm *HostMonitor) sampleRate() int {
+	var rate uint64
+	for _, bm := range hm.monitors {
+		rate = max(rate, bm.sampling.Load().rate)
+	}
+	if rate <= 1 {
+		return 0
+	}
+	return int(rate)
+}
@@ -0,0 +1,371 @@
+package bandwidthmonitor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket/layers"
+)
+
+// 主机名的来源
+const (
+	hostnameSourceTLS  = "tls"
+	hostnameSourceHTTP = "http"
+)
+
+const (
+	// 单个处理协程每个上报周期统计的最大连接数量，超出后新出现的连接不再单独统计
+	maxHostnameFlows = 65536
+	// 单个处理协程同时等待后续分段的ClientHello数量
+	maxPendingHellos = 1024
+	// 跨多个TCP分段的ClientHello最多缓存的字节数
+	maxHelloSize = 16 * 1024
+	// 记录主机名的最大连接数量
+	maxNamedFlows = 262144
+	// 连接超过该时间没有流量后不再保留主机名
+	namedFlowIdleTimeout = 5 * time.Minute
+)
+
+// HostnameTraffic 单个服务器名称自上次上报以来的流量（字节），采样时为按采样率放大的估算值
+type HostnameTraffic struct {
+	// TLS SNI或HTTP Host中的服务器名称，无法识别时使用反向解析缓存中连接两端地址的名称
+	// 为空表示无法识别名称的TCP、UDP流量
+	Hostname string `json:"hostname"`
+	// 名称来源：tls、http、dns（DNS应答）、ptr（PTR记录）
+	Source string `json:"source,omitempty"`
+	// 产生流量的连接数量
+	Flows         int    `json:"flows"`
+	UploadBytes   uint64 `json:"upload_bytes"`
+	DownloadBytes uint64 `json:"download_bytes"`
+	InternalBytes uint64 `json:"internal_bytes"`
+}
+
+// total 各方向字节数之和
+func (h *HostnameTraffic) total() uint64 {
+	return h.UploadBytes + h.DownloadBytes + h.InternalBytes
+}
+
+// flowName 从连接中识别出的服务器名称
+type flowName struct {
+	name   string
+	source string
+}
+
+// pendingHello 被拆分到多个TCP分段的ClientHello，按序号拼接后续分段
+type pendingHello struct {
+	data    []byte
+	nextSeq uint32
+}
+
+// hostnameCounters 单个处理协程按连接累计的字节数及新识别的服务器名称
+// 只在汇总时与处理协程竞争锁
+type hostnameCounters struct {
+	mutex   sync.Mutex
+	flows   map[flowKey]*directionBytes
+	names   map[flowKey]flowName
+	pending map[flowKey]*pendingHello
+}
+
+// newHostnameCounters 创建按连接的字节计数
+func newHostnameCounters() *hostnameCounters {
+	return &hostnameCounters{
+		flows:   make(map[flowKey]*directionBytes),
+		names:   make(map[flowKey]flowName),
+		pending: make(map[flowKey]*pendingHello),
+	}
+}
+
+// Update 累计连接的字节数，从TCP载荷中识别TLS SNI或HTTP Host
+// 载荷被snaplen截断时可能无法识别，QUIC等加密握手不识别
+func (c *hostnameCounters) Update(pl *packetLayers, size uint64, direction Direction) {
+	key, ok := newFlowKey(pl)
+	if !ok {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	counter, ok := c.flows[key]
+	if !ok {
+		if len(c.flows) >= maxHostnameFlows {
+			return
+		}
+		counter = &directionBytes{}
+		c.flows[key] = counter
+	}
+	counter[direction] += size
+
+	if pl.tcp != nil && len(pl.tcp.Payload) > 0 {
+		c.inspect(key, pl.tcp)
+	}
+}
+
+// inspect 识别TCP载荷开头的ClientHello或HTTP请求，ClientHello不完整时缓存等待后续分段
+func (c *hostnameCounters) inspect(key flowKey, tcp *layers.TCP) {
+	payload := tcp.Payload
+	nextSeq := tcp.Seq + uint32(len(payload))
+
+	if pending, ok := c.pending[key]; ok {
+		delete(c.pending, key)
+		if tcp.Seq != pending.nextSeq || len(pending.data)+len(payload) > maxHelloSize {
+			return
+		}
+		payload = append(pending.data, payload...)
+	}
+
+	if name, more := parseTLSServerName(payload); name != "" {
+		c.names[key] = flowName{name: name, source: hostnameSourceTLS}
+		return
+	} else if more {
+		if len(c.pending) < maxPendingHellos {
+			c.pending[key] = &pendingHello{data: append([]byte(nil), payload...), nextSeq: nextSeq}
+		}
+		return
+	}
+	if name := parseHTTPHost(payload); name != "" {
+		c.names[key] = flowName{name: name, source: hostnameSourceHTTP}
+	}
+}
+
+// drainInto 将计数和新识别的名称累加到汇总结果并重置，跨越上报周期仍未完成的ClientHello丢弃
+func (c *hostnameCounters) drainInto(flows map[flowKey]*directionBytes, names map[flowKey]flowName) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for key, counter := range c.flows {
+		total, ok := flows[key]
+		if !ok {
+			total = &directionBytes{}
+			flows[key] = total
+		}
+		total.add(counter)
+	}
+	for key, name := range c.names {
+		names[key] = name
+	}
+	clear(c.flows)
+	clear(c.names)
+	clear(c.pending)
+}
+
+// parseTLSServerName 从TLS ClientHello中读取SNI扩展的服务器名称
+// 不是ClientHello时返回空；ClientHello被拆分且已有数据中没有SNI时more为true
+func parseTLSServerName(data []byte) (name string, more bool) {
+	// 记录头：类型(22=握手) 版本(2) 长度(2)，握手头：类型(1=ClientHello) 长度(3)
+	if len(data) < 9 || data[0] != 0x16 || data[1] != 0x03 || data[5] != 0x01 {
+		return "", false
+	}
+	recordEnd := 5 + int(binary.BigEndian.Uint16(data[3:5]))
+	incomplete := len(data) < recordEnd
+	if !incomplete {
+		data = data[:recordEnd]
+	}
+
+	// 跳过版本(2)、随机数(32)、会话ID、密码套件和压缩方法
+	pos := 9 + 2 + 32
+	for _, lengthSize := range []int{1, 2, 1} {
+		if pos+lengthSize > len(data) {
+			return "", incomplete
+		}
+		length := int(data[pos])
+		if lengthSize == 2 {
+			length = int(binary.BigEndian.Uint16(data[pos:]))
+		}
+		pos += lengthSize + length
+	}
+
+	// 扩展：类型(2) 长度(2) 数据，SNI扩展类型为0
+	pos += 2
+	for pos+4 <= len(data) {
+		extType := binary.BigEndian.Uint16(data[pos:])
+		extLen := int(binary.BigEndian.Uint16(data[pos+2:]))
+		pos += 4
+		if pos+extLen > len(data) {
+			return "", incomplete
+		}
+		if extType == 0 {
+			return parseServerNameExtension(data[pos : pos+extLen]), false
+		}
+		pos += extLen
+	}
+	return "", incomplete
+}
+
+// parseServerNameExtension 解析SNI扩展：列表长度(2)，每项为类型(1，0=主机名) 长度(2) 名称
+func parseServerNameExtension(ext []byte) string {
+	if len(ext) < 2 {
+		return ""
+	}
+	ext = ext[2:]
+	for len(ext) >= 3 {
+		nameType := ext[0]
+		length := int(binary.BigEndian.Uint16(ext[1:]))
+		if 3+length > len(ext) {
+			return ""
+		}
+		if nameType == 0 {
+			return normalizeHostname(string(ext[3 : 3+length]))
+		}
+		ext = ext[3+length:]
+	}
+	return ""
+}
+
+// 识别明文HTTP请求的方法
+var httpMethods = [][]byte{
+	[]byte("GET "), []byte("POST "), []byte("PUT "), []byte("HEAD "), []byte("DELETE "),
+	[]byte("OPTIONS "), []byte("PATCH "), []byte("CONNECT "),
+}
+
+// parseHTTPHost 从明文HTTP请求头中读取Host，不是HTTP请求或头部被截断时返回空
+func parseHTTPHost(data []byte) string {
+	isRequest := false
+	for _, method := range httpMethods {
+		if bytes.HasPrefix(data, method) {
+			isRequest = true
+			break
+		}
+	}
+	if !isRequest {
+		return ""
+	}
+	if end := bytes.Index(data, []byte("\r\n\r\n")); end >= 0 {
+		data = data[:end]
+	}
+	for _, line := range bytes.Split(data, []byte("\r\n"))[1:] {
+		name, value, ok := bytes.Cut(line, []byte(":"))
+		if ok && strings.EqualFold(string(name), "host") {
+			return normalizeHostname(string(bytes.TrimSpace(value)))
+		}
+	}
+	return ""
+}
+
+// normalizeHostname 转为小写并去掉端口和末尾的点，包含非法字符时返回空
+func normalizeHostname(name string) string {
+	if host, _, err := net.SplitHostPort(name); err == nil {
+		name = host
+	}
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	if name == "" || len(name) > 253 {
+		return ""
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_' || r == ':') {
+			return ""
+		}
+	}
+	return name
+}
+
+// namedFlow 已识别服务器名称的连接
+type namedFlow struct {
+	flowName
+	lastSeen time.Time
+}
+
+// hostnameTracker 记录各连接的服务器名称，汇总各网卡的连接流量并按名称排序上报
+type hostnameTracker struct {
+	mutex sync.Mutex
+	top   int
+	names map[flowKey]*namedFlow
+	// 无法识别服务器名称时按地址查询名称，未开启反向解析时为nil
+	reverseDNS *reverseDNSCache
+}
+
+// newHostnameTracker 创建按服务器名称的流量统计
+func newHostnameTracker(top int, reverseDNS *reverseDNSCache) *hostnameTracker {
+	return &hostnameTracker{top: top, names: make(map[flowKey]*namedFlow), reverseDNS: reverseDNS}
+}
+
+// Take 汇总各网卡自上次上报以来的连接流量，返回流量最大的服务器名称
+// 无法识别名称的流量合并为空名称并始终上报
+func (t *hostnameTracker) Take(monitors []*BandwidthMonitor) []HostnameTraffic {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	flows := make(map[flowKey]*directionBytes)
+	learned := make(map[flowKey]flowName)
+	for _, bm := range monitors {
+		for _, w := range bm.packetWorkers() {
+			w.hostnames.drainInto(flows, learned)
+		}
+	}
+	for key, name := range learned {
+		if named, ok := t.names[key]; ok {
+			named.flowName = name
+		} else if len(t.names) < maxNamedFlows {
+			t.names[key] = &namedFlow{flowName: name, lastSeen: now}
+		}
+	}
+
+	byName := make(map[string]*HostnameTraffic)
+	for key, counter := range flows {
+		var name flowName
+		if named, ok := t.names[key]; ok {
+			named.lastSeen = now
+			name = named.flowName
+		} else {
+			name = t.reverseName(key)
+		}
+		traffic, ok := byName[name.name]
+		if !ok {
+			traffic = &HostnameTraffic{Hostname: name.name, Source: name.source}
+			byName[name.name] = traffic
+		}
+		traffic.Flows++
+		traffic.UploadBytes += counter[DirectionUpload]
+		traffic.DownloadBytes += counter[DirectionDownload]
+		traffic.InternalBytes += counter[DirectionInternal]
+	}
+	for key, named := range t.names {
+		if now.Sub(named.lastSeen) > namedFlowIdleTimeout {
+			delete(t.names, key)
+		}
+	}
+	if len(byName) == 0 {
+		return nil
+	}
+
+	var result []HostnameTraffic
+	if unknown, ok := byName[""]; ok {
+		result = append(result, *unknown)
+		delete(byName, "")
+	}
+	hostnames := make([]*HostnameTraffic, 0, len(byName))
+	for _, traffic := range byName {
+		hostnames = append(hostnames, traffic)
+	}
+	sort.Slice(hostnames, func(i, j int) bool {
+		return hostnames[i].total() > hostnames[j].total()
+	})
+	if len(hostnames) > t.top {
+		hostnames = hostnames[:t.top]
+	}
+	for _, traffic := range hostnames {
+		result = append(result, *traffic)
+	}
+	return result
+}
+
+// reverseName 从反向解析缓存获取连接一端地址的名称，优先使用公网地址，本机地址通常没有名称
+func (t *hostnameTracker) reverseName(key flowKey) flowName {
+	addrs := []netip.Addr{key.high.Addr(), key.low.Addr()}
+	if !isGlobalAddr(addrs[0]) {
+		addrs[0], addrs[1] = addrs[1], addrs[0]
+	}
+	for _, addr := range addrs {
+		if name, source := t.reverseDNS.Lookup(addr); name != "" {
+			return flowName{name: name, source: source}
+		}
+	}
+	return flowName{}
+}
@@ -0,0 +1,126 @@
+package bandwidthmonitor
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"network-monitor-client/devicemonitor"
+)
+
+// LinkChange 链路状态、速率或双工模式的变化
+type LinkChange struct {
+	Time      time.Time `json:"time"`
+	OperState string    `json:"oper_state"`
+	Speed     int       `json:"speed"`
+	Duplex    string    `json:"duplex"`
+}
+
+// InterfaceHealthStats 单个网卡自上次上报以来的错误、丢弃和冲突计数及当前链路状态
+// 计数来自网卡的内核计数器，与抓包和采样无关
+type InterfaceHealthStats struct {
+	Interface string `json:"interface"`
+	// 统计时长（秒），用于计算每秒错误数
+	Interval        float64 `json:"interval"`
+	RxErrors        uint64  `json:"rx_errors"`
+	TxErrors        uint64  `json:"tx_errors"`
+	RxDropped       uint64  `json:"rx_dropped"`
+	TxDropped       uint64  `json:"tx_dropped"`
+	RxFifoErrors    uint64  `json:"rx_fifo_errors"`
+	RxFrameErrors   uint64  `json:"rx_frame_errors"`
+	TxFifoErrors    uint64  `json:"tx_fifo_errors"`
+	TxCarrierErrors uint64  `json:"tx_carrier_errors"`
+	Collisions      uint64  `json:"collisions"`
+	// 当前链路状态，速率单位为Mbps，无法获取时为空
+	OperState string `json:"oper_state,omitempty"`
+	Speed     int    `json:"speed,omitempty"`
+	Duplex    string `json:"duplex,omitempty"`
+	// 载波状态变化次数，包括两次上报之间断开又恢复的链路抖动
+	CarrierChanges uint64 `json:"carrier_changes"`
+	// 自上次上报以来观察到的链路状态变化
+	LinkChanges []LinkChange `json:"link_changes,omitempty"`
+}
+
+// healthTracker 记录上次读取的网卡计数器和链路状态，用于计算两次上报之间的增量
+type healthTracker struct {
+	mutex    sync.Mutex
+	device   string
+	last     *devicemonitor.InterfaceCounters
+	lastTime time.Time
+	link     *devicemonitor.LinkState
+	// 上次读取是否失败，只在状态变化时输出日志
+	failing bool
+}
+
+// take 读取网卡计数器和链路状态，计算与上次读取之间的增量
+// 首次读取、切换网卡或读取失败后只建立基准并返回nil
+func (t *healthTracker) take(deviceMonitor *devicemonitor.DeviceMonitor) *InterfaceHealthStats {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	device := deviceMonitor.Name()
+	counters, err := deviceMonitor.ReadCounters()
+	if err != nil {
+		if !t.failing {
+			log.Printf("读取网卡 %s 的错误计数失败: %v", device, err)
+			t.failing = true
+		}
+		t.last = nil
+		return nil
+	}
+	t.failing = false
+	// 不支持sysfs的平台没有链路状态，只上报/proc/net/dev中的计数
+	link, err := deviceMonitor.ReadLinkState()
+	if err != nil {
+		link = nil
+	}
+
+	now := time.Now()
+	last, lastLink := t.last, t.link
+	if t.device != device {
+		last, lastLink = nil, nil
+	}
+	interval := now.Sub(t.lastTime).Seconds()
+	t.device, t.last, t.link, t.lastTime = device, counters, link, now
+	if last == nil {
+		return nil
+	}
+
+	stats := &InterfaceHealthStats{
+		Interface:       device,
+		Interval:        interval,
+		RxErrors:        kernelCounterDelta(counters.RxErrors, last.RxErrors),
+		TxErrors:        kernelCounterDelta(counters.TxErrors, last.TxErrors),
+		RxDropped:       kernelCounterDelta(counters.RxDropped, last.RxDropped),
+		TxDropped:       kernelCounterDelta(counters.TxDropped, last.TxDropped),
+		RxFifoErrors:    kernelCounterDelta(counters.RxFifoErrors, last.RxFifoErrors),
+		RxFrameErrors:   kernelCounterDelta(counters.RxFrameErrors, last.RxFrameErrors),
+		TxFifoErrors:    kernelCounterDelta(counters.TxFifoErrors, last.TxFifoErrors),
+		TxCarrierErrors: kernelCounterDelta(counters.TxCarrierErrors, last.TxCarrierErrors),
+		Collisions:      kernelCounterDelta(counters.Collisions, last.Collisions),
+	}
+	if link == nil {
+		return stats
+	}
+	stats.OperState, stats.Speed, stats.Duplex = link.OperState, link.Speed, link.Duplex
+	if lastLink == nil {
+		return stats
+	}
+	stats.CarrierChanges = kernelCounterDelta(link.CarrierChanges, lastLink.CarrierChanges)
+	if link.OperState != lastLink.OperState || link.Speed != lastLink.Speed || link.Duplex != lastLink.Duplex {
+		log.Printf("网卡 %s 链路状态变化: %s %dMbps %s -> %s %dMbps %s", device,
+			lastLink.OperState, lastLink.Speed, lastLink.Duplex, link.OperState, link.Speed, link.Duplex)
+		stats.LinkChanges = append(stats.LinkChanges, LinkChange{
+			Time:      now,
+			OperState: link.OperState,
+			Speed:     link.Speed,
+			Duplex:    link.Duplex,
+		})
+	}
+	return stats
+}
+
+// TakeInterfaceHealth 获取自上次上报以来网卡的错误、丢弃和冲突计数及链路状态，首次调用时返回nil
+func (bm *BandwidthMonitor) TakeInterfaceHealth() *InterfaceHealthStats {
+	return bm.health.take(bm.deviceMonitor)
+}
@@ -0,0 +1,263 @@
+package bandwidthmonitor
+
+import (
+	"log"
+	"net"
+	"net/netip"
+	"sort"
+	"sync"
+
+	"network-monitor-client/processmonitor"
+)
+
+// 单个处理协程每个上报周期统计的最大连接数量，超出后新出现的连接不再单独统计
+const maxProcessFlows = 65536
+
+// ProcessTraffic 单个进程自上次上报以来的流量（字节），采样时为按采样率放大的估算值
+type ProcessTraffic struct {
+	// 进程号，0表示无法归属到本机进程的流量（转发流量、已关闭的连接或没有权限读取的进程）
+	PID           int    `json:"pid"`
+	Comm          string `json:"comm,omitempty"`
+	Cmdline       string `json:"cmdline,omitempty"`
+	User          string `json:"user,omitempty"`
+	UploadBytes   uint64 `json:"upload_bytes"`
+	DownloadBytes uint64 `json:"download_bytes"`
+	// 内网流量按发送方归属
+	InternalBytes uint64 `json:"internal_bytes"`
+	// 进程所在的cgroup、容器和网络命名空间（inode）
+	Cgroup           string `json:"cgroup,omitempty"`
+	ContainerID      string `json:"container_id,omitempty"`
+	ContainerName    string `json:"container_name,omitempty"`
+	ContainerRuntime string `json:"container_runtime,omitempty"`
+	NetNS            uint64 `json:"netns,omitempty"`
+}
+
+// ContainerTraffic 单个容器（不在容器内的进程按cgroup）在同一网络命名空间内的流量（字节）
+type ContainerTraffic struct {
+	// 容器ID，不在容器内时为空，按cgroup区分（如systemd服务）
+	ContainerID      string `json:"container_id,omitempty"`
+	ContainerName    string `json:"container_name,omitempty"`
+	ContainerRuntime string `json:"container_runtime,omitempty"`
+	Cgroup           string `json:"cgroup"`
+	NetNS            uint64 `json:"netns"`
+	// 产生流量的进程数量
+	Processes     int    `json:"processes"`
+	UploadBytes   uint64 `json:"upload_bytes"`
+	DownloadBytes uint64 `json:"download_bytes"`
+	InternalBytes uint64 `json:"internal_bytes"`
+}
+
+// trafficGroup 按容器或cgroup及网络命名空间分组
+type trafficGroup struct {
+	key   string
+	netns uint64
+}
+
+// total 各方向字节数之和
+func (p *ProcessTraffic) total() uint64 {
+	return p.UploadBytes + p.DownloadBytes + p.InternalBytes
+}
+
+// setProcess 填充进程及所属容器的信息
+func (p *ProcessTraffic) setProcess(process *processmonitor.Process) {
+	p.Comm, p.Cmdline, p.User = process.Comm, process.Cmdline, process.User
+	p.Cgroup, p.NetNS = process.Cgroup, process.NetNS
+	if container := process.Container; container != nil {
+		p.ContainerID, p.ContainerName, p.ContainerRuntime = container.ID, container.Name, container.Runtime
+	}
+}
+
+// processCounters 单个处理协程按连接累计的字节数，只在汇总时与处理协程竞争锁
+type processCounters struct {
+	mutex sync.Mutex
+	flows map[processmonitor.Flow]*directionBytes
+}
+
+// newProcessCounters 创建按连接的字节计数
+func newProcessCounters() *processCounters {
+	return &processCounters{flows: make(map[processmonitor.Flow]*directionBytes)}
+}
+
+// Update 按本机一侧的五元组累计TCP和UDP数据包的字节数，内网流量无法确定本机一侧，先按发送方记录
+func (c *processCounters) Update(pl *packetLayers, size uint64, direction Direction) {
+	protocol, src, dst, ok := flowEndpoints(pl)
+	if !ok {
+		return
+	}
+	flow := processmonitor.Flow{Protocol: protocol, Local: src, Remote: dst}
+	if direction == DirectionDownload {
+		flow.Local, flow.Remote = dst, src
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	counter, ok := c.flows[flow]
+	if !ok {
+		if len(c.flows) >= maxProcessFlows {
+			return
+		}
+		counter = &directionBytes{}
+		c.flows[flow] = counter
+	}
+	counter[direction] += size
+}
+
+// addrFromIP 将net.IP转换为netip.Addr，IPv4映射地址按IPv4处理
+func addrFromIP(ip net.IP) netip.Addr {
+	addr, _ := netip.AddrFromSlice(ip)
+	return addr.Unmap()
+}
+
+// drainInto 将计数累加到汇总结果并重置
+func (c *processCounters) drainInto(flows map[processmonitor.Flow]*directionBytes) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for flow, counter := range c.flows {
+		total, ok := flows[flow]
+		if !ok {
+			total = &directionBytes{}
+			flows[flow] = total
+		}
+		total.add(counter)
+	}
+	clear(c.flows)
+}
+
+// processTracker 将各网卡统计的连接归属到本机进程，按流量排序后上报
+type processTracker struct {
+	mutex    sync.Mutex
+	resolver *processmonitor.Resolver
+	top      int
+	// 上次读取socket表是否失败，只在状态变化时输出日志
+	failing bool
+}
+
+// newProcessTracker 创建按进程的流量统计
+func newProcessTracker(top int) *processTracker {
+	return &processTracker{resolver: processmonitor.NewResolver(), top: top}
+}
+
+// reversed 交换连接的本地和远端地址
+func reversed(flow processmonitor.Flow) processmonitor.Flow {
+	return processmonitor.Flow{Protocol: flow.Protocol, Local: flow.Remote, Remote: flow.Local}
+}
+
+// Take 汇总各网卡自上次上报以来的连接流量，返回流量最大的进程和容器
+// 无法归属的流量合并为进程号0，不计入容器
+func (t *processTracker) Take(monitors []*BandwidthMonitor) ([]ProcessTraffic, []ContainerTraffic) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	flows := make(map[processmonitor.Flow]*directionBytes)
+	for _, bm := range monitors {
+		for _, w := range bm.packetWorkers() {
+			w.processes.drainInto(flows)
+		}
+	}
+	if len(flows) == 0 {
+		return nil, nil
+	}
+
+	// 内网流量的发送方不是本机进程时（如宿主机网桥上容器收到的流量），按接收方归属
+	keys := make([]processmonitor.Flow, 0, len(flows))
+	for flow, counter := range flows {
+		keys = append(keys, flow)
+		if counter[DirectionInternal] > 0 {
+			keys = append(keys, reversed(flow))
+		}
+	}
+	pids, err := t.resolver.Resolve(keys)
+	if err != nil {
+		if !t.failing {
+			log.Printf("读取socket表失败，流量无法归属到进程: %v", err)
+			t.failing = true
+		}
+	} else {
+		t.failing = false
+	}
+
+	byPID := make(map[int]*ProcessTraffic)
+	for flow, counter := range flows {
+		pid, ok := pids[flow]
+		if !ok && counter[DirectionInternal] > 0 {
+			pid = pids[reversed(flow)]
+		}
+		traffic, ok := byPID[pid]
+		if !ok {
+			traffic = &ProcessTraffic{PID: pid}
+			byPID[pid] = traffic
+		}
+		traffic.UploadBytes += counter[DirectionUpload]
+		traffic.DownloadBytes += counter[DirectionDownload]
+		traffic.InternalBytes += counter[DirectionInternal]
+	}
+
+	// 无法归属的流量始终上报，其余进程读取信息后按容器分组
+	var result []ProcessTraffic
+	if unknown, ok := byPID[0]; ok {
+		result = append(result, *unknown)
+		delete(byPID, 0)
+	}
+	processes := make([]*ProcessTraffic, 0, len(byPID))
+	groups := make(map[trafficGroup]*ContainerTraffic)
+	for _, traffic := range byPID {
+		// 进程在上报前已退出时只上报进程号，不计入容器
+		if process, err := t.resolver.Process(traffic.PID); err == nil {
+			traffic.setProcess(process)
+			addToGroup(groups, traffic)
+		}
+		processes = append(processes, traffic)
+	}
+
+	sort.Slice(processes, func(i, j int) bool {
+		return processes[i].total() > processes[j].total()
+	})
+	if len(processes) > t.top {
+		processes = processes[:t.top]
+	}
+	for _, traffic := range processes {
+		result = append(result, *traffic)
+	}
+	return result, topContainers(groups, t.top)
+}
+
+// addToGroup 将进程的流量计入所属容器或cgroup
+func addToGroup(groups map[trafficGroup]*ContainerTraffic, traffic *ProcessTraffic) {
+	key := trafficGroup{key: traffic.ContainerID, netns: traffic.NetNS}
+	if key.key == "" {
+		key.key = "cgroup:" + traffic.Cgroup
+	}
+	group, ok := groups[key]
+	if !ok {
+		group = &ContainerTraffic{
+			ContainerID:      traffic.ContainerID,
+			ContainerName:    traffic.ContainerName,
+			ContainerRuntime: traffic.ContainerRuntime,
+			Cgroup:           traffic.Cgroup,
+			NetNS:            traffic.NetNS,
+		}
+		groups[key] = group
+	}
+	group.Processes++
+	group.UploadBytes += traffic.UploadBytes
+	group.DownloadBytes += traffic.DownloadBytes
+	group.InternalBytes += traffic.InternalBytes
+}
+
+// topContainers 按流量取前top个容器或cgroup
+func topContainers(groups map[trafficGroup]*ContainerTraffic, top int) []ContainerTraffic {
+	containers := make([]ContainerTraffic, 0, len(groups))
+	for _, group := range groups {
+		containers = append(containers, *group)
+	}
+	sort.Slice(containers, func(i, j int) bool {
+		a, b := &containers[i], &containers[j]
+		return a.UploadBytes+a.DownloadBytes+a.InternalBytes > b.UploadBytes+b.DownloadBytes+b.InternalBytes
+	})
+	if len(containers) > top {
+		containers = containers[:top]
+	}
+	return containers
+}
@@ -0,0 +1,301 @@
+package bandwidthmonitor
+
+import (
+	"log"
+	"net/netip"
+	"sort"
+	"strconv"
+	"sync"
+
+	"network-monitor-client/config"
+	"network-monitor-client/geoip"
+)
+
+// 单个处理协程每个上报周期统计的最大远端地址数量，超出后新出现的地址不再单独统计
+const maxRemoteAddrs = 65536
+
+// 远端流量的汇总方式
+const (
+	remoteGroupASN     = "asn"
+	remoteGroupCountry = "country"
+	remoteGroupLabel   = "label"
+)
+
+// RemoteTraffic 单个远端网段自上次上报以来的流量（字节），采样时为按采样率放大的估算值
+type RemoteTraffic struct {
+	// 远端地址按配置的前缀长度聚合的网段
+	Prefix       string `json:"prefix"`
+	ASN          uint32 `json:"asn,omitempty"`
+	Organization string `json:"organization,omitempty"`
+	Country      string `json:"country,omitempty"`
+	// 地址数据库中的自定义分类
+	Label         string `json:"label,omitempty"`
+	UploadBytes   uint64 `json:"upload_bytes"`
+	DownloadBytes uint64 `json:"download_bytes"`
+}
+
+// RemotePeer 单个远端地址自上次上报以来的流量（字节）
+type RemotePeer struct {
+	Address string `json:"address"`
+	// 从DNS应答或PTR查询得到的名称，开启反向解析时上报
+	Name string `json:"name,omitempty"`
+	// 名称来源：dns（DNS应答中的查询名称）、ptr（PTR记录）
+	NameSource    string `json:"name_source,omitempty"`
+	ASN           uint32 `json:"asn,omitempty"`
+	Organization  string `json:"organization,omitempty"`
+	Country       string `json:"country,omitempty"`
+	Label         string `json:"label,omitempty"`
+	UploadBytes   uint64 `json:"upload_bytes"`
+	DownloadBytes uint64 `json:"download_bytes"`
+}
+
+// RemoteGroupTraffic 按ASN、国家或自定义分类汇总的远端流量（字节）
+type RemoteGroupTraffic struct {
+	// 汇总方式：asn、country、label
+	Kind string `json:"kind"`
+	// ASN号、国家代码或分类名称，地址数据库中没有的远端地址汇总为空（ASN为0）
+	Key string `json:"key"`
+	// ASN所属的组织
+	Name string `json:"name,omitempty"`
+	// 产生流量的远端网段数量
+	Prefixes      int    `json:"prefixes"`
+	UploadBytes   uint64 `json:"upload_bytes"`
+	DownloadBytes uint64 `json:"download_bytes"`
+}
+
+// RemoteStats 自上次上报以来流量最大的远端网段、远端地址及按ASN、国家、分类汇总的流量
+type RemoteStats struct {
+	Prefixes []RemoteTraffic      `json:"prefixes"`
+	Peers    []RemotePeer         `json:"peers,omitempty"`
+	Groups   []RemoteGroupTraffic `json:"groups,omitempty"`
+}
+
+// remotePrefixes 远端地址聚合的前缀长度
+type remotePrefixes struct {
+	ipv4, ipv6 int
+}
+
+// of 获取地址所在的网段
+func (p *remotePrefixes) of(addr netip.Addr) netip.Prefix {
+	bits := p.ipv6
+	if addr.Is4() {
+		bits = p.ipv4
+	}
+	prefix, _ := addr.Prefix(bits)
+	return prefix
+}
+
+// remoteCounters 单个处理协程按远端地址累计的字节数，只在汇总时与处理协程竞争锁
+type remoteCounters struct {
+	mutex sync.Mutex
+	addrs map[netip.Addr]*directionBytes
+}
+
+// newRemoteCounters 创建按远端地址的字节计数
+func newRemoteCounters() *remoteCounters {
+	return &remoteCounters{addrs: make(map[netip.Addr]*directionBytes)}
+}
+
+// Update 按远端地址累计上下行字节数，内网流量没有远端，不统计
+func (c *remoteCounters) Update(pl *packetLayers, size uint64, direction Direction) {
+	if direction == DirectionInternal || pl.srcIP == nil || pl.dstIP == nil {
+		return
+	}
+	remote := pl.srcIP
+	if direction == DirectionUpload {
+		remote = pl.dstIP
+	}
+	addr := addrFromIP(remote)
+	if !addr.IsValid() {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	counter, ok := c.addrs[addr]
+	if !ok {
+		if len(c.addrs) >= maxRemoteAddrs {
+			return
+		}
+		counter = &directionBytes{}
+		c.addrs[addr] = counter
+	}
+	counter[direction] += size
+}
+
+// drainInto 将计数累加到汇总结果并重置
+func (c *remoteCounters) drainInto(addrs map[netip.Addr]*directionBytes) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for addr, counter := range c.addrs {
+		total, ok := addrs[addr]
+		if !ok {
+			total = &directionBytes{}
+			addrs[addr] = total
+		}
+		total.add(counter)
+	}
+	clear(c.addrs)
+}
+
+// remoteTracker 汇总各网卡的远端流量，按本地地址数据库查询ASN、国家和分类
+type remoteTracker struct {
+	mutex    sync.Mutex
+	prefixes remotePrefixes
+	// 地址数据库，未配置或加载失败时为nil，只按网段统计
+	database *geoip.Database
+	// 远端地址的名称，未开启反向解析时为nil
+	names *reverseDNSCache
+	top   int
+}
+
+// newRemoteTracker 创建按远端网段的流量统计，数据库加载失败时只按网段统计
+func newRemoteTracker(remotes config.RemoteConfig, names *reverseDNSCache) *remoteTracker {
+	t := &remoteTracker{
+		prefixes: remotePrefixes{ipv4: remotes.IPv4Prefix, ipv6: remotes.IPv6Prefix},
+		names:    names,
+		top:      remotes.Top,
+	}
+	if len(remotes.Databases) > 0 {
+		database, err := geoip.Open(remotes.Databases)
+		if err != nil {
+			log.Printf("%v，只按远端网段统计", err)
+		} else {
+			t.database = database
+		}
+	}
+	return t
+}
+
+// Take 汇总各网卡自上次上报以来的远端流量，返回流量最大的网段、远端地址及按ASN、国家、分类汇总的结果
+// ASN只上报流量最大的top个，国家和分类全部上报
+func (t *remoteTracker) Take(monitors []*BandwidthMonitor) *RemoteStats {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	addrs := make(map[netip.Addr]*directionBytes)
+	for _, bm := range monitors {
+		for _, w := range bm.packetWorkers() {
+			w.remotes.drainInto(addrs)
+		}
+	}
+	if len(addrs) == 0 {
+		return nil
+	}
+
+	// 按ASN、国家、分类汇总时逐个查询远端地址，网段可能跨越数据库中的多个网段
+	groups := make(map[[2]string]*RemoteGroupTraffic)
+	groupPrefixes := make(map[[2]string]map[netip.Prefix]struct{})
+	addGroup := func(kind, key, name string, prefix netip.Prefix, counter *directionBytes) {
+		id := [2]string{kind, key}
+		group, ok := groups[id]
+		if !ok {
+			group = &RemoteGroupTraffic{Kind: kind, Key: key, Name: name}
+			groups[id] = group
+			groupPrefixes[id] = make(map[netip.Prefix]struct{})
+		}
+		if _, ok := groupPrefixes[id][prefix]; !ok {
+			groupPrefixes[id][prefix] = struct{}{}
+			group.Prefixes++
+		}
+		group.UploadBytes += counter[DirectionUpload]
+		group.DownloadBytes += counter[DirectionDownload]
+	}
+
+	counters := make(map[netip.Prefix]*directionBytes)
+	peers := make([]RemotePeer, 0, len(addrs))
+	for addr, counter := range addrs {
+		prefix := t.prefixes.of(addr)
+		total, ok := counters[prefix]
+		if !ok {
+			total = &directionBytes{}
+			counters[prefix] = total
+		}
+		total.add(counter)
+		peers = append(peers, RemotePeer{
+			Address:       addr.String(),
+			UploadBytes:   counter[DirectionUpload],
+			DownloadBytes: counter[DirectionDownload],
+		})
+		if t.database != nil {
+			info := t.database.Lookup(addr)
+			addGroup(remoteGroupASN, strconv.FormatUint(uint64(info.ASN), 10), info.Organization, prefix, counter)
+			addGroup(remoteGroupCountry, info.Country, "", prefix, counter)
+			addGroup(remoteGroupLabel, info.Label, "", prefix, counter)
+		}
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].UploadBytes+peers[i].DownloadBytes > peers[j].UploadBytes+peers[j].DownloadBytes
+	})
+	if len(peers) > t.top {
+		peers = peers[:t.top]
+	}
+	for i := range peers {
+		peer := &peers[i]
+		addr := netip.MustParseAddr(peer.Address)
+		peer.Name, peer.NameSource = t.names.Lookup(addr)
+		if t.database != nil {
+			info := t.database.Lookup(addr)
+			peer.ASN, peer.Organization = info.ASN, info.Organization
+			peer.Country, peer.Label = info.Country, info.Label
+		}
+	}
+
+	stats := &RemoteStats{Peers: peers}
+	prefixes := make([]RemoteTraffic, 0, len(counters))
+	for prefix, counter := range counters {
+		remote := RemoteTraffic{
+			Prefix:        prefix.String(),
+			UploadBytes:   counter[DirectionUpload],
+			DownloadBytes: counter[DirectionDownload],
+		}
+		if t.database != nil {
+			// 网段只按网络地址查询，前缀长度小于数据库中的网段时只作为参考，汇总使用各地址的查询结果
+			info := t.database.Lookup(prefix.Addr())
+			remote.ASN, remote.Organization = info.ASN, info.Organization
+			remote.Country, remote.Label = info.Country, info.Label
+		}
+		prefixes = append(prefixes, remote)
+	}
+	stats.Prefixes = topRemotes(prefixes, t.top)
+
+	var asns []RemoteGroupTraffic
+	for _, group := range groups {
+		if group.Kind == remoteGroupASN {
+			asns = append(asns, *group)
+		} else {
+			stats.Groups = append(stats.Groups, *group)
+		}
+	}
+	sortGroups(stats.Groups)
+	sortGroups(asns)
+	if len(asns) > t.top {
+		asns = asns[:t.top]
+	}
+	stats.Groups = append(stats.Groups, asns...)
+	return stats
+}
+
+// sortGroups 按汇总方式和流量从大到小排序
+func sortGroups(groups []RemoteGroupTraffic) {
+	sort.Slice(groups, func(i, j int) bool {
+		a, b := &groups[i], &groups[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.UploadBytes+a.DownloadBytes > b.UploadBytes+b.DownloadBytes
+	})
+}
+
+// topRemotes 按流量取前top个远端网段
+func topRemotes(prefixes []RemoteTraffic, top int) []RemoteTraffic {
+	sort.Slice(prefixes, func(i, j int) bool {
+		return prefixes[i].UploadBytes+prefixes[i].DownloadBytes > prefixes[j].UploadBytes+prefixes[j].DownloadBytes
+	})
+	if len(prefixes) > top {
+		prefixes = prefixes[:top]
+	}
+	return prefixes
+}
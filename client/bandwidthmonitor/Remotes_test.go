@@ -0,0 +1,80 @@
+package bandwidthmonitor
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"network-monitor-client/config"
+)
+
+// testGeoIPCSV 同一个/8网段中属于不同ASN、国家和分类的地址段
+const testGeoIPCSV = `network,asn,organization,country,label
+10.1.0.0/16,64500,Provider A,CN,cdn
+10.2.0.0/16,64501,Provider B,US,cloud
+`
+
+func TestRemoteTrackerGroupsByAddress(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "geoip.csv")
+	if err := os.WriteFile(path, []byte(testGeoIPCSV), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tracker := newRemoteTracker(config.RemoteConfig{IPv4Prefix: 8, IPv6Prefix: 32, Top: 10, Databases: []string{path}}, nil)
+	if tracker.database == nil {
+		t.Fatal("加载地址数据库失败")
+	}
+
+	bm := newBandwidthMonitor("", 0)
+	remotes := bm.worker(0).remotes
+	local := net.ParseIP("192.168.1.10")
+	for _, packet := range []struct {
+		remote string
+		size   uint64
+	}{
+		{"10.1.0.1", 100},
+		{"10.1.0.2", 200},
+		{"10.2.0.1", 1000},
+		{"10.3.0.1", 10},
+	} {
+		remotes.Update(&packetLayers{srcIP: local, dstIP: net.ParseIP(packet.remote)}, packet.size, DirectionUpload)
+	}
+
+	stats := tracker.Take([]*BandwidthMonitor{bm})
+	if stats == nil || len(stats.Prefixes) != 1 || stats.Prefixes[0].Prefix != "10.0.0.0/8" {
+		t.Fatalf("远端网段 = %+v，期望只有 10.0.0.0/8", stats)
+	}
+	if stats.Prefixes[0].UploadBytes != 1310 {
+		t.Errorf("网段上行字节数 = %d，期望 1310", stats.Prefixes[0].UploadBytes)
+	}
+
+	// 汇总按各远端地址的查询结果，而不是网段的网络地址
+	want := map[[2]string]uint64{
+		{remoteGroupASN, "64500"}:   300,
+		{remoteGroupASN, "64501"}:   1000,
+		{remoteGroupASN, "0"}:       10,
+		{remoteGroupCountry, "CN"}:  300,
+		{remoteGroupCountry, "US"}:  1000,
+		{remoteGroupCountry, ""}:    10,
+		{remoteGroupLabel, "cdn"}:   300,
+		{remoteGroupLabel, "cloud"}: 1000,
+		{remoteGroupLabel, ""}:      10,
+	}
+	if len(stats.Groups) != len(want) {
+		t.Fatalf("汇总结果 = %+v，期望 %d 项", stats.Groups, len(want))
+	}
+	for _, group := range stats.Groups {
+		bytes, ok := want[[2]string{group.Kind, group.Key}]
+		if !ok || group.UploadBytes != bytes {
+			t.Errorf("%s %q 上行字节数 = %d，期望 %d", group.Kind, group.Key, group.UploadBytes, bytes)
+		}
+		if group.Prefixes != 1 {
+			t.Errorf("%s %q 网段数量 = %d，期望 1", group.Kind, group.Key, group.Prefixes)
+		}
+	}
+	for _, group := range stats.Groups {
+		if group.Kind == remoteGroupASN && group.Key == "64501" && group.Name != "Provider B" {
+			t.Errorf("ASN 64501 组织 = %q，期望 Provider B", group.Name)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package bandwidthmonitor
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// ReplayOptions 回放pcap文件的参数
+type ReplayOptions struct {
+	// 并行处理的协程数量
+	Workers int
+	// 重复处理文件中数据包的次数，文件较小时增加次数使结果更稳定
+	Loops int
+	// 同时使用完整解码（gopacket.NewPacket）处理一遍作为对照
+	Baseline bool
+}
+
+// ReplayBenchmark 一种处理方式的耗时和内存分配
+type ReplayBenchmark struct {
+	// 处理耗时（不含读取文件）
+	Duration time.Duration
+	// 处理能力（包/秒、字节/秒）
+	PacketsPerSecond float64
+	BytesPerSecond   float64
+	// 每个数据包的平均耗时（纳秒）
+	NsPerPacket float64
+	// 每个数据包的平均内存分配次数和字节数
+	AllocsPerPacket     float64
+	AllocBytesPerPacket float64
+}
+
+// ReplayResult 回放pcap文件的处理结果
+type ReplayResult struct {
+	// 处理的数据包数量和字节数（所有轮次合计）
+	Packets uint64
+	Bytes   uint64
+	Loops   int
+	// 与实时抓包相同的统计流程
+	ReplayBenchmark
+	// 完整解码的对照结果，未开启时为nil
+	Baseline *ReplayBenchmark
+	// 回放后的带宽统计
+	Upload   uint64
+	Download uint64
+	Internal uint64
+}
+
+// replayPacket 预先读入内存的数据包
+type replayPacket struct {
+	data []byte
+	ci   gopacket.CaptureInfo
+}
+
+// Replay 将pcap或pcapng文件中的数据包交给与实时抓包相同的统计流程处理，用于衡量处理能力
+// 数据包预先读入内存，Workers个协程并行处理，与AF_PACKET fanout的处理方式一致，按配置的采样方式采样
+func Replay(path string, options ReplayOptions) (*ReplayResult, error) {
+	if options.Workers <= 0 {
+		options.Workers = 1
+	}
+	if options.Loops <= 0 {
+		options.Loops = 1
+	}
+	packets, linkType, err := readReplayFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	bm := newBandwidthMonitor("", 0)
+	result := &ReplayResult{Packets: uint64(len(packets)) * uint64(options.Loops), Loops: options.Loops}
+	for _, p := range packets {
+		result.Bytes += uint64(p.ci.Length)
+	}
+	result.Bytes *= uint64(options.Loops)
+
+	workers := make([]*packetWorker, options.Workers)
+	for i := range workers {
+		workers[i] = bm.worker(i)
+	}
+	result.ReplayBenchmark = measureReplay(result.Packets, result.Bytes, func() {
+		replayParallel(packets, options, func(w int, p *replayPacket) {
+			bm.processPacket(workers[w], p.data, p.ci, linkType)
+		})
+	})
+	if options.Baseline {
+		baseline := measureReplay(result.Packets, result.Bytes, func() {
+			replayParallel(packets, options, func(w int, p *replayPacket) {
+				fullDecode(p, linkType)
+			})
+		})
+		result.Baseline = &baseline
+	}
+
+	totals := bm.drainCounters()
+	result.Upload = totals.bytes[DirectionUpload]
+	result.Download = totals.bytes[DirectionDownload]
+	result.Internal = totals.bytes[DirectionInternal]
+	return result, nil
+}
+
+// replayParallel 由多个协程按顺序轮流处理数据包，同一流的数据包可能由不同协程处理，仅用于衡量处理能力
+func replayParallel(packets []replayPacket, options ReplayOptions, process func(w int, p *replayPacket)) {
+	var wg sync.WaitGroup
+	for w := 0; w < options.Workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for loop := 0; loop < options.Loops; loop++ {
+				for i := w; i < len(packets); i += options.Workers {
+					process(w, &packets[i])
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+}
+
+// measureReplay 统计一次回放的耗时和内存分配
+func measureReplay(packets, bytes uint64, run func()) ReplayBenchmark {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	run()
+	duration := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	b := ReplayBenchmark{Duration: duration}
+	if seconds := duration.Seconds(); seconds > 0 {
+		b.PacketsPerSecond = float64(packets) / seconds
+		b.BytesPerSecond = float64(bytes) / seconds
+	}
+	if packets > 0 {
+		b.NsPerPacket = float64(duration.Nanoseconds()) / float64(packets)
+		b.AllocsPerPacket = float64(after.Mallocs-before.Mallocs) / float64(packets)
+		b.AllocBytesPerPacket = float64(after.TotalAlloc-before.TotalAlloc) / float64(packets)
+	}
+	return b
+}
+
+// fullDecode 对照用的完整解码：构造gopacket.Packet解码所有层，并为每个数据包格式化五元组字符串
+func fullDecode(p *replayPacket, linkType layers.LinkType) {
+	packet := gopacket.NewPacket(p.data, linkType, gopacket.DecodeOptions{NoCopy: true})
+	network, transport := packet.NetworkLayer(), packet.TransportLayer()
+	if network == nil || transport == nil {
+		return
+	}
+	_ = fmt.Sprintf("%s-%s", network.NetworkFlow(), transport.TransportFlow())
+}
+
+// readReplayFile 读取pcap或pcapng文件中的全部数据包
+func readReplayFile(path string) ([]replayPacket, layers.LinkType, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("打开回放文件失败: %v", err)
+	}
+	defer file.Close()
+
+	var source interface {
+		ReadPacketData() ([]byte, gopacket.CaptureInfo, error)
+	}
+	var linkType layers.LinkType
+	if reader, err := pcapgo.NewReader(file); err == nil {
+		source, linkType = reader, reader.LinkType()
+	} else {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, 0, err
+		}
+		reader, err := pcapgo.NewNgReader(file, pcapgo.DefaultNgReaderOptions)
+		if err != nil {
+			return nil, 0, fmt.Errorf("回放文件不是pcap或pcapng格式: %v", err)
+		}
+		source, linkType = reader, reader.LinkType()
+	}
+
+	var packets []replayPacket
+	for {
+		data, ci, err := source.ReadPacketData()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("读取回放文件失败: %v", err)
+		}
+		packets = append(packets, replayPacket{data: data, ci: ci})
+	}
+	return packets, linkType, nil
+}
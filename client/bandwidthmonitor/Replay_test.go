@@ -0,0 +1,105 @@
+package bandwidthmonitor
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// 基准测试回放的pcap文件：IPv4、IPv6 TCP连接（握手、HTTP请求、数据、FIN），UDP DNS查询和应答，部分带802.1Q标签
+const replayFixture = "testdata/replay.pcap"
+
+// loadReplayFixture 读取基准测试的pcap文件，返回数据包及平均包长
+func loadReplayFixture(b *testing.B) ([]replayPacket, layers.LinkType, int64) {
+	b.Helper()
+	packets, linkType, err := readReplayFile(replayFixture)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if len(packets) == 0 {
+		b.Fatalf("%s 中没有数据包", replayFixture)
+	}
+	var total int64
+	for _, p := range packets {
+		total += int64(p.ci.Length)
+	}
+	return packets, linkType, total / int64(len(packets))
+}
+
+// BenchmarkProcessPacket 单个处理协程按实时抓包的流程处理一个数据包（快速解码及所有统计）
+func BenchmarkProcessPacket(b *testing.B) {
+	packets, linkType, size := loadReplayFixture(b)
+	bm := newBandwidthMonitor("", 0)
+	w := bm.worker(0)
+
+	b.SetBytes(size)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p := &packets[i%len(packets)]
+		bm.processPacket(w, p.data, p.ci, linkType)
+	}
+}
+
+// BenchmarkFullDecode 对照：使用gopacket.NewPacket完整解码一个数据包并格式化五元组
+func BenchmarkFullDecode(b *testing.B) {
+	packets, linkType, size := loadReplayFixture(b)
+
+	b.SetBytes(size)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fullDecode(&packets[i%len(packets)], linkType)
+	}
+}
+
+// fanoutPartition 按对称的流哈希将数据包分配给各处理协程，与AF_PACKET fanout（FanoutHashWithDefrag）一致
+func fanoutPartition(packets []replayPacket, linkType layers.LinkType, workers int) [][]*replayPacket {
+	parts := make([][]*replayPacket, workers)
+	for i := range packets {
+		p := &packets[i]
+		var hash uint64
+		packet := gopacket.NewPacket(p.data, linkType, gopacket.DecodeOptions{NoCopy: true, Lazy: true})
+		if network := packet.NetworkLayer(); network != nil {
+			hash = network.NetworkFlow().FastHash()
+			if transport := packet.TransportLayer(); transport != nil {
+				hash ^= transport.TransportFlow().FastHash()
+			}
+		}
+		parts[hash%uint64(workers)] = append(parts[hash%uint64(workers)], p)
+	}
+	return parts
+}
+
+// BenchmarkReplayFanout 多个处理协程并行处理回放的数据包，模拟AF_PACKET fanout，每次操作为一个数据包
+func BenchmarkReplayFanout(b *testing.B) {
+	packets, linkType, size := loadReplayFixture(b)
+	for _, workers := range []int{1, 2, 4} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			parts := fanoutPartition(packets, linkType, workers)
+			bm := newBandwidthMonitor("", 0)
+
+			b.SetBytes(size)
+			b.ReportAllocs()
+			b.ResetTimer()
+			var wg sync.WaitGroup
+			for i, part := range parts {
+				if len(part) == 0 {
+					continue
+				}
+				wg.Add(1)
+				go func(w *packetWorker, part []*replayPacket) {
+					defer wg.Done()
+					for n := 0; n < b.N/workers; n++ {
+						p := part[n%len(part)]
+						bm.processPacket(w, p.data, p.ci, linkType)
+					}
+				}(bm.worker(i), part)
+			}
+			wg.Wait()
+		})
+	}
+}
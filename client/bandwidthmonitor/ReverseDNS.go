@@ -0,0 +1,238 @@
+package bandwidthmonitor
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"network-monitor-client/config"
+
+	"github.com/google/gopacket/layers"
+)
+
+// 名称的来源
+const (
+	nameSourceDNS = "dns"
+	nameSourcePTR = "ptr"
+)
+
+const (
+	// 等待PTR查询的地址最大数量，超出后新地址不再查询
+	maxPendingPTRLookups = 1024
+	// 单次PTR查询的超时时间
+	ptrLookupTimeout = 2 * time.Second
+	// PTR查询失败或没有记录时，在该时间内不再查询同一地址
+	ptrNegativeTTL = 10 * time.Minute
+)
+
+// reverseName 地址对应的名称
+type reverseName struct {
+	name    string
+	source  string
+	expires time.Time
+}
+
+// reverseDNSCache 从捕获的DNS应答中学习地址到域名的映射，用于在报告中标注远端地址和连接
+// 缓存中没有的地址可选按限速发起PTR查询，查询结果下次上报时生效
+type reverseDNSCache struct {
+	mutex   sync.Mutex
+	entries map[netip.Addr]reverseName
+	// 应答TTL较短时至少保留的时间，连接通常比DNS记录的TTL存活更久
+	minTTL     time.Duration
+	maxEntries int
+	// PTR查询队列及正在等待查询的地址，未开启PTR查询时为nil
+	ptrQueue   chan netip.Addr
+	ptrPending map[netip.Addr]bool
+	ptrRate    int
+	stopChan   chan struct{}
+}
+
+// newReverseDNSCache 按配置创建反向解析缓存，未开启时返回nil
+func newReverseDNSCache(reverseDNS config.ReverseDNSConfig) *reverseDNSCache {
+	if !reverseDNS.Enabled {
+		return nil
+	}
+	c := &reverseDNSCache{
+		entries:    make(map[netip.Addr]reverseName),
+		minTTL:     reverseDNS.MinTTL,
+		maxEntries: reverseDNS.MaxEntries,
+		stopChan:   make(chan struct{}),
+	}
+	if reverseDNS.PTRLookups {
+		c.ptrQueue = make(chan netip.Addr, maxPendingPTRLookups)
+		c.ptrPending = make(map[netip.Addr]bool)
+		c.ptrRate = reverseDNS.PTRRate
+	}
+	return c
+}
+
+// Start 开启PTR查询时启动查询协程
+func (c *reverseDNSCache) Start() {
+	if c.ptrQueue != nil {
+		go c.lookupPTRs()
+	}
+}
+
+// Stop 停止PTR查询协程
+func (c *reverseDNSCache) Stop() {
+	close(c.stopChan)
+}
+
+// Learn 从DNS应答中记录A、AAAA记录的地址对应的查询名称，以及PTR应答中地址对应的名称
+// 经过CNAME的应答也记录为查询名称，用户访问的名称比CDN的名称更有意义
+func (c *reverseDNSCache) Learn(dns *layers.DNS, now time.Time) {
+	if !dns.QR || dns.ResponseCode != layers.DNSResponseCodeNoErr || len(dns.Questions) == 0 {
+		return
+	}
+	question := normalizeHostname(string(dns.Questions[0].Name))
+	if question == "" {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for i := range dns.Answers {
+		answer := &dns.Answers[i]
+		ttl := time.Duration(answer.TTL) * time.Second
+		switch answer.Type {
+		case layers.DNSTypeA, layers.DNSTypeAAAA:
+			if addr, ok := netip.AddrFromSlice(answer.IP); ok {
+				c.store(addr.Unmap(), question, nameSourceDNS, now, ttl)
+			}
+		case layers.DNSTypePTR:
+			if addr, ok := parseReverseName(string(answer.Name)); ok {
+				if name := normalizeHostname(string(answer.PTR)); name != "" {
+					c.store(addr, name, nameSourcePTR, now, ttl)
+				}
+			}
+		}
+	}
+}
+
+// store 记录地址的名称，缓存已满时先清理过期的记录，仍然已满时不记录
+func (c *reverseDNSCache) store(addr netip.Addr, name, source string, now time.Time, ttl time.Duration) {
+	if ttl < c.minTTL {
+		ttl = c.minTTL
+	}
+	if _, ok := c.entries[addr]; !ok && len(c.entries) >= c.maxEntries {
+		for key, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, key)
+			}
+		}
+		if len(c.entries) >= c.maxEntries {
+			return
+		}
+	}
+	c.entries[addr] = reverseName{name: name, source: source, expires: now.Add(ttl)}
+}
+
+// Lookup 获取地址的名称及来源，缓存中没有时返回空，开启PTR查询时加入查询队列
+// 过期的记录仍然返回，直到被新的应答覆盖或缓存已满时清理
+func (c *reverseDNSCache) Lookup(addr netip.Addr) (string, string) {
+	if c == nil || !addr.IsValid() {
+		return "", ""
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if entry, ok := c.entries[addr]; ok {
+		// PTR查询没有结果的地址缓存为空名称
+		if entry.name == "" {
+			return "", ""
+		}
+		return entry.name, entry.source
+	}
+	if c.ptrQueue != nil && !c.ptrPending[addr] && isGlobalAddr(addr) {
+		select {
+		case c.ptrQueue <- addr:
+			c.ptrPending[addr] = true
+		default:
+		}
+	}
+	return "", ""
+}
+
+// lookupPTRs 按配置的速率依次查询队列中地址的PTR记录
+func (c *reverseDNSCache) lookupPTRs() {
+	ticker := time.NewTicker(time.Second / time.Duration(c.ptrRate))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stopChan:
+			return
+		case <-ticker.C:
+		}
+		var addr netip.Addr
+		select {
+		case <-c.stopChan:
+			return
+		case addr = <-c.ptrQueue:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), ptrLookupTimeout)
+		names, err := net.DefaultResolver.LookupAddr(ctx, addr.String())
+		cancel()
+
+		now := time.Now()
+		c.mutex.Lock()
+		delete(c.ptrPending, addr)
+		// 没有记录时缓存空名称，避免重复查询
+		name, ttl := "", ptrNegativeTTL
+		if err == nil && len(names) > 0 {
+			name, ttl = normalizeHostname(names[0]), c.minTTL
+		}
+		// 查询期间从DNS应答中学到的名称优先
+		if _, ok := c.entries[addr]; !ok {
+			c.store(addr, name, nameSourcePTR, now, ttl)
+		}
+		c.mutex.Unlock()
+	}
+}
+
+// parseReverseName 解析in-addr.arpa或ip6.arpa格式的反向解析名称
+func parseReverseName(name string) (netip.Addr, bool) {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	if v4, ok := strings.CutSuffix(name, ".in-addr.arpa"); ok {
+		parts := strings.Split(v4, ".")
+		if len(parts) != 4 {
+			return netip.Addr{}, false
+		}
+		for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+			parts[i], parts[j] = parts[j], parts[i]
+		}
+		addr, err := netip.ParseAddr(strings.Join(parts, "."))
+		return addr, err == nil
+	}
+	if v6, ok := strings.CutSuffix(name, ".ip6.arpa"); ok {
+		nibbles := strings.Split(v6, ".")
+		if len(nibbles) != 32 {
+			return netip.Addr{}, false
+		}
+		var raw [16]byte
+		for i, nibble := range nibbles {
+			if len(nibble) != 1 {
+				return netip.Addr{}, false
+			}
+			value := strings.IndexByte("0123456789abcdef", nibble[0])
+			if value < 0 {
+				return netip.Addr{}, false
+			}
+			// 名称从最低位的半字节开始
+			pos := 31 - i
+			raw[pos/2] |= byte(value) << (4 * (1 - pos%2))
+		}
+		return netip.AddrFrom16(raw).Unmap(), true
+	}
+	return netip.Addr{}, false
+}
+
+// isGlobalAddr 是否为公网单播地址，私有、回环、链路本地地址不发起PTR查询
+func isGlobalAddr(addr netip.Addr) bool {
+	return addr.IsGlobalUnicast() && !addr.IsPrivate()
+}
@@ -0,0 +1,128 @@
+package bandwidthmonitor
+
+import (
+	"math"
+	"math/rand/v2"
+	"sync/atomic"
+
+	"network-monitor-client/config"
+)
+
+// 采样方式
+const (
+	// 处理所有数据包
+	samplingNone = "none"
+	// 每rate个数据包取1个
+	samplingCount = "count"
+	// 每个数据包以1/rate的概率采样
+	samplingRandom = "random"
+)
+
+// 误差范围使用95%置信区间，对应的标准正态分位数
+const samplingConfidenceZ = 1.96
+
+// SamplingStats 采样方式及带宽估算的误差范围
+// 误差范围为95%置信区间的半宽（字节/秒），即真实速率大致落在 估算值±误差 之内
+type SamplingStats struct {
+	Mode               string  `json:"mode"`
+	Rate               int     `json:"rate"`
+	UploadSpeedError   float64 `json:"upload_speed_error"`
+	DownloadSpeedError float64 `json:"download_speed_error"`
+	InternalSpeedError float64 `json:"internal_speed_error"`
+}
+
+// add 合并另一个网卡的误差范围，各网卡的估算相互独立，方差相加
+func (s *SamplingStats) add(other *SamplingStats) {
+	if s.Mode == "" {
+		s.Mode, s.Rate = other.Mode, other.Rate
+	}
+	s.UploadSpeedError = math.Hypot(s.UploadSpeedError, other.UploadSpeedError)
+	s.DownloadSpeedError = math.Hypot(s.DownloadSpeedError, other.DownloadSpeedError)
+	s.InternalSpeedError = math.Hypot(s.InternalSpeedError, other.InternalSpeedError)
+}
+
+// samplingPolicy 采样方式和采样率，修改时整体替换，读取无需加锁
+type samplingPolicy struct {
+	mode string
+	rate uint64
+}
+
+// newSamplingPolicy 按配置创建采样方式，采样率为1时等同于不采样
+func newSamplingPolicy(sampling config.SamplingConfig) *samplingPolicy {
+	if sampling.Mode == "" || sampling.Mode == samplingNone || sampling.Rate <= 1 {
+		return &samplingPolicy{mode: samplingNone, rate: 1}
+	}
+	return &samplingPolicy{mode: sampling.Mode, rate: uint64(sampling.Rate)}
+}
+
+// sample 判断处理协程当前的数据包是否被采样
+func (p *samplingPolicy) sample(w *packetWorker) bool {
+	switch p.mode {
+	case samplingCount:
+		w.seen++
+		return w.seen%p.rate == 0
+	case samplingRandom:
+		return rand.Uint64N(p.rate) == 0
+	}
+	return true
+}
+
+// atomicFloat64 可原子累加的浮点数
+type atomicFloat64 struct {
+	bits atomic.Uint64
+}
+
+// Add 原子累加
+func (f *atomicFloat64) Add(delta float64) {
+	for {
+		old := f.bits.Load()
+		if f.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+// Swap 原子替换并返回旧值
+func (f *atomicFloat64) Swap(value float64) float64 {
+	return math.Float64frombits(f.bits.Swap(math.Float64bits(value)))
+}
+
+// sampleVariance 单个被采样数据包对放大后字节数估算方差的贡献
+// 每个数据包以1/rate的概率计入并放大rate倍时，方差的无偏估计为 rate*(rate-1)*size²
+// 按计数采样时流量与采样位置无关，使用相同的近似
+func sampleVariance(size, rate uint64) float64 {
+	s := float64(size)
+	return float64(rate) * float64(rate-1) * s * s
+}
+
+// speedError 由滑动窗口内各采样点的方差计算平均速率的误差范围
+func speedError(variances []float64) float64 {
+	if len(variances) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range variances {
+		sum += v
+	}
+	return samplingConfidenceZ * math.Sqrt(sum) / float64(len(variances))
+}
+
+// SetSampling 修改采样方式，所有处理协程从下一个数据包开始生效
+func (bm *BandwidthMonitor) SetSampling(sampling config.SamplingConfig) {
+	bm.sampling.Store(newSamplingPolicy(sampling))
+}
+
+// samplingStats 获取当前的采样方式和误差范围，不采样时返回nil，调用方需持有统计锁
+func (bm *BandwidthMonitor) samplingStats() *SamplingStats {
+	policy := bm.sampling.Load()
+	if policy.mode == samplingNone {
+		return nil
+	}
+	return &SamplingStats{
+		Mode:               policy.mode,
+		Rate:               int(policy.rate),
+		UploadSpeedError:   bm.stats.UploadSpeedError,
+		DownloadSpeedError: bm.stats.DownloadSpeedError,
+		InternalSpeedError: bm.stats.InternalSpeedError,
+	}
+}
@@ -0,0 +1,42 @@
+package bandwidthmonitor
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+func TestSampledTrackersSkipFailures(t *testing.T) {
+	client, server := net.IPv4(10, 0, 0, 1).To4(), net.IPv4(192, 0, 2, 1).To4()
+	netFlow := gopacket.NewFlow(layers.EndpointIPv4, client, server)
+	// 超过SYN和DNS查询的超时时间
+	ts := time.Now().Add(-time.Minute)
+
+	for _, sampled := range []bool{false, true} {
+		tcpHealth := NewTCPHealthTracker()
+		syn := &layers.TCP{SrcPort: 40000, DstPort: 443, SYN: true, Window: 65535}
+		tcpHealth.Update(netFlow, syn, true, ts, sampled)
+		stats := tcpHealth.Take()
+		if stats.Upload.Syns != 1 {
+			t.Errorf("sampled=%v SYN数量 = %d，期望 1", sampled, stats.Upload.Syns)
+		}
+		if want := map[bool]uint64{false: 1, true: 0}[sampled]; stats.Upload.FailedConnections != want {
+			t.Errorf("sampled=%v 连接失败数量 = %d，期望 %d", sampled, stats.Upload.FailedConnections, want)
+		}
+
+		dns := NewDNSTracker()
+		udp := &layers.UDP{SrcPort: 40000, DstPort: 53}
+		dns.Update(netFlow, udp.TransportFlow(), &layers.DNS{ID: 1}, ts, sampled)
+		var dnsStats DNSStats
+		dns.drainInto(&dnsStats, nil)
+		if dnsStats.Queries != 1 {
+			t.Errorf("sampled=%v 查询数量 = %d，期望 1", sampled, dnsStats.Queries)
+		}
+		if want := map[bool]uint64{false: 1, true: 0}[sampled]; dnsStats.Timeouts != want {
+			t.Errorf("sampled=%v 超时数量 = %d，期望 %d", sampled, dnsStats.Timeouts, want)
+		}
+	}
+}
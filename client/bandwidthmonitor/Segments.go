@@ -0,0 +1,180 @@
+package bandwidthmonitor
+
+import (
+	"bytes"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"network-monitor-client/devicemonitor"
+
+	"github.com/google/gopacket/layers"
+)
+
+// 被动学习的网关（IPv6路由通告发送方）最大数量
+const maxLearnedGateways = 16
+
+// SegmentStats 按网关MAC区分的WAN/LAN带宽（字节/秒）
+// 发往网关的帧计入WAN上行，来自网关的帧计入WAN下行，其余为LAN流量
+type SegmentStats struct {
+	WANUploadSpeed   float64 `json:"wan_upload_speed"`
+	WANDownloadSpeed float64 `json:"wan_download_speed"`
+	LANUploadSpeed   float64 `json:"lan_upload_speed"`
+	LANDownloadSpeed float64 `json:"lan_download_speed"`
+}
+
+// add 累加另一个网卡的WAN/LAN带宽
+func (s *SegmentStats) add(other *SegmentStats) {
+	s.WANUploadSpeed += other.WANUploadSpeed
+	s.WANDownloadSpeed += other.WANDownloadSpeed
+	s.LANUploadSpeed += other.LANUploadSpeed
+	s.LANDownloadSpeed += other.LANDownloadSpeed
+}
+
+// 流量所属的网段和方向
+const (
+	segmentWANUpload = iota
+	segmentWANDownload
+	segmentLANUpload
+	segmentLANDownload
+	segmentCount
+)
+
+// rateCounter 单个网段方向的滑动平均速率
+type rateCounter struct {
+	history []float64
+	speed   float64
+}
+
+// gatewaySet 网关MAC列表，修改时整体替换，读取无需加锁
+type gatewaySet struct {
+	// 从路由表和ARP表获取的网关MAC
+	configured []net.HardwareAddr
+	// 从IPv6路由通告中学习到的网关MAC
+	learned []net.HardwareAddr
+}
+
+// empty 判断是否尚未获知任何网关
+func (g *gatewaySet) empty() bool {
+	return len(g.configured) == 0 && len(g.learned) == 0
+}
+
+// contains 判断MAC地址是否属于网关
+func (g *gatewaySet) contains(mac net.HardwareAddr) bool {
+	for _, gateway := range g.configured {
+		if bytes.Equal(gateway, mac) {
+			return true
+		}
+	}
+	for _, gateway := range g.learned {
+		if bytes.Equal(gateway, mac) {
+			return true
+		}
+	}
+	return false
+}
+
+// segmentTracker 根据以太网帧的源/目的MAC是否为网关统计WAN/LAN带宽
+// 字节数由各处理协程分别累计，每个统计间隔汇总一次
+type segmentTracker struct {
+	mutex       sync.Mutex
+	counters    [segmentCount]rateCounter
+	historySize int
+	lastUpdate  time.Time
+	gateways    atomic.Pointer[gatewaySet]
+}
+
+// newSegmentTracker 创建WAN/LAN带宽统计器
+func newSegmentTracker(historySize int) *segmentTracker {
+	t := &segmentTracker{
+		historySize: historySize,
+		lastUpdate:  time.Now(),
+	}
+	t.gateways.Store(&gatewaySet{})
+	return t
+}
+
+// refreshGateways 从路由表和ARP表重新获取网卡的网关MAC
+func (t *segmentTracker) refreshGateways(device string) {
+	macs, err := devicemonitor.GatewayMACs(device)
+	if err != nil {
+		// 非Linux系统没有路由表和ARP表文件，只能依赖路由通告学习
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	current := t.gateways.Load()
+	t.gateways.Store(&gatewaySet{configured: macs, learned: current.learned})
+}
+
+// learnGateway 记录IPv6路由通告的发送方为网关
+func (t *segmentTracker) learnGateway(mac net.HardwareAddr) {
+	if t.gateways.Load().contains(mac) {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	current := t.gateways.Load()
+	if current.contains(mac) || len(current.learned) >= maxLearnedGateways {
+		return
+	}
+	learned := append(append([]net.HardwareAddr(nil), current.learned...), append(net.HardwareAddr(nil), mac...))
+	t.gateways.Store(&gatewaySet{configured: current.configured, learned: learned})
+}
+
+// classify 根据以太网帧判断所属的网段和方向，ownMAC为抓包网卡的MAC地址，尚未获知网关时返回false
+func (t *segmentTracker) classify(eth *layers.Ethernet, ownMAC net.HardwareAddr) (int, bool) {
+	gateways := t.gateways.Load()
+	if gateways.empty() {
+		return 0, false
+	}
+	switch {
+	case gateways.contains(eth.DstMAC):
+		return segmentWANUpload, true
+	case gateways.contains(eth.SrcMAC):
+		return segmentWANDownload, true
+	case len(ownMAC) > 0 && bytes.Equal(eth.SrcMAC, ownMAC):
+		return segmentLANUpload, true
+	}
+	return segmentLANDownload, true
+}
+
+// CalculateSpeeds 使用本间隔各网段方向的字节数计算速率并更新滑动窗口
+func (t *segmentTracker) CalculateSpeeds(counts [segmentCount]uint64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	duration := now.Sub(t.lastUpdate).Seconds()
+	if duration <= 0 {
+		return
+	}
+	for i := range t.counters {
+		counter := &t.counters[i]
+		counter.history = append(counter.history, float64(counts[i])/duration)
+		if len(counter.history) > t.historySize {
+			counter.history = counter.history[1:]
+		}
+		counter.speed = calculateMovingAverage(counter.history)
+	}
+	t.lastUpdate = now
+}
+
+// Stats 获取WAN/LAN带宽，尚未获知网关MAC时返回nil
+func (t *segmentTracker) Stats() *SegmentStats {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.gateways.Load().empty() {
+		return nil
+	}
+	return &SegmentStats{
+		WANUploadSpeed:   t.counters[segmentWANUpload].speed,
+		WANDownloadSpeed: t.counters[segmentWANDownload].speed,
+		LANUploadSpeed:   t.counters[segmentLANUpload].speed,
+		LANDownloadSpeed: t.counters[segmentLANDownload].speed,
+	}
+}
@@ -0,0 +1,206 @@
+package bandwidthmonitor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	// SYN发出后超过该时间仍未收到SYN-ACK，视为连接失败
+	synTimeout = 3 * time.Second
+	// 流空闲超过该时间后从跟踪表中移除
+	tcpFlowIdleTimeout = 2 * time.Minute
+	// 跟踪表最大流数量，超过后清空以限制内存占用
+	maxTCPFlows = 65536
+)
+
+// TCPDirectionStats 单方向TCP健康指标
+type TCPDirectionStats struct {
+	// 重传估计次数（重复的序列号）
+	Retransmissions uint64 `json:"retransmissions"`
+	// 零窗口通告次数
+	ZeroWindows uint64 `json:"zero_windows"`
+	// RST包数量
+	Resets uint64 `json:"resets"`
+	// SYN包数量（不含SYN-ACK）
+	Syns uint64 `json:"syns"`
+	// SYN-ACK包数量
+	SynAcks uint64 `json:"syn_acks"`
+	// 发起但未收到SYN-ACK的连接数量
+	FailedConnections uint64 `json:"failed_connections"`
+}
+
+// add 累加另一组单方向指标
+func (s *TCPDirectionStats) add(other TCPDirectionStats) {
+	s.Retransmissions += other.Retransmissions
+	s.ZeroWindows += other.ZeroWindows
+	s.Resets += other.Resets
+	s.Syns += other.Syns
+	s.SynAcks += other.SynAcks
+	s.FailedConnections += other.FailedConnections
+}
+
+// TCPHealthStats TCP健康指标（按上下行区分）
+type TCPHealthStats struct {
+	Upload   TCPDirectionStats `json:"upload"`
+	Download TCPDirectionStats `json:"download"`
+	// 采样时为采样率：计数只来自被采样的数据包，未按采样率放大；SYN和SYN-ACK很少同时被采样，不统计连接失败
+	SampleRate int `json:"sample_rate,omitempty"`
+}
+
+// add 累加另一个处理协程的指标
+func (s *TCPHealthStats) add(other TCPHealthStats) {
+	s.Upload.add(other.Upload)
+	s.Download.add(other.Download)
+}
+
+// tcpFlowKey 单方向TCP流标识
+type tcpFlowKey struct {
+	network   gopacket.Flow
+	transport gopacket.Flow
+}
+
+// tcpFlowState 单方向TCP流状态
+type tcpFlowState struct {
+	// 已见到的最大序列号末尾
+	nextSeq uint32
+	// 是否已记录过序列号
+	seqValid bool
+	// 等待SYN-ACK的SYN发送时间
+	synTime time.Time
+	// SYN是否为上行
+	synUpload bool
+	// 最后活动时间
+	lastSeen time.Time
+}
+
+// TCPHealthTracker TCP健康状态跟踪器，每个处理协程一个，只在上报时与处理协程竞争锁
+type TCPHealthTracker struct {
+	mutex sync.Mutex
+	flows map[tcpFlowKey]*tcpFlowState
+	stats TCPHealthStats
+}
+
+// NewTCPHealthTracker 创建TCP健康状态跟踪器
+func NewTCPHealthTracker() *TCPHealthTracker {
+	return &TCPHealthTracker{
+		flows: make(map[tcpFlowKey]*tcpFlowState),
+	}
+}
+
+// seqBefore 判断序列号a是否在b之前（考虑回绕）
+func seqBefore(a, b uint32) bool {
+	return int32(a-b) < 0
+}
+
+// Update 根据TCP报文更新健康指标，sampled表示数据包采样开启，此时不跟踪等待SYN-ACK的SYN
+func (t *TCPHealthTracker) Update(netFlow gopacket.Flow, tcp *layers.TCP, isUpload bool, ts time.Time, sampled bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	dir := &t.stats.Download
+	if isUpload {
+		dir = &t.stats.Upload
+	}
+
+	key := tcpFlowKey{network: netFlow, transport: tcp.TransportFlow()}
+	flow := t.flows[key]
+	if flow == nil {
+		if len(t.flows) >= maxTCPFlows {
+			t.flows = make(map[tcpFlowKey]*tcpFlowState)
+		}
+		flow = &tcpFlowState{}
+		t.flows[key] = flow
+	}
+	flow.lastSeen = ts
+
+	switch {
+	case tcp.SYN && !tcp.ACK:
+		dir.Syns++
+		// 重复的SYN视为SYN重传
+		if !flow.synTime.IsZero() {
+			dir.Retransmissions++
+		} else if !sampled {
+			flow.synTime = ts
+			flow.synUpload = isUpload
+		}
+	case tcp.SYN && tcp.ACK:
+		dir.SynAcks++
+		t.resolveSyn(key)
+	}
+
+	if tcp.RST {
+		dir.Resets++
+		// 对SYN直接回复RST同样视为连接失败
+		if reverse := t.flows[reverseTCPFlowKey(key)]; reverse != nil && !reverse.synTime.IsZero() {
+			t.failSyn(reverse)
+		}
+		return
+	}
+
+	if tcp.Window == 0 && !tcp.SYN && !tcp.FIN {
+		dir.ZeroWindows++
+	}
+
+	// 仅对携带数据的报文进行重传判断
+	payloadLen := uint32(len(tcp.Payload))
+	if payloadLen == 0 {
+		return
+	}
+	end := tcp.Seq + payloadLen
+	if flow.seqValid && !seqBefore(flow.nextSeq, end) {
+		dir.Retransmissions++
+		return
+	}
+	flow.nextSeq = end
+	flow.seqValid = true
+}
+
+// reverseTCPFlowKey 获取反方向的流标识
+func reverseTCPFlowKey(key tcpFlowKey) tcpFlowKey {
+	return tcpFlowKey{network: key.network.Reverse(), transport: key.transport.Reverse()}
+}
+
+// resolveSyn SYN-ACK到达后清除对端等待中的SYN
+func (t *TCPHealthTracker) resolveSyn(key tcpFlowKey) {
+	if reverse := t.flows[reverseTCPFlowKey(key)]; reverse != nil {
+		reverse.synTime = time.Time{}
+	}
+}
+
+// failSyn 将等待中的SYN记为连接失败
+func (t *TCPHealthTracker) failSyn(flow *tcpFlowState) {
+	if flow.synUpload {
+		t.stats.Upload.FailedConnections++
+	} else {
+		t.stats.Download.FailedConnections++
+	}
+	flow.synTime = time.Time{}
+}
+
+// Take 获取自上次调用以来的TCP健康指标并重置计数器
+func (t *TCPHealthTracker) Take() TCPHealthStats {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	for key, flow := range t.flows {
+		if !flow.synTime.IsZero() && now.Sub(flow.synTime) > synTimeout {
+			t.failSyn(flow)
+		}
+		if now.Sub(flow.lastSeen) > tcpFlowIdleTimeout {
+			delete(t.flows, key)
+		}
+	}
+
+	stats := t.stats
+	t.stats = TCPHealthStats{}
+	return stats
+}
@@ -0,0 +1,342 @@
+package bandwidthmonitor
+
+import (
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	// 握手未完成的记录超过该时间后丢弃
+	handshakeTimeout = 10 * time.Second
+	// 每个上报周期最多保留的RTT样本数，超出后按蓄水池抽样随机替换
+	maxRTTSamples = 10000
+	// 单个远端子网每个上报周期最多保留的RTT样本数
+	maxSubnetRTTSamples = 1000
+	// 每个处理协程所有子网合计最多保留的RTT样本数，达到后各子网只替换已有样本
+	maxTotalSubnetRTTSamples = 50000
+	// 每个上报周期最多统计的远端子网数
+	maxRTTSubnets = 1024
+	// 每次上报的子网数量上限（按样本数排序）
+	maxReportedRTTSubnets = 20
+	// 握手跟踪表的最大记录数
+	maxHandshakes = 65536
+)
+
+// RTTSummary RTT样本统计（单位：毫秒）
+type RTTSummary struct {
+	Count int     `json:"count"`
+	Min   float64 `json:"min_ms"`
+	Avg   float64 `json:"avg_ms"`
+	P50   float64 `json:"p50_ms"`
+	P90   float64 `json:"p90_ms"`
+	P99   float64 `json:"p99_ms"`
+	Max   float64 `json:"max_ms"`
+}
+
+// SubnetRTT 远端子网的RTT统计
+type SubnetRTT struct {
+	// 远端子网（IPv4为/24，IPv6为/48）
+	Subnet string `json:"subnet"`
+	RTTSummary
+}
+
+// TCPRTTStats 基于TCP握手的被动RTT统计
+type TCPRTTStats struct {
+	// 所有远端的汇总统计
+	Total RTTSummary `json:"total"`
+	// 按远端子网的统计
+	Subnets []SubnetRTT `json:"subnets,omitempty"`
+}
+
+// handshakeState 单个TCP握手的时间记录
+type handshakeState struct {
+	synTime    time.Time
+	synAckTime time.Time
+	synAckSeq  uint32
+	// 发生重传时样本不可靠（Karn算法）
+	synRetransmitted    bool
+	synAckRetransmitted bool
+}
+
+// TCPRTTTracker 通过SYN→SYN-ACK及SYN-ACK→ACK计时估算往返时延，每个处理协程一个，只在上报时与处理协程竞争锁
+type TCPRTTTracker struct {
+	mutex      sync.Mutex
+	handshakes map[tcpFlowKey]*handshakeState
+	samples    rttReservoir
+	subnets    map[netip.Prefix]*rttReservoir
+	// 各子网合计保留的样本数
+	subnetSamples int
+	// 判断是否为本机地址，本机地址的样本仅反映协议栈延迟
+	isHostIP func(ip net.IP) bool
+}
+
+// NewTCPRTTTracker 创建RTT跟踪器
+func NewTCPRTTTracker(isHostIP func(ip net.IP) bool) *TCPRTTTracker {
+	return &TCPRTTTracker{
+		handshakes: make(map[tcpFlowKey]*handshakeState),
+		subnets:    make(map[netip.Prefix]*rttReservoir),
+		isHostIP:   isHostIP,
+	}
+}
+
+// Update 根据TCP握手报文更新RTT样本
+func (t *TCPRTTTracker) Update(netFlow gopacket.Flow, tcp *layers.TCP, ts time.Time) {
+	// 只关心握手相关的报文
+	if !tcp.SYN && !tcp.ACK {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	key := tcpFlowKey{network: netFlow, transport: tcp.TransportFlow()}
+
+	switch {
+	case tcp.SYN && !tcp.ACK:
+		// 发起方发送SYN
+		if hs := t.handshakes[key]; hs != nil {
+			hs.synRetransmitted = true
+			return
+		}
+		if len(t.handshakes) >= maxHandshakes {
+			t.handshakes = make(map[tcpFlowKey]*handshakeState)
+		}
+		t.handshakes[key] = &handshakeState{synTime: ts}
+
+	case tcp.SYN && tcp.ACK:
+		// 响应方回复SYN-ACK，SYN→SYN-ACK为到响应方的RTT
+		hs := t.handshakes[reverseTCPFlowKey(key)]
+		if hs == nil {
+			return
+		}
+		if !hs.synAckTime.IsZero() {
+			hs.synAckRetransmitted = true
+			return
+		}
+		hs.synAckTime = ts
+		hs.synAckSeq = tcp.Seq
+		if !hs.synRetransmitted {
+			t.addSample(netFlow.Src(), ts.Sub(hs.synTime))
+		}
+
+	default:
+		// 发起方确认SYN-ACK，SYN-ACK→ACK为到发起方的RTT
+		hs := t.handshakes[key]
+		if hs == nil || hs.synAckTime.IsZero() || tcp.Ack != hs.synAckSeq+1 {
+			return
+		}
+		if !hs.synAckRetransmitted {
+			t.addSample(netFlow.Src(), ts.Sub(hs.synAckTime))
+		}
+		delete(t.handshakes, key)
+	}
+}
+
+// addSample 记录到指定远端的RTT样本
+func (t *TCPRTTTracker) addSample(peer gopacket.Endpoint, rtt time.Duration) {
+	if rtt < 0 {
+		return
+	}
+	addr, ok := netip.AddrFromSlice(peer.Raw())
+	if !ok {
+		return
+	}
+	addr = addr.Unmap()
+	if t.isHostIP != nil && t.isHostIP(net.IP(addr.AsSlice())) {
+		return
+	}
+
+	ms := float64(rtt) / float64(time.Millisecond)
+	t.samples.add(ms, maxRTTSamples, true)
+
+	bits := 24
+	if addr.Is6() {
+		bits = 48
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return
+	}
+	subnet, ok := t.subnets[prefix]
+	if !ok {
+		if len(t.subnets) >= maxRTTSubnets {
+			return
+		}
+		subnet = &rttReservoir{}
+		t.subnets[prefix] = subnet
+	}
+	if subnet.add(ms, maxSubnetRTTSamples, t.subnetSamples < maxTotalSubnetRTTSamples) {
+		t.subnetSamples++
+	}
+}
+
+// rttReservoir RTT样本蓄水池，样本数、最小值、最大值和平均值精确统计，百分位数按保留的样本计算
+type rttReservoir struct {
+	samples []float64
+	count   int
+	sum     float64
+	min     float64
+	max     float64
+}
+
+// add 记录一个样本，未达到容量且允许增长时保留，否则按蓄水池抽样随机替换已保留的样本，返回保留的样本数是否增加
+func (r *rttReservoir) add(ms float64, capacity int, grow bool) bool {
+	if r.count == 0 || ms < r.min {
+		r.min = ms
+	}
+	if r.count == 0 || ms > r.max {
+		r.max = ms
+	}
+	r.count++
+	r.sum += ms
+	if grow && len(r.samples) < capacity {
+		r.samples = append(r.samples, ms)
+		return true
+	}
+	if i := rand.IntN(r.count); i < len(r.samples) {
+		r.samples[i] = ms
+	}
+	return false
+}
+
+// merge 合并另一个处理协程的样本，合并后超过容量时随机保留capacity个
+func (r *rttReservoir) merge(other *rttReservoir, capacity int) {
+	if other.count == 0 {
+		return
+	}
+	if r.count == 0 || other.min < r.min {
+		r.min = other.min
+	}
+	if r.count == 0 || other.max > r.max {
+		r.max = other.max
+	}
+	r.count += other.count
+	r.sum += other.sum
+	r.samples = append(r.samples, other.samples...)
+	if len(r.samples) > capacity {
+		rand.Shuffle(len(r.samples), func(i, j int) {
+			r.samples[i], r.samples[j] = r.samples[j], r.samples[i]
+		})
+		r.samples = r.samples[:capacity]
+	}
+}
+
+// summary 计算统计结果
+func (r *rttReservoir) summary() RTTSummary {
+	if r.count == 0 {
+		return RTTSummary{}
+	}
+	summary := summarizeRTT(r.samples)
+	summary.Count = r.count
+	summary.Min, summary.Max = r.min, r.max
+	summary.Avg = r.sum / float64(r.count)
+	return summary
+}
+
+// rttSamples 各处理协程汇总的RTT样本
+type rttSamples struct {
+	total   rttReservoir
+	subnets map[netip.Prefix]*rttReservoir
+}
+
+// newRTTSamples 创建RTT样本汇总
+func newRTTSamples() *rttSamples {
+	return &rttSamples{subnets: make(map[netip.Prefix]*rttReservoir)}
+}
+
+// drainInto 将自上次调用以来的RTT样本追加到汇总结果并清空
+func (t *TCPRTTTracker) drainInto(samples *rttSamples) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	for key, hs := range t.handshakes {
+		if now.Sub(hs.synTime) > handshakeTimeout {
+			delete(t.handshakes, key)
+		}
+	}
+
+	samples.total.merge(&t.samples, maxRTTSamples)
+	for prefix, subnet := range t.subnets {
+		total, ok := samples.subnets[prefix]
+		if !ok {
+			total = &rttReservoir{}
+			samples.subnets[prefix] = total
+		}
+		total.merge(subnet, maxSubnetRTTSamples)
+	}
+	t.samples = rttReservoir{}
+	t.subnets = make(map[netip.Prefix]*rttReservoir)
+	t.subnetSamples = 0
+}
+
+// summarize 计算汇总的RTT统计，子网按样本数从多到少取前maxReportedRTTSubnets个
+func (s *rttSamples) summarize() TCPRTTStats {
+	stats := TCPRTTStats{Total: s.total.summary()}
+	for prefix, subnet := range s.subnets {
+		stats.Subnets = append(stats.Subnets, SubnetRTT{
+			Subnet:     prefix.String(),
+			RTTSummary: subnet.summary(),
+		})
+	}
+	sort.Slice(stats.Subnets, func(i, j int) bool {
+		return stats.Subnets[i].Count > stats.Subnets[j].Count
+	})
+	if len(stats.Subnets) > maxReportedRTTSubnets {
+		stats.Subnets = stats.Subnets[:maxReportedRTTSubnets]
+	}
+	return stats
+}
+
+// summarizeRTT 计算RTT样本的最小值、平均值、百分位数和最大值
+func summarizeRTT(samples []float64) RTTSummary {
+	if len(samples) == 0 {
+		return RTTSummary{}
+	}
+
+	sorted := make([]float64, len(samples))
+	copy(sorted, samples)
+	sort.Float64s(sorted)
+
+	sum := 0.0
+	for _, v := range sorted {
+		sum += v
+	}
+
+	return RTTSummary{
+		Count: len(sorted),
+		Min:   sorted[0],
+		Avg:   sum / float64(len(sorted)),
+		P50:   percentile(sorted, 50),
+		P90:   percentile(sorted, 90),
+		P99:   percentile(sorted, 99),
+		Max:   sorted[len(sorted)-1],
+	}
+}
+
+// percentile 使用最近秩法计算已排序样本的百分位数
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
@@ -0,0 +1,108 @@
+package bandwidthmonitor
+
+import (
+	"sync/atomic"
+
+	"github.com/google/gopacket/layers"
+)
+
+// trafficCounters 单个处理协程按方向累计的字节数、数据包数以及WAN/LAN字节数，采样时为放大后的估算值
+// 处理协程原子累加，统计协程每个间隔原子取出并清零，两者之间无需加锁
+type trafficCounters struct {
+	bytes    [3]atomic.Uint64
+	packets  [3]atomic.Uint64
+	segments [segmentCount]atomic.Uint64
+	// 采样时字节数估算的方差
+	variance [3]atomicFloat64
+}
+
+// add 累计一个被采样的数据包，rate为采样率
+func (c *trafficCounters) add(direction Direction, size, rate uint64) {
+	c.bytes[direction].Add(size * rate)
+	c.packets[direction].Add(rate)
+	if rate > 1 {
+		c.variance[direction].Add(sampleVariance(size, rate))
+	}
+}
+
+// trafficTotals 各处理协程计数的汇总
+type trafficTotals struct {
+	bytes    directionBytes
+	packets  directionBytes
+	segments [segmentCount]uint64
+	variance [3]float64
+}
+
+// drainInto 将计数累加到汇总结果并清零
+func (c *trafficCounters) drainInto(totals *trafficTotals) {
+	for i := range c.bytes {
+		totals.bytes[i] += c.bytes[i].Swap(0)
+		totals.packets[i] += c.packets[i].Swap(0)
+		totals.variance[i] += c.variance[i].Swap(0)
+	}
+	for i := range c.segments {
+		totals.segments[i] += c.segments[i].Swap(0)
+	}
+}
+
+// packetWorker 单个处理协程的解码器和计数器，AF_PACKET fanout时每个句柄对应一个
+// 抓包中断恢复后按序号复用，解码器只由所属的处理协程访问
+// fanout按对称的流哈希分配数据包，同一连接两个方向的数据包由同一协程处理，TCP和DNS跟踪器按协程独立
+type packetWorker struct {
+	counters      trafficCounters
+	tcpHealth     *TCPHealthTracker
+	tcpRTT        *TCPRTTTracker
+	dns           *DNSTracker
+	encapsulation *encapsulationCounters
+	processes     *processCounters
+	remotes       *remoteCounters
+	hostnames     *hostnameCounters
+	flowExports   *flowExportCounters
+	decoder       *packetDecoder
+	// 按计数采样时已处理的数据包数量
+	seen uint64
+}
+
+// decoderFor 获取指定链路层类型的解码器，网卡重建后链路层类型变化时重新创建
+func (w *packetWorker) decoderFor(linkType layers.LinkType) *packetDecoder {
+	if w.decoder == nil || w.decoder.linkType != linkType {
+		w.decoder = newPacketDecoder(linkType)
+	}
+	return w.decoder
+}
+
+// worker 获取第i个处理协程的解码器和计数器，不存在时创建
+func (bm *BandwidthMonitor) worker(i int) *packetWorker {
+	bm.workersMutex.Lock()
+	defer bm.workersMutex.Unlock()
+
+	for len(bm.workers) <= i {
+		bm.workers = append(bm.workers, &packetWorker{
+			tcpHealth:     NewTCPHealthTracker(),
+			tcpRTT:        NewTCPRTTTracker(bm.stats.isHostIP),
+			dns:           NewDNSTracker(),
+			encapsulation: newEncapsulationCounters(),
+			processes:     newProcessCounters(),
+			remotes:       newRemoteCounters(),
+			hostnames:     newHostnameCounters(),
+			flowExports:   newFlowExportCounters(bm.flowWake),
+		})
+	}
+	return bm.workers[i]
+}
+
+// packetWorkers 获取所有处理协程的解码器和计数器
+func (bm *BandwidthMonitor) packetWorkers() []*packetWorker {
+	bm.workersMutex.Lock()
+	defer bm.workersMutex.Unlock()
+	return append([]*packetWorker(nil), bm.workers...)
+}
+
+// drainCounters 取出并清零各处理协程的流量计数
+func (bm *BandwidthMonitor) drainCounters() trafficTotals {
+	var totals trafficTotals
+	for _, w := range bm.packetWorkers() {
+		w.counters.drainInto(&totals)
+	}
+	return totals
+}
@@ -2,11 +2,208 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
 )
 
+// ProbeTarget 主动探测目标
+type ProbeTarget struct {
+	// 目标名称（用于上报标识）
+	Name string `mapstructure:"name"`
+	// 探测类型：icmp、tcp、udp
+	Type string `mapstructure:"type"`
+	// 目标主机（IP或域名）
+	Host string `mapstructure:"host"`
+	// 目标端口（tcp、udp探测必填）
+	Port int `mapstructure:"port"`
+	// 探测周期，为0时使用probe.interval
+	Interval time.Duration `mapstructure:"interval"`
+}
+
+// DNSProbeTarget DNS解析探测目标
+type DNSProbeTarget struct {
+	// 目标名称（用于上报标识）
+	Name string `mapstructure:"name"`
+	// DNS服务器地址（host或host:port），为空时使用系统resolv.conf中的服务器
+	Resolver string `mapstructure:"resolver"`
+	// 需要解析的域名
+	Query string `mapstructure:"query"`
+	// 查询类型：A、AAAA、CNAME、MX、NS、TXT、PTR
+	Type string `mapstructure:"type"`
+	// 期望的响应码，默认NOERROR
+	ExpectRcode string `mapstructure:"expect_rcode"`
+	// 期望的应答内容（任意一项匹配即可），为空时不检查
+	Expect []string `mapstructure:"expect"`
+	// 探测周期，为0时使用probe.interval
+	Interval time.Duration `mapstructure:"interval"`
+}
+
+// CaptureConfig 抓包配置
+type CaptureConfig struct {
+	// 采集方式：capture（抓包）、counters（只读取网卡内核计数器，无需root）
+	Mode string `mapstructure:"mode"`
+	// 监控的网卡名称，与interfaces合并，两者都为空时根据路由表自动选择
+	Interface string `mapstructure:"interface"`
+	// 监控的网卡名称或通配符（如eth*）
+	Interfaces []string `mapstructure:"interfaces"`
+	// BPF过滤表达式，默认捕获IPv4和IPv6流量，包括802.1Q标签仍在帧中的VLAN流量
+	// （QinQ的内层标签、未开启VLAN卸载的发送方向、AF_PACKET后端），"ip or ip6"会丢弃这些帧
+	BPF string `mapstructure:"bpf"`
+	// 每个数据包最多捕获的字节数
+	Snaplen int `mapstructure:"snaplen"`
+	// 是否开启混杂模式
+	Promiscuous bool `mapstructure:"promiscuous"`
+	// 内核抓包缓冲区大小（字节），为0时使用libpcap默认值
+	BufferSize int `mapstructure:"buffer_size"`
+	// 读取超时时间，为0时一直阻塞到有数据包
+	Timeout time.Duration `mapstructure:"timeout"`
+	// 丢包率（0-1）超过该值时输出告警，为0时有丢包即告警
+	LossWarnThreshold float64 `mapstructure:"loss_warn_threshold"`
+	// 抓包后端：pcap（libpcap）、afpacket（Linux AF_PACKET内存映射环形缓冲区）
+	Backend string `mapstructure:"backend"`
+	// AF_PACKET后端配置
+	AFPacket AFPacketConfig `mapstructure:"afpacket"`
+	// 数据包采样配置
+	Sampling SamplingConfig `mapstructure:"sampling"`
+	// 在其他网络命名空间（容器）内抓包的网卡
+	Namespaces []NamespaceCapture `mapstructure:"namespaces"`
+}
+
+// NamespaceCapture 在其他网络命名空间内抓包的网卡（仅Linux，需要root）
+type NamespaceCapture struct {
+	// 上报时的命名空间名称，网卡名称上报为"名称/网卡"，为空时取自路径
+	Name string `mapstructure:"name"`
+	// 网络命名空间路径，如/var/run/netns/<名称>或/proc/<pid>/ns/net
+	Path string `mapstructure:"path"`
+	// 命名空间内监控的网卡名称
+	Interfaces []string `mapstructure:"interfaces"`
+}
+
+// AFPacketConfig AF_PACKET TPACKET_V3抓包配置
+type AFPacketConfig struct {
+	// 环形缓冲区每个块的大小（字节），需为页大小的整数倍
+	BlockSize int `mapstructure:"block_size"`
+	// 环形缓冲区的块数量
+	NumBlocks int `mapstructure:"num_blocks"`
+	// 处理协程数量，大于1时打开多个socket加入同一fanout组，按流哈希分配数据包
+	FanoutWorkers int `mapstructure:"fanout_workers"`
+	// fanout组ID，为0时根据进程号和网卡索引生成
+	FanoutGroup uint16 `mapstructure:"fanout_group"`
+}
+
+// SamplingConfig 数据包采样配置，带宽按采样率放大
+type SamplingConfig struct {
+	// 采样方式：none（不采样）、count（每Rate个数据包取1个）、random（每个数据包以1/Rate的概率采样）
+	Mode string `mapstructure:"mode"`
+	// 采样率
+	Rate int `mapstructure:"rate"`
+}
+
+// ProcessConfig 按进程统计流量的配置（仅Linux）
+type ProcessConfig struct {
+	// 是否将抓到的连接归属到本机进程，需要读取其他进程的/proc/<pid>/fd，通常需要root
+	Enabled bool `mapstructure:"enabled"`
+	// 每个上报周期上报流量最大的进程数量
+	Top int `mapstructure:"top"`
+}
+
+// RemoteConfig 按远端网段、ASN、国家统计流量的配置
+type RemoteConfig struct {
+	// 是否按远端网段统计上下行流量
+	Enabled bool `mapstructure:"enabled"`
+	// 每个上报周期上报流量最大的远端网段和ASN数量
+	Top int `mapstructure:"top"`
+	// 远端地址聚合的前缀长度
+	IPv4Prefix int `mapstructure:"ipv4_prefix"`
+	IPv6Prefix int `mapstructure:"ipv6_prefix"`
+	// 本地离线地址数据库，.mmdb为MaxMind格式（如GeoLite2-ASN、GeoLite2-Country），其他按CSV解析
+	Databases []string `mapstructure:"databases"`
+}
+
+// HostnameConfig 按服务器名称统计流量的配置
+type HostnameConfig struct {
+	// 是否从TLS ClientHello的SNI和明文HTTP请求的Host识别连接的服务器名称
+	Enabled bool `mapstructure:"enabled"`
+	// 每个上报周期上报流量最大的服务器名称数量
+	Top int `mapstructure:"top"`
+}
+
+// ReverseDNSConfig 从捕获的DNS应答学习地址对应名称的配置
+type ReverseDNSConfig struct {
+	// 是否从DNS应答记录地址对应的域名，用于标注远端地址和无法识别服务器名称的连接
+	Enabled bool `mapstructure:"enabled"`
+	// 应答TTL较短时记录至少保留的时间
+	MinTTL time.Duration `mapstructure:"min_ttl"`
+	// 缓存的最大地址数量
+	MaxEntries int `mapstructure:"max_entries"`
+	// 缓存中没有的公网地址是否发起PTR查询
+	PTRLookups bool `mapstructure:"ptr_lookups"`
+	// 每秒最多发起的PTR查询次数
+	PTRRate int `mapstructure:"ptr_rate"`
+}
+
+// FlowCollector 流记录收集器
+type FlowCollector struct {
+	// 收集器地址，host:port
+	Address string `mapstructure:"address"`
+	// 导出格式：v5（NetFlow v5，只导出IPv4流）、v9（NetFlow v9）、ipfix
+	Version string `mapstructure:"version"`
+}
+
+// FlowExportConfig 以NetFlow、IPFIX格式导出流记录的配置
+type FlowExportConfig struct {
+	// 是否通过UDP向收集器导出流记录，与上报服务端互不影响
+	Enabled bool `mapstructure:"enabled"`
+	// 持续有流量的流每隔该时间导出一次
+	ActiveTimeout time.Duration `mapstructure:"active_timeout"`
+	// 流超过该时间没有数据包后导出并结束
+	InactiveTimeout time.Duration `mapstructure:"inactive_timeout"`
+	// NetFlow v9的Source ID、IPFIX的Observation Domain ID，v5使用低8位作为Engine ID
+	DomainID uint32 `mapstructure:"domain_id"`
+	// 收集器，可配置多个，每个收集器收到全部流记录
+	Collectors []FlowCollector `mapstructure:"collectors"`
+}
+
+// 支持的流记录导出格式
+var flowExportVersions = []string{"v5", "v9", "ipfix"}
+
+// InterfaceDirection 单个网卡的方向判断方式
+type InterfaceDirection struct {
+	// 网卡名称
+	Name string `mapstructure:"name"`
+	// 判断方式：ip、link
+	Method string `mapstructure:"method"`
+}
+
+// DirectionConfig 流量方向判断配置
+type DirectionConfig struct {
+	// 判断方式：ip（按本机地址和内网网段）、link（按网卡MAC地址或抓包方向）
+	Method string `mapstructure:"method"`
+	// 内网网段（CIDR），与内网之间的流量计入internal，为空时使用本机网卡所在子网
+	InternalNetworks []string `mapstructure:"internal_networks"`
+	// 按网卡覆盖判断方式
+	Interfaces []InterfaceDirection `mapstructure:"interfaces"`
+}
+
+// 支持的方向判断方式
+var directionMethods = []string{"ip", "link"}
+
+// MethodFor 获取指定网卡的方向判断方式
+func (c DirectionConfig) MethodFor(device string) string {
+	for _, iface := range c.Interfaces {
+		if iface.Name == device {
+			return iface.Method
+		}
+	}
+	return c.Method
+}
+
 type Configuration struct {
 	Server struct {
 		Host          string        `mapstructure:"host"`
@@ -22,6 +219,24 @@ type Configuration struct {
 		SampleInterval time.Duration `mapstructure:"sample_interval"`
 		ReportInterval time.Duration `mapstructure:"report_interval"`
 	} `mapstructure:"monitor"`
+	Capture    CaptureConfig    `mapstructure:"capture"`
+	Direction  DirectionConfig  `mapstructure:"direction"`
+	Processes  ProcessConfig    `mapstructure:"processes"`
+	Remotes    RemoteConfig     `mapstructure:"remotes"`
+	Hostnames  HostnameConfig   `mapstructure:"hostnames"`
+	ReverseDNS ReverseDNSConfig `mapstructure:"reverse_dns"`
+	FlowExport FlowExportConfig `mapstructure:"flow_export"`
+	Probe      struct {
+		// 默认探测周期
+		Interval time.Duration `mapstructure:"interval"`
+		// 单次探测超时时间
+		Timeout time.Duration `mapstructure:"timeout"`
+		// 每轮探测发送的次数
+		Count   int           `mapstructure:"count"`
+		Targets []ProbeTarget `mapstructure:"targets"`
+		// DNS解析探测目标
+		DNS []DNSProbeTarget `mapstructure:"dns"`
+	} `mapstructure:"probe"`
 }
 
 var Config Configuration
@@ -32,6 +247,10 @@ func Init() error {
 	viper.SetConfigType("yaml")
 	viper.AddConfigPath(".")
 
+	// 未配置时保持混杂模式，与之前的行为一致
+	viper.SetDefault("capture.promiscuous", true)
+	viper.SetDefault("capture.loss_warn_threshold", 0.01)
+
 	if err := viper.ReadInConfig(); err != nil {
 		return fmt.Errorf("读取配置文件失败: %v", err)
 	}
@@ -53,6 +272,441 @@ func Init() error {
 	if Config.Server.RetryInterval == 0 {
 		Config.Server.RetryInterval = 5 * time.Minute
 	}
+	if Config.Probe.Interval == 0 {
+		Config.Probe.Interval = 30 * time.Second
+	}
+	if Config.Probe.Timeout == 0 {
+		Config.Probe.Timeout = 2 * time.Second
+	}
+	if Config.Probe.Count == 0 {
+		Config.Probe.Count = 5
+	}
+
+	if err := validateCapture(); err != nil {
+		return err
+	}
+	if err := validateDirection(); err != nil {
+		return err
+	}
+	if err := validateProcesses(); err != nil {
+		return err
+	}
+	if err := validateRemotes(); err != nil {
+		return err
+	}
+	if err := validateHostnames(); err != nil {
+		return err
+	}
+	if err := validateReverseDNS(); err != nil {
+		return err
+	}
+	if err := validateFlowExport(); err != nil {
+		return err
+	}
+	if err := validateProbeTargets(); err != nil {
+		return err
+	}
+	return validateDNSProbeTargets()
+}
+
+// ReloadSampling 重新读取配置文件中的采样配置，用于运行时调整采样率
+func ReloadSampling() (SamplingConfig, error) {
+	if err := viper.ReadInConfig(); err != nil {
+		return SamplingConfig{}, fmt.Errorf("读取配置文件失败: %v", err)
+	}
+	var sampling SamplingConfig
+	if err := viper.UnmarshalKey("capture.sampling", &sampling); err != nil {
+		return SamplingConfig{}, fmt.Errorf("解析采样配置失败: %v", err)
+	}
+	if err := validateSampling(&sampling); err != nil {
+		return SamplingConfig{}, err
+	}
+	Config.Capture.Sampling = sampling
+	return sampling, nil
+}
+
+// 抓包长度的取值范围，最小值需要容纳链路层、IP和TCP头部
+const (
+	minSnaplen     = 96
+	maxSnaplen     = 262144
+	defaultSnaplen = 65536
+)
+
+// 默认的BPF过滤表达式，VLAN标签在帧中时"ip or ip6"不匹配，需要单独匹配VLAN内的IP流量
+const defaultBPF = "ip or ip6 or (vlan and (ip or ip6))"
+
+// 支持的采集方式和抓包后端
+var (
+	captureModes    = []string{"capture", "counters"}
+	captureBackends = []string{"pcap", "afpacket"}
+)
+
+// AF_PACKET环形缓冲区默认大小：1MB的块共32个
+const (
+	defaultAFPacketBlockSize = 1 << 20
+	defaultAFPacketNumBlocks = 32
+	maxAFPacketFanoutWorkers = 64
+)
+
+// 支持的采样方式和最大采样率
+var samplingModes = []string{"none", "count", "random"}
+
+const maxSamplingRate = 65536
 
+// 校验抓包配置
+func validateCapture() error {
+	capture := &Config.Capture
+	if capture.Interface != "" && !slices.Contains(capture.Interfaces, capture.Interface) {
+		capture.Interfaces = append([]string{capture.Interface}, capture.Interfaces...)
+	}
+	for i, name := range capture.Interfaces {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("capture.interfaces[%d]为空", i)
+		}
+	}
+
+	capture.Mode = strings.ToLower(capture.Mode)
+	if capture.Mode == "" {
+		capture.Mode = "capture"
+	}
+	if !slices.Contains(captureModes, capture.Mode) {
+		return fmt.Errorf("capture.mode无效: %q（可选capture、counters）", capture.Mode)
+	}
+
+	capture.BPF = strings.TrimSpace(capture.BPF)
+	if capture.BPF == "" {
+		capture.BPF = defaultBPF
+	}
+	if capture.Snaplen == 0 {
+		capture.Snaplen = defaultSnaplen
+	}
+	if capture.Snaplen < minSnaplen || capture.Snaplen > maxSnaplen {
+		return fmt.Errorf("capture.snaplen无效: %d（取值范围%d-%d）", capture.Snaplen, minSnaplen, maxSnaplen)
+	}
+	if capture.BufferSize < 0 {
+		return fmt.Errorf("capture.buffer_size无效: %d", capture.BufferSize)
+	}
+	if capture.Timeout < 0 {
+		return fmt.Errorf("capture.timeout无效: %v", capture.Timeout)
+	}
+	if capture.LossWarnThreshold < 0 || capture.LossWarnThreshold > 1 {
+		return fmt.Errorf("capture.loss_warn_threshold无效: %v（取值范围0-1）", capture.LossWarnThreshold)
+	}
+
+	capture.Backend = strings.ToLower(capture.Backend)
+	if capture.Backend == "" {
+		capture.Backend = "pcap"
+	}
+	if !slices.Contains(captureBackends, capture.Backend) {
+		return fmt.Errorf("capture.backend无效: %q（可选pcap、afpacket）", capture.Backend)
+	}
+	if err := validateSampling(&capture.Sampling); err != nil {
+		return err
+	}
+	if err := validateNamespaces(capture.Namespaces); err != nil {
+		return err
+	}
+	return validateAFPacket(&capture.AFPacket)
+}
+
+// 校验其他网络命名空间的抓包配置，未配置名称时取自路径（/proc/<pid>/ns/net取进程号）
+func validateNamespaces(namespaces []NamespaceCapture) error {
+	for i := range namespaces {
+		namespace := &namespaces[i]
+		if namespace.Path == "" {
+			return fmt.Errorf("capture.namespaces[%d].path为空", i)
+		}
+		if len(namespace.Interfaces) == 0 {
+			return fmt.Errorf("capture.namespaces[%d].interfaces为空", i)
+		}
+		for j, name := range namespace.Interfaces {
+			if strings.TrimSpace(name) == "" {
+				return fmt.Errorf("capture.namespaces[%d].interfaces[%d]为空", i, j)
+			}
+		}
+		if namespace.Name == "" {
+			namespace.Name = filepath.Base(namespace.Path)
+			if pid, ok := strings.CutSuffix(namespace.Path, "/ns/net"); ok {
+				namespace.Name = "pid" + filepath.Base(pid)
+			}
+		}
+	}
+	return nil
+}
+
+// 上报的进程数量默认值和上限
+const (
+	defaultProcessTop = 10
+	maxProcessTop     = 100
+)
+
+// 校验按进程统计流量的配置
+func validateProcesses() error {
+	processes := &Config.Processes
+	if processes.Top == 0 {
+		processes.Top = defaultProcessTop
+	}
+	if processes.Top < 1 || processes.Top > maxProcessTop {
+		return fmt.Errorf("processes.top无效: %d（取值范围1-%d）", processes.Top, maxProcessTop)
+	}
+	return nil
+}
+
+const (
+	defaultRemoteTop        = 20
+	maxRemoteTop            = 1000
+	defaultRemoteIPv4Prefix = 24
+	defaultRemoteIPv6Prefix = 48
+)
+
+// 校验远端网段统计配置
+func validateRemotes() error {
+	remotes := &Config.Remotes
+	if remotes.Top == 0 {
+		remotes.Top = defaultRemoteTop
+	}
+	if remotes.Top < 1 || remotes.Top > maxRemoteTop {
+		return fmt.Errorf("remotes.top无效: %d（取值范围1-%d）", remotes.Top, maxRemoteTop)
+	}
+	if remotes.IPv4Prefix == 0 {
+		remotes.IPv4Prefix = defaultRemoteIPv4Prefix
+	}
+	if remotes.IPv4Prefix < 8 || remotes.IPv4Prefix > 32 {
+		return fmt.Errorf("remotes.ipv4_prefix无效: %d（取值范围8-32）", remotes.IPv4Prefix)
+	}
+	if remotes.IPv6Prefix == 0 {
+		remotes.IPv6Prefix = defaultRemoteIPv6Prefix
+	}
+	if remotes.IPv6Prefix < 16 || remotes.IPv6Prefix > 128 {
+		return fmt.Errorf("remotes.ipv6_prefix无效: %d（取值范围16-128）", remotes.IPv6Prefix)
+	}
+	for i, path := range remotes.Databases {
+		if strings.TrimSpace(path) == "" {
+			return fmt.Errorf("remotes.databases[%d]为空", i)
+		}
+	}
+	return nil
+}
+
+const (
+	defaultHostnameTop = 20
+	maxHostnameTop     = 1000
+	// 识别服务器名称建议的最小snaplen，ClientHello和HTTP请求头通常在第一个完整分段内
+	MinHostnameSnaplen = 1514
+)
+
+// 校验服务器名称统计配置
+func validateHostnames() error {
+	hostnames := &Config.Hostnames
+	if hostnames.Top == 0 {
+		hostnames.Top = defaultHostnameTop
+	}
+	if hostnames.Top < 1 || hostnames.Top > maxHostnameTop {
+		return fmt.Errorf("hostnames.top无效: %d（取值范围1-%d）", hostnames.Top, maxHostnameTop)
+	}
+	return nil
+}
+
+const (
+	defaultReverseDNSMinTTL     = time.Hour
+	defaultReverseDNSMaxEntries = 65536
+	maxReverseDNSEntries        = 1048576
+	defaultPTRRate              = 5
+	maxPTRRate                  = 100
+)
+
+// 校验反向解析配置
+func validateReverseDNS() error {
+	reverseDNS := &Config.ReverseDNS
+	if reverseDNS.MinTTL == 0 {
+		reverseDNS.MinTTL = defaultReverseDNSMinTTL
+	}
+	if reverseDNS.MinTTL < 0 {
+		return fmt.Errorf("reverse_dns.min_ttl无效: %v", reverseDNS.MinTTL)
+	}
+	if reverseDNS.MaxEntries == 0 {
+		reverseDNS.MaxEntries = defaultReverseDNSMaxEntries
+	}
+	if reverseDNS.MaxEntries < 1 || reverseDNS.MaxEntries > maxReverseDNSEntries {
+		return fmt.Errorf("reverse_dns.max_entries无效: %d（取值范围1-%d）", reverseDNS.MaxEntries, maxReverseDNSEntries)
+	}
+	if reverseDNS.PTRRate == 0 {
+		reverseDNS.PTRRate = defaultPTRRate
+	}
+	if reverseDNS.PTRRate < 1 || reverseDNS.PTRRate > maxPTRRate {
+		return fmt.Errorf("reverse_dns.ptr_rate无效: %d（取值范围1-%d）", reverseDNS.PTRRate, maxPTRRate)
+	}
+	return nil
+}
+
+const (
+	defaultFlowActiveTimeout   = time.Minute
+	defaultFlowInactiveTimeout = 15 * time.Second
+	defaultFlowExportVersion   = "ipfix"
+)
+
+// 校验流记录导出配置
+func validateFlowExport() error {
+	flowExport := &Config.FlowExport
+	if flowExport.ActiveTimeout == 0 {
+		flowExport.ActiveTimeout = defaultFlowActiveTimeout
+	}
+	if flowExport.InactiveTimeout == 0 {
+		flowExport.InactiveTimeout = defaultFlowInactiveTimeout
+	}
+	if flowExport.ActiveTimeout < time.Second {
+		return fmt.Errorf("flow_export.active_timeout无效: %v（不能小于1秒）", flowExport.ActiveTimeout)
+	}
+	if flowExport.InactiveTimeout < time.Second || flowExport.InactiveTimeout > flowExport.ActiveTimeout {
+		return fmt.Errorf("flow_export.inactive_timeout无效: %v（取值范围1秒到active_timeout）", flowExport.InactiveTimeout)
+	}
+	if flowExport.Enabled && len(flowExport.Collectors) == 0 {
+		return fmt.Errorf("flow_export已开启但未配置collectors")
+	}
+	for i := range flowExport.Collectors {
+		collector := &flowExport.Collectors[i]
+		if _, _, err := net.SplitHostPort(collector.Address); err != nil {
+			return fmt.Errorf("flow_export.collectors[%d].address无效: %q（格式为host:port）", i, collector.Address)
+		}
+		collector.Version = strings.ToLower(collector.Version)
+		if collector.Version == "" {
+			collector.Version = defaultFlowExportVersion
+		}
+		if !slices.Contains(flowExportVersions, collector.Version) {
+			return fmt.Errorf("flow_export.collectors[%d].version无效: %q（可选v5、v9、ipfix）", i, collector.Version)
+		}
+	}
+	return nil
+}
+
+// 校验数据包采样配置
+func validateSampling(sampling *SamplingConfig) error {
+	sampling.Mode = strings.ToLower(sampling.Mode)
+	if sampling.Mode == "" {
+		sampling.Mode = "none"
+	}
+	if !slices.Contains(samplingModes, sampling.Mode) {
+		return fmt.Errorf("capture.sampling.mode无效: %q（可选none、count、random）", sampling.Mode)
+	}
+	if sampling.Rate == 0 {
+		sampling.Rate = 1
+	}
+	if sampling.Rate < 1 || sampling.Rate > maxSamplingRate {
+		return fmt.Errorf("capture.sampling.rate无效: %d（取值范围1-%d）", sampling.Rate, maxSamplingRate)
+	}
+	return nil
+}
+
+// 校验AF_PACKET抓包配置
+func validateAFPacket(afpacket *AFPacketConfig) error {
+	if afpacket.BlockSize == 0 {
+		afpacket.BlockSize = defaultAFPacketBlockSize
+	}
+	if afpacket.BlockSize < 0 || afpacket.BlockSize%os.Getpagesize() != 0 {
+		return fmt.Errorf("capture.afpacket.block_size无效: %d（需为页大小%d的整数倍）", afpacket.BlockSize, os.Getpagesize())
+	}
+	if afpacket.NumBlocks == 0 {
+		afpacket.NumBlocks = defaultAFPacketNumBlocks
+	}
+	if afpacket.NumBlocks < 0 {
+		return fmt.Errorf("capture.afpacket.num_blocks无效: %d", afpacket.NumBlocks)
+	}
+	if afpacket.FanoutWorkers == 0 {
+		afpacket.FanoutWorkers = 1
+	}
+	if afpacket.FanoutWorkers < 0 || afpacket.FanoutWorkers > maxAFPacketFanoutWorkers {
+		return fmt.Errorf("capture.afpacket.fanout_workers无效: %d（取值范围1-%d）", afpacket.FanoutWorkers, maxAFPacketFanoutWorkers)
+	}
+	return nil
+}
+
+// 校验流量方向判断配置
+func validateDirection() error {
+	direction := &Config.Direction
+	direction.Method = strings.ToLower(direction.Method)
+	if direction.Method == "" {
+		direction.Method = "ip"
+	}
+	if !slices.Contains(directionMethods, direction.Method) {
+		return fmt.Errorf("direction.method无效: %q（可选ip、link）", direction.Method)
+	}
+	for i, cidr := range direction.InternalNetworks {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("direction.internal_networks[%d]无效: %v", i, err)
+		}
+	}
+	for i := range direction.Interfaces {
+		iface := &direction.Interfaces[i]
+		if iface.Name == "" {
+			return fmt.Errorf("direction.interfaces[%d]未配置name", i)
+		}
+		iface.Method = strings.ToLower(iface.Method)
+		if !slices.Contains(directionMethods, iface.Method) {
+			return fmt.Errorf("direction.interfaces[%d] %s 判断方式无效: %q（可选ip、link）", i, iface.Name, iface.Method)
+		}
+	}
+	return nil
+}
+
+// 校验探测目标配置
+func validateProbeTargets() error {
+	for i := range Config.Probe.Targets {
+		target := &Config.Probe.Targets[i]
+		if target.Host == "" {
+			return fmt.Errorf("探测目标[%d]未配置host", i)
+		}
+		switch target.Type {
+		case "icmp":
+		case "tcp", "udp":
+			if target.Port <= 0 || target.Port > 65535 {
+				return fmt.Errorf("探测目标[%d] %s 端口无效: %d", i, target.Host, target.Port)
+			}
+		default:
+			return fmt.Errorf("探测目标[%d] %s 类型无效: %q（可选icmp、tcp、udp）", i, target.Host, target.Type)
+		}
+		if target.Name == "" {
+			target.Name = target.Type + "://" + target.Host
+		}
+		if target.Interval == 0 {
+			target.Interval = Config.Probe.Interval
+		}
+	}
+	return nil
+}
+
+// 支持的DNS查询类型和响应码
+var (
+	dnsQueryTypes = []string{"A", "AAAA", "CNAME", "MX", "NS", "TXT", "PTR"}
+	dnsRcodes     = []string{"NOERROR", "FORMERR", "SERVFAIL", "NXDOMAIN", "NOTIMP", "REFUSED"}
+)
+
+// 校验DNS探测目标配置
+func validateDNSProbeTargets() error {
+	for i := range Config.Probe.DNS {
+		target := &Config.Probe.DNS[i]
+		if target.Query == "" {
+			return fmt.Errorf("DNS探测目标[%d]未配置query", i)
+		}
+		target.Type = strings.ToUpper(target.Type)
+		if target.Type == "" {
+			target.Type = "A"
+		}
+		if !slices.Contains(dnsQueryTypes, target.Type) {
+			return fmt.Errorf("DNS探测目标[%d] %s 查询类型无效: %q", i, target.Query, target.Type)
+		}
+		target.ExpectRcode = strings.ToUpper(target.ExpectRcode)
+		if target.ExpectRcode == "" {
+			target.ExpectRcode = "NOERROR"
+		}
+		if !slices.Contains(dnsRcodes, target.ExpectRcode) {
+			return fmt.Errorf("DNS探测目标[%d] %s 响应码无效: %q", i, target.Query, target.ExpectRcode)
+		}
+		if target.Name == "" {
+			target.Name = "dns://" + target.Query
+		}
+		if target.Interval == 0 {
+			target.Interval = Config.Probe.Interval
+		}
+	}
 	return nil
 }
@@ -0,0 +1,246 @@
+//go:build linux
+
+package devicemonitor
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"network-monitor-client/config"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/afpacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+)
+
+// 未配置读取超时时AF_PACKET的轮询超时，读取协程据此及时发现句柄已关闭
+const afpacketPollTimeout = 100 * time.Millisecond
+
+// afpacketCapture AF_PACKET TPACKET_V3内存映射环形缓冲区
+// 读取返回的数据直接指向环形缓冲区，读取协程使用数据期间关闭时由读取协程在下次读取或退出时释放缓冲区
+type afpacketCapture struct {
+	tpacket *afpacket.TPacket
+	snaplen int
+	// 开启混杂模式的socket，关闭后网卡自动退出混杂模式，没有时为-1
+	promiscFD int
+	// 设置后读取协程释放缓冲区并返回io.EOF
+	stop atomic.Bool
+	// 保护closed和reading，释放缓冲区和读取抓包统计互斥
+	mutex  sync.Mutex
+	closed bool
+	// 读取协程正在读取或使用上次读取的数据，此时关闭只设置stop
+	reading bool
+}
+
+// openAFPacket 打开设备的AF_PACKET环形缓冲区，fanout_workers大于1时所有句柄加入同一fanout组
+func openAFPacket(device string, capture config.CaptureConfig) ([]Capture, error) {
+	iface, err := net.InterfaceByName(device)
+	if err != nil {
+		return nil, err
+	}
+
+	workers := capture.AFPacket.FanoutWorkers
+	group := capture.AFPacket.FanoutGroup
+	if group == 0 {
+		// 同一主机上的多个进程或网卡使用不同的fanout组
+		group = uint16(os.Getpid() + iface.Index)
+	}
+	pollTimeout := afpacketPollTimeout
+	if capture.Timeout > 0 {
+		pollTimeout = capture.Timeout
+	}
+
+	var captures []Capture
+	closeAll := func() {
+		for _, c := range captures {
+			c.(*afpacketCapture).release()
+		}
+	}
+	for i := 0; i < workers; i++ {
+		tpacket, err := afpacket.NewTPacket(
+			afpacket.OptInterface(device),
+			afpacket.OptBlockSize(capture.AFPacket.BlockSize),
+			afpacket.OptNumBlocks(capture.AFPacket.NumBlocks),
+			afpacket.OptPollTimeout(pollTimeout),
+			// 网卡剥离的802.1Q标签补回数据包，与libpcap一致
+			afpacket.OptAddVLANHeader(true),
+			afpacket.TPacketVersion3)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("创建AF_PACKET环形缓冲区失败: %v", err)
+		}
+		c := &afpacketCapture{tpacket: tpacket, snaplen: capture.Snaplen, promiscFD: -1}
+		captures = append(captures, c)
+
+		if workers > 1 {
+			if err := tpacket.SetFanout(afpacket.FanoutHashWithDefrag, group); err != nil {
+				closeAll()
+				return nil, fmt.Errorf("加入AF_PACKET fanout组 %d 失败: %v", group, err)
+			}
+		}
+		if capture.BPF != "" {
+			if err := c.SetBPFFilter(capture.BPF); err != nil {
+				closeAll()
+				return nil, fmt.Errorf("BPF过滤表达式 %q 无效: %v", capture.BPF, err)
+			}
+		}
+	}
+
+	if capture.Promiscuous {
+		fd, err := enablePromisc(iface.Index)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("设置混杂模式失败: %v", err)
+		}
+		captures[0].(*afpacketCapture).promiscFD = fd
+	}
+
+	log.Printf("打开设备 %s（AF_PACKET）: 块大小=%d, 块数量=%d, fanout协程=%d, 混杂模式=%v, BPF=%q",
+		device, capture.AFPacket.BlockSize, capture.AFPacket.NumBlocks, workers, capture.Promiscuous, capture.BPF)
+	return captures, nil
+}
+
+// enablePromisc 通过PACKET_MR_PROMISC成员关系开启混杂模式，返回的socket关闭后自动退出混杂模式
+func enablePromisc(ifIndex int) (int, error) {
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW, 0)
+	if err != nil {
+		return -1, err
+	}
+	mreq := unix.PacketMreq{Ifindex: int32(ifIndex), Type: unix.PACKET_MR_PROMISC}
+	if err := unix.SetsockoptPacketMreq(fd, unix.SOL_PACKET, unix.PACKET_ADD_MEMBERSHIP, &mreq); err != nil {
+		unix.Close(fd)
+		return -1, err
+	}
+	return fd, nil
+}
+
+// ZeroCopyReadPacketData 读取下一个数据包，返回的数据在下次读取或EndRead前有效
+func (c *afpacketCapture) ZeroCopyReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		return nil, gopacket.CaptureInfo{}, io.EOF
+	}
+	c.reading = true
+	c.mutex.Unlock()
+
+	for {
+		if c.stop.Load() {
+			c.release()
+			return nil, gopacket.CaptureInfo{}, io.EOF
+		}
+		data, ci, err := c.tpacket.ZeroCopyReadPacketData()
+		if errors.Is(err, afpacket.ErrTimeout) {
+			continue
+		}
+		if err != nil {
+			c.release()
+			return nil, ci, err
+		}
+		return data, ci, nil
+	}
+}
+
+// ReadPacketData 读取下一个数据包并复制数据，复制后不再占用环形缓冲区
+func (c *afpacketCapture) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	data, ci, err := c.ZeroCopyReadPacketData()
+	if err != nil {
+		return nil, ci, err
+	}
+	data = append([]byte(nil), data...)
+	c.endRead()
+	return data, ci, nil
+}
+
+// endRead 读取协程不再使用上次读取的数据，已关闭时释放环形缓冲区
+func (c *afpacketCapture) endRead() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.reading = false
+	if c.stop.Load() {
+		c.releaseLocked()
+	}
+}
+
+// LinkType AF_PACKET原始socket返回以太网帧
+func (c *afpacketCapture) LinkType() layers.LinkType {
+	return layers.LinkTypeEthernet
+}
+
+// SetBPFFilter 使用libpcap编译BPF过滤表达式并附加到socket，超出snaplen的部分由内核截断
+func (c *afpacketCapture) SetBPFFilter(expr string) error {
+	instructions, err := pcap.CompileBPFFilter(layers.LinkTypeEthernet, c.snaplen, expr)
+	if err != nil {
+		return err
+	}
+	raw := make([]bpf.RawInstruction, len(instructions))
+	for i, ins := range instructions {
+		raw[i] = bpf.RawInstruction{Op: ins.Code, Jt: ins.Jt, Jf: ins.Jf, K: ins.K}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return fmt.Errorf("AF_PACKET句柄已关闭")
+	}
+	return c.tpacket.SetBPF(raw)
+}
+
+// Stats 自打开以来的抓包统计，内核统计的接收数量已包含丢弃的数据包
+func (c *afpacketCapture) Stats() (*pcap.Stats, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return nil, fmt.Errorf("AF_PACKET句柄已关闭")
+	}
+	_, stats, err := c.tpacket.SocketStats()
+	if err != nil {
+		return nil, err
+	}
+	return &pcap.Stats{
+		PacketsReceived: int(stats.Packets()),
+		PacketsDropped:  int(stats.Drops()),
+	}, nil
+}
+
+// Close 关闭句柄，读取协程没有读取时直接释放环形缓冲区和混杂模式socket
+// 正在读取或使用读取的数据时由读取协程释放，轮询超时内读取返回io.EOF
+func (c *afpacketCapture) Close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.stop.Store(true)
+	if !c.reading {
+		c.releaseLocked()
+	}
+}
+
+// release 释放环形缓冲区和混杂模式socket
+func (c *afpacketCapture) release() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.releaseLocked()
+}
+
+// releaseLocked 释放环形缓冲区和混杂模式socket，调用方持有mutex
+func (c *afpacketCapture) releaseLocked() {
+	c.reading = false
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.stop.Store(true)
+	c.tpacket.Close()
+	if c.promiscFD >= 0 {
+		unix.Close(c.promiscFD)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package devicemonitor
+
+import (
+	"fmt"
+
+	"network-monitor-client/config"
+)
+
+// openAFPacket 非Linux系统不支持AF_PACKET
+func openAFPacket(device string, capture config.CaptureConfig) ([]Capture, error) {
+	return nil, fmt.Errorf("AF_PACKET抓包后端仅支持Linux")
+}
@@ -0,0 +1,76 @@
+package devicemonitor
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"network-monitor-client/config"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+)
+
+// 采集方式
+const (
+	// 抓包
+	modeCapture = "capture"
+	// 只读取网卡的内核计数器
+	modeCounters = "counters"
+)
+
+// 抓包后端
+const (
+	// libpcap，所有平台可用
+	backendPcap = "pcap"
+	// AF_PACKET TPACKET_V3内存映射环形缓冲区，仅Linux可用
+	backendAFPacket = "afpacket"
+)
+
+// Capture 抓包句柄，libpcap句柄（*pcap.Handle）和AF_PACKET环形缓冲区都实现该接口
+type Capture interface {
+	gopacket.PacketDataSource
+	gopacket.ZeroCopyPacketDataSource
+	// LinkType 链路层类型
+	LinkType() layers.LinkType
+	// SetBPFFilter 设置BPF过滤表达式
+	SetBPFFilter(expr string) error
+	// Stats 自打开以来的抓包统计
+	Stats() (*pcap.Stats, error)
+	// Close 关闭句柄，使阻塞的读取返回
+	Close()
+}
+
+// EndRead 读取协程退出时调用，不再使用上次读取的数据
+// AF_PACKET句柄读取的数据指向环形缓冲区，读取期间关闭的句柄在此释放缓冲区
+func EndRead(c Capture) {
+	if r, ok := c.(interface{ endRead() }); ok {
+		r.endRead()
+	}
+}
+
+// isPermissionError 判断打开设备失败是否因为没有抓包权限（非root且没有CAP_NET_RAW）
+// libpcap只返回错误信息，需要按内容判断
+func isPermissionError(err error) bool {
+	if errors.Is(err, os.ErrPermission) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "permission") ||
+		strings.Contains(msg, "operation not permitted") ||
+		strings.Contains(msg, "access is denied")
+}
+
+// openCaptures 按配置的抓包后端打开设备
+// AF_PACKET开启fanout时每个处理协程对应一个句柄，其余情况只有一个句柄
+func openCaptures(device string, capture config.CaptureConfig) ([]Capture, error) {
+	if capture.Backend == backendAFPacket {
+		return openAFPacket(device, capture)
+	}
+	handle, err := openHandle(device, capture)
+	if err != nil {
+		return nil, err
+	}
+	return []Capture{handle}, nil
+}
@@ -0,0 +1,128 @@
+package devicemonitor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	netDevFile  = "/proc/net/dev"
+	sysClassNet = "/sys/class/net"
+	// /proc/net为/proc/self/net的链接，只反映主线程的网络命名空间，切换命名空间的线程需要读取该文件
+	threadNetDevFile = "/proc/thread-self/net/dev"
+)
+
+// InterfaceCounters 网卡的内核流量计数器，自网卡创建以来的累计值
+type InterfaceCounters struct {
+	RxBytes   uint64
+	TxBytes   uint64
+	RxPackets uint64
+	TxPackets uint64
+	RxErrors  uint64
+	TxErrors  uint64
+	RxDropped uint64
+	TxDropped uint64
+	// 接收FIFO溢出和帧错误（CRC、对齐），通常由网卡缓冲区不足或线缆、光模块问题引起
+	RxFifoErrors  uint64
+	RxFrameErrors uint64
+	// 发送FIFO错误、载波错误和冲突，载波错误和冲突多见于双工不匹配或链路异常
+	TxFifoErrors    uint64
+	TxCarrierErrors uint64
+	Collisions      uint64
+}
+
+// ReadCounters 读取网卡的内核计数器，无需root权限
+// 优先读取/sys/class/net/<网卡>/statistics，读取不到时解析/proc/net/dev
+func ReadCounters(device string) (*InterfaceCounters, error) {
+	if counters, err := readSysfsCounters(device); err == nil {
+		return counters, nil
+	}
+	return readNetDevCounters(netDevFile, device)
+}
+
+// readSysfsCounters 从sysfs读取网卡计数器
+func readSysfsCounters(device string) (*InterfaceCounters, error) {
+	dir := filepath.Join(sysClassNet, device, "statistics")
+	counters := &InterfaceCounters{}
+	for _, field := range []struct {
+		name  string
+		value *uint64
+	}{
+		{"rx_bytes", &counters.RxBytes},
+		{"tx_bytes", &counters.TxBytes},
+		{"rx_packets", &counters.RxPackets},
+		{"tx_packets", &counters.TxPackets},
+		{"rx_errors", &counters.RxErrors},
+		{"tx_errors", &counters.TxErrors},
+		{"rx_dropped", &counters.RxDropped},
+		{"tx_dropped", &counters.TxDropped},
+		{"rx_fifo_errors", &counters.RxFifoErrors},
+		{"rx_frame_errors", &counters.RxFrameErrors},
+		{"tx_fifo_errors", &counters.TxFifoErrors},
+		{"tx_carrier_errors", &counters.TxCarrierErrors},
+		{"collisions", &counters.Collisions},
+	} {
+		data, err := readSysfsValue(dir, field.name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := strconv.ParseUint(data, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("解析网卡 %s 的 %s 失败: %v", device, field.name, err)
+		}
+		*field.value = value
+	}
+	return counters, nil
+}
+
+// readNetDevCounters 从/proc/net/dev格式的文件读取网卡计数器
+// 每行格式为"网卡: 接收的bytes packets errs drop fifo frame compressed multicast 发送的bytes packets errs drop fifo colls carrier compressed"
+func readNetDevCounters(path, device string) (*InterfaceCounters, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取网卡计数器失败: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// 前两行为表头，不含冒号
+		name, rest, ok := strings.Cut(scanner.Text(), ":")
+		if !ok || strings.TrimSpace(name) != device {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) < 16 {
+			return nil, fmt.Errorf("%s 中网卡 %s 的格式无效", path, device)
+		}
+		var values [16]uint64
+		for i := range values {
+			if values[i], err = strconv.ParseUint(fields[i], 10, 64); err != nil {
+				return nil, fmt.Errorf("%s 中网卡 %s 的计数无效: %v", path, device, err)
+			}
+		}
+		return &InterfaceCounters{
+			RxBytes:         values[0],
+			RxPackets:       values[1],
+			RxErrors:        values[2],
+			RxDropped:       values[3],
+			RxFifoErrors:    values[4],
+			RxFrameErrors:   values[5],
+			TxBytes:         values[8],
+			TxPackets:       values[9],
+			TxErrors:        values[10],
+			TxDropped:       values[11],
+			TxFifoErrors:    values[12],
+			Collisions:      values[13],
+			TxCarrierErrors: values[14],
+		}, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取网卡计数器失败: %v", err)
+	}
+	return nil, fmt.Errorf("%s 中没有网卡 %s", path, device)
+}
@@ -1,42 +1,332 @@
 package devicemonitor
 
 import (
+	"fmt"
 	"log"
+	"net"
+	"sync"
+
+	"network-monitor-client/config"
 
 	"github.com/google/gopacket/pcap"
 )
 
 // 设备监控器
 type DeviceMonitor struct {
-	handle *pcap.Handle
-	device string
+	mutex sync.Mutex
+	// 抓包句柄，AF_PACKET开启fanout时有多个
+	captures []Capture
+	device   string
+	// 打开设备时的网卡索引，用于发现网卡被删除后重建，为0时不检查链路状态
+	ifIndex int
+	capture config.CaptureConfig
+	// 是否自动选择设备，重新打开时重新选择出口网卡
+	auto bool
+	// 当前句柄是否已关闭，关闭后不能再获取抓包统计
+	closed bool
+	// 重新打开设备的次数，用于判断抓包统计是否已随新句柄清零
+	generation uint64
+	// 计数器模式：不抓包，只读取网卡的内核计数器
+	counterMode bool
+	// 网卡所在的网络命名空间路径及名称，为空时为当前命名空间
+	namespace     string
+	namespaceName string
 }
 
 // 创建一个设备监控器,如果device为空，使用默认出口设备
-func NewDeviceMonitor(device string) *DeviceMonitor {
+func NewDeviceMonitor(device string, capture config.CaptureConfig) *DeviceMonitor {
+	auto := device == ""
 	// 如果device为空，使用默认出口设备
-	if device == "" {
-		device = defaultDevice()
+	if auto {
+		device = defaultDevice(config.Config.Server.Host)
+	}
+	m := &DeviceMonitor{
+		device:  device,
+		ifIndex: interfaceIndex(device),
+		capture: capture,
+		auto:    auto,
+	}
+	m.open()
+	return m
+}
+
+// NewNamespaceDeviceMonitor 创建监控其他网络命名空间内网卡的设备监控器（仅Linux，需要root）
+// 抓包句柄在命名空间内打开，上报时网卡名称为"命名空间名称/网卡"
+func NewNamespaceDeviceMonitor(namespace config.NamespaceCapture, device string, capture config.CaptureConfig) *DeviceMonitor {
+	m := &DeviceMonitor{
+		device:        device,
+		capture:       capture,
+		namespace:     namespace.Path,
+		namespaceName: namespace.Name,
+	}
+	if err := m.InNamespace(func() error {
+		m.ifIndex = interfaceIndex(device)
+		return nil
+	}); err != nil {
+		log.Fatalf("打开网络设备 %s 失败: %v", m.Name(), err)
+	}
+	m.open()
+	return m
+}
+
+// open 按采集方式打开设备，没有抓包权限时改用计数器模式
+func (m *DeviceMonitor) open() {
+	device, capture := m.device, m.capture
+	if capture.Mode == modeCounters {
+		log.Printf("网络设备 %s 使用计数器模式，只统计网卡收发速率", m.Name())
+		m.counterMode = true
+		return
+	}
+
+	var captures []Capture
+	err := m.InNamespace(func() error {
+		var err error
+		captures, err = openCaptures(device, capture)
+		return err
+	})
+	if err != nil {
+		// 没有抓包权限时改用计数器模式，其余错误（如网卡不存在）仍然退出
+		if !isPermissionError(err) {
+			log.Fatalf("打开网络设备 %s 失败: %v", m.Name(), err)
+		}
+		log.Printf("没有抓包权限，网络设备 %s 改用计数器模式，只统计网卡收发速率: %v", m.Name(), err)
+		m.counterMode = true
+		return
+	}
+	m.captures = captures
+}
+
+// InNamespace 在网卡所在的网络命名空间内执行fn
+// 通过netlink获取的网卡和地址信息在命名空间内执行即为该命名空间的视图
+func (m *DeviceMonitor) InNamespace(fn func() error) error {
+	return RunInNamespace(m.namespace, fn)
+}
+
+// Namespaced 网卡是否位于其他网络命名空间
+func (m *DeviceMonitor) Namespaced() bool {
+	return m.namespace != ""
+}
+
+// Name 获取上报使用的网卡名称，其他命名空间内的网卡为"命名空间名称/网卡"
+func (m *DeviceMonitor) Name() string {
+	device := m.GetDevice()
+	if m.namespace == "" {
+		return device
+	}
+	return m.namespaceName + "/" + device
+}
+
+// CounterMode 是否为计数器模式（不抓包，只读取网卡的内核计数器）
+func (m *DeviceMonitor) CounterMode() bool {
+	return m.counterMode
+}
+
+// ReadCounters 读取监控网卡的内核计数器
+// sysfs只反映挂载时的命名空间，其他命名空间内的网卡在命名空间内读取/proc/thread-self/net/dev
+func (m *DeviceMonitor) ReadCounters() (*InterfaceCounters, error) {
+	if m.namespace == "" {
+		return ReadCounters(m.GetDevice())
+	}
+	var counters *InterfaceCounters
+	err := m.InNamespace(func() error {
+		var err error
+		counters, err = readNetDevCounters(threadNetDevFile, m.GetDevice())
+		return err
+	})
+	return counters, err
+}
+
+// ReadLinkState 读取监控网卡的链路状态，其他命名空间内的网卡无法通过sysfs读取
+func (m *DeviceMonitor) ReadLinkState() (*LinkState, error) {
+	if m.namespace != "" {
+		return nil, fmt.Errorf("不支持读取网络命名空间内网卡 %s 的链路状态", m.Name())
+	}
+	return ReadLinkState(m.GetDevice())
+}
+
+// interfaceIndex 获取网卡索引，系统中没有同名网卡（如Windows的pcap设备名）时返回0
+func interfaceIndex(device string) int {
+	iface, err := net.InterfaceByName(device)
+	if err != nil {
+		return 0
+	}
+	return iface.Index
+}
+
+// checkLink 检查网卡是否存在且已启用，index不为0时还检查网卡是否被重建
+func checkLink(device string, index int) error {
+	iface, err := net.InterfaceByName(device)
+	if err != nil {
+		return fmt.Errorf("网卡 %s 不存在: %v", device, err)
+	}
+	if iface.Flags&net.FlagUp == 0 {
+		return fmt.Errorf("网卡 %s 已停用", device)
 	}
-	handle, err := pcap.OpenLive(device, 65536, true, pcap.BlockForever)
+	if index != 0 && iface.Index != index {
+		return fmt.Errorf("网卡 %s 已重建（索引 %d -> %d）", device, index, iface.Index)
+	}
+	return nil
+}
+
+// CheckLink 检查监控的网卡是否被删除、重建或停用
+func (m *DeviceMonitor) CheckLink() error {
+	m.mutex.Lock()
+	device, index := m.device, m.ifIndex
+	m.mutex.Unlock()
+
+	if index == 0 {
+		return nil
+	}
+	return m.InNamespace(func() error {
+		return checkLink(device, index)
+	})
+}
+
+// Interrupt 关闭当前句柄，使阻塞的读取立即返回
+func (m *DeviceMonitor) Interrupt() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, c := range m.captures {
+		c.Close()
+	}
+	m.closed = true
+}
+
+// Reopen 重新打开设备，自动选择模式下重新选择出口网卡
+func (m *DeviceMonitor) Reopen() error {
+	m.mutex.Lock()
+	device, index := m.device, m.ifIndex
+	m.mutex.Unlock()
+
+	if m.auto {
+		var err error
+		if device, err = findDefaultDevice(config.Config.Server.Host); err != nil {
+			return err
+		}
+	}
+
+	var captures []Capture
+	var ifIndex int
+	err := m.InNamespace(func() error {
+		// 网卡未恢复时不打开，避免反复中断
+		if !m.auto && index != 0 {
+			if err := checkLink(device, 0); err != nil {
+				return err
+			}
+		}
+		var err error
+		if captures, err = openCaptures(device, m.capture); err != nil {
+			return fmt.Errorf("打开网络设备 %s 失败: %v", device, err)
+		}
+		ifIndex = interfaceIndex(device)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	old := m.captures
+	m.captures = captures
+	m.device = device
+	m.ifIndex = ifIndex
+	m.closed = false
+	m.generation++
+	m.mutex.Unlock()
+
+	for _, c := range old {
+		c.Close()
+	}
+	log.Printf("重新打开网络设备 %s 成功", device)
+	return nil
+}
+
+// openHandle 按抓包配置打开设备并设置BPF过滤器
+func openHandle(device string, capture config.CaptureConfig) (*pcap.Handle, error) {
+	inactive, err := pcap.NewInactiveHandle(device)
+	if err != nil {
+		return nil, err
+	}
+	defer inactive.CleanUp()
+
+	if err := inactive.SetSnapLen(capture.Snaplen); err != nil {
+		return nil, fmt.Errorf("设置snaplen %d 失败: %v", capture.Snaplen, err)
+	}
+	if err := inactive.SetPromisc(capture.Promiscuous); err != nil {
+		return nil, fmt.Errorf("设置混杂模式失败: %v", err)
+	}
+	timeout := pcap.BlockForever
+	if capture.Timeout > 0 {
+		timeout = capture.Timeout
+	}
+	if err := inactive.SetTimeout(timeout); err != nil {
+		return nil, fmt.Errorf("设置读取超时 %v 失败: %v", capture.Timeout, err)
+	}
+	if capture.BufferSize > 0 {
+		if err := inactive.SetBufferSize(capture.BufferSize); err != nil {
+			return nil, fmt.Errorf("设置缓冲区大小 %d 失败: %v", capture.BufferSize, err)
+		}
+	}
+
+	handle, err := inactive.Activate()
 	if err != nil {
-		log.Fatal("打开网络设备失败:", err)
+		return nil, err
 	}
-	return &DeviceMonitor{
-		handle: handle,
-		device: device,
+	if capture.BPF != "" {
+		if err := handle.SetBPFFilter(capture.BPF); err != nil {
+			handle.Close()
+			return nil, fmt.Errorf("BPF过滤表达式 %q 无效: %v", capture.BPF, err)
+		}
 	}
+	log.Printf("打开设备 %s: snaplen=%d, 混杂模式=%v, 缓冲区=%d, BPF=%q",
+		device, capture.Snaplen, capture.Promiscuous, capture.BufferSize, capture.BPF)
+	return handle, nil
 }
 
-// GetHandle 获取pcap句柄
-func (m *DeviceMonitor) GetHandle() *pcap.Handle {
-	return m.handle
+// GetCaptures 获取当前的抓包句柄
+func (m *DeviceMonitor) GetCaptures() []Capture {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.captures
+}
+
+// Stats 获取当前句柄自打开以来的抓包统计（接收、内核丢弃、网卡丢弃），多个句柄时累加
+// generation在重新打开设备后变化，此时统计从0重新开始
+func (m *DeviceMonitor) Stats() (*pcap.Stats, uint64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if len(m.captures) == 0 || m.closed {
+		return nil, m.generation, fmt.Errorf("网络设备 %s 的句柄已关闭", m.device)
+	}
+	total := &pcap.Stats{}
+	for _, c := range m.captures {
+		stats, err := c.Stats()
+		if err != nil {
+			return nil, m.generation, err
+		}
+		total.PacketsReceived += stats.PacketsReceived
+		total.PacketsDropped += stats.PacketsDropped
+		total.PacketsIfDropped += stats.PacketsIfDropped
+	}
+	return total, m.generation, nil
+}
+
+// GetDevice 获取监控的设备名称
+func (m *DeviceMonitor) GetDevice() string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.device
 }
 
 // 关闭设备监控器
 func (m *DeviceMonitor) Close() {
-	if m.handle != nil {
-		m.handle.Close()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, c := range m.captures {
+		c.Close()
+	}
+	if len(m.captures) > 0 {
 		log.Printf("关闭对设备 %s 的监控\n", m.device)
 	}
+	m.closed = true
 }
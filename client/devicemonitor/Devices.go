@@ -1,33 +1,22 @@
 package devicemonitor
 
-// 多层次网络连通性检测：
-// 首先使用系统ping命令测试
-// 如果ping失败，尝试TCP连接测试（连接到目标IP的53或80端口）
-// 多个测试IP：
-// 不仅测试8.8.8.8，还加入1.1.1.1（Cloudflare DNS）和114.114.114.114（中国电信DNS）
-// 增加成功率，避免因为某个特定服务器不可用导致检测失败
-// 适配多操作系统：
-// 针对Windows、Linux和macOS分别使用不同的ping参数
-// 解决了Windows上不能直接指定网络接口的问题
-// 增强的超时处理：
-// 设置ping命令执行超时，防止命令卡死
-// 延长ping超时时间，提高检测成功率
-// 详细日志：
-// 添加了完整的网络接口信息输出
-// 显示所有pcap设备详情
-// 输出ping命令的完整结果
-// 全面的匹配方式：
-// 适配中英文系统的ping输出格式
-// 添加多种成功标志检测：TTL、time=、bytes from等
-// 备选方案：
-// 如果指定设备ping失败，尝试不指定设备直接ping
-// 如果能ping通，选择第一个非环回设备
+// 网卡选择：
+// 配置了网卡名称或通配符（如eth*）时按pcap设备列表匹配，明确指定的网卡必须存在
+// 未配置网卡时根据内核路由表（Routes.go读取/proc/net/route、/proc/net/ipv6_route）选择出口网卡：
+//   - 优先选择IPv4、IPv6默认路由的出口网卡
+//   - 没有默认路由时（如无法访问互联网的机房）选择到服务器地址的最长前缀匹配路由的出口网卡
+//
+// 路由表不存在时（非Linux系统）依次ping公共DNS服务器（ping失败时尝试TCP连接53、80端口），
+// 选择能连通的网卡；以上都失败或路由表中的网卡不在pcap设备列表中时，选择第一个有IP地址的非环回网卡
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"time"
@@ -172,14 +161,72 @@ func getAllInterfaces() {
 	}
 }
 
-// 获取默认路由出口网络设备
-func defaultDevice() string {
+// ResolveDevices 将配置的网卡名称或通配符（如eth*）解析为设备列表
+// 未配置任何网卡时根据路由表返回默认出口设备，serverHost用于没有默认路由时选择到服务器的出口
+func ResolveDevices(patterns []string, serverHost string) ([]string, error) {
+	if len(patterns) == 0 {
+		return []string{defaultDevice(serverHost)}, nil
+	}
+
+	devices, err := pcap.FindAllDevs()
+	if err != nil {
+		return nil, fmt.Errorf("获取网络设备列表失败: %v", err)
+	}
+
+	var names []string
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		isGlob := strings.ContainsAny(pattern, "*?[")
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("网卡通配符无效 %q: %v", pattern, err)
+		}
+
+		matched := false
+		for _, device := range devices {
+			if ok, _ := filepath.Match(pattern, device.Name); !ok {
+				continue
+			}
+			matched = true
+			if !seen[device.Name] {
+				seen[device.Name] = true
+				names = append(names, device.Name)
+			}
+		}
+
+		// 明确指定的网卡必须存在，通配符允许没有匹配
+		if !matched {
+			if !isGlob {
+				return nil, fmt.Errorf("未找到网卡 %s", pattern)
+			}
+			log.Printf("通配符 %s 未匹配到任何网卡", pattern)
+		}
+	}
+
+	if len(names) == 0 {
+		return nil, fmt.Errorf("配置的网卡 %v 未匹配到任何设备", patterns)
+	}
+	log.Printf("监控网卡: %v", names)
+	return names, nil
+}
+
+// 获取默认路由出口网络设备，失败时退出程序
+func defaultDevice(serverHost string) string {
+	device, err := findDefaultDevice(serverHost)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return device
+}
+
+// findDefaultDevice 选择默认路由出口网络设备
+// 优先根据内核路由表选择，读取不到路由表（非Linux系统）时才使用ping检测
+func findDefaultDevice(serverHost string) (string, error) {
 	// 首先打印所有网络接口信息，便于调试
 	getAllInterfaces()
 
 	devices, err := pcap.FindAllDevs()
 	if err != nil {
-		log.Fatal(err)
+		return "", fmt.Errorf("获取网络设备列表失败: %v", err)
 	}
 
 	log.Printf("找到%d个pcap设备\n", len(devices))
@@ -190,6 +237,29 @@ func defaultDevice() string {
 		}
 	}
 
+	name, err := routeDevice(serverHost)
+	if err == nil {
+		for _, device := range devices {
+			if device.Name == name {
+				log.Printf("根据路由表选择网络设备: %s (%s)\n", device.Name, device.Description)
+				return device.Name, nil
+			}
+		}
+		log.Printf("路由表中的出口网卡 %s 不在pcap设备列表中\n", name)
+	} else {
+		log.Printf("无法根据路由表选择网络设备: %v\n", err)
+		if _, statErr := os.Stat(ipv4RouteFile); os.IsNotExist(statErr) {
+			if name, ok := pingDevice(devices); ok {
+				return name, nil
+			}
+		}
+	}
+
+	return fallbackDevice(devices)
+}
+
+// pingDevice 通过ping公共DNS服务器检测能连接互联网的设备
+func pingDevice(devices []pcap.Interface) (string, bool) {
 	// 首先尝试找到能ping通Google DNS的设备
 	testIPs := []string{"8.8.8.8", "1.1.1.1", "114.114.114.114"}
 
@@ -199,7 +269,7 @@ func defaultDevice() string {
 				log.Printf("测试设备 %s 是否能连接到 %s...\n", device.Name, testIP)
 				if canPingIP(device.Name, testIP) {
 					log.Printf("找到能连接互联网的设备: %s (%s)\n", device.Name, device.Description)
-					return device.Name
+					return device.Name, true
 				}
 			}
 		}
@@ -212,14 +282,16 @@ func defaultDevice() string {
 		for _, device := range devices {
 			if len(device.Addresses) > 0 && device.Name != "lo" && device.Name != "localhost" {
 				log.Printf("系统能连接互联网，选择第一个非环回设备: %s\n", device.Name)
-				return device.Name
+				return device.Name, true
 			}
 		}
 	}
 
-	// 如果没有设备能ping通，退回到原来的选择逻辑
-	log.Printf("没有设备能ping通测试IP，将基于其他条件选择设备")
+	return "", false
+}
 
+// fallbackDevice 选择第一个有IP地址的非环回设备
+func fallbackDevice(devices []pcap.Interface) (string, error) {
 	// 遍历所有网络设备
 	for _, device := range devices {
 		// 检查设备是否有IP地址
@@ -227,7 +299,7 @@ func defaultDevice() string {
 			// 优先选择非回环设备
 			if device.Name != "lo" && device.Name != "localhost" {
 				log.Printf("选择网络设备: %s (%s)\n", device.Name, device.Description)
-				return device.Name
+				return device.Name, nil
 			}
 		}
 	}
@@ -235,9 +307,8 @@ func defaultDevice() string {
 	// 如果没有找到合适的设备，返回第一个设备或提示错误
 	if len(devices) > 0 {
 		log.Printf("未找到理想网络设备，使用第一个可用设备: %s\n", devices[0].Name)
-		return devices[0].Name
+		return devices[0].Name, nil
 	}
 
-	log.Fatal("未找到任何网络设备")
-	return ""
+	return "", errors.New("未找到任何网络设备")
 }
@@ -0,0 +1,60 @@
+package devicemonitor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// LinkState 网卡的链路状态，从/sys/class/net/<网卡>读取
+type LinkState struct {
+	// 运行状态：up、down、dormant、lowerlayerdown、unknown等
+	OperState string
+	// 是否检测到载波（网线或光信号）
+	Carrier bool
+	// 协商速率（Mbps），链路断开或虚拟网卡为0
+	Speed int
+	// 双工模式：full、half，无法获取时为空
+	Duplex string
+	// 载波状态变化次数（自网卡创建以来的累计值），用于发现两次读取之间的链路抖动
+	CarrierChanges uint64
+}
+
+// ReadLinkState 读取网卡的链路状态，无需root权限
+// 链路断开时内核读取speed、duplex和carrier返回错误，按未知处理
+func ReadLinkState(device string) (*LinkState, error) {
+	dir := filepath.Join(sysClassNet, device)
+	operState, err := readSysfsValue(dir, "operstate")
+	if err != nil {
+		return nil, fmt.Errorf("读取网卡 %s 的链路状态失败: %v", device, err)
+	}
+
+	state := &LinkState{OperState: operState}
+	if carrier, err := readSysfsValue(dir, "carrier"); err == nil {
+		state.Carrier = carrier == "1"
+	}
+	if speed, err := readSysfsValue(dir, "speed"); err == nil {
+		// 未知速率为-1
+		if value, err := strconv.Atoi(speed); err == nil && value > 0 {
+			state.Speed = value
+		}
+	}
+	if duplex, err := readSysfsValue(dir, "duplex"); err == nil && duplex != "unknown" {
+		state.Duplex = duplex
+	}
+	if changes, err := readSysfsValue(dir, "carrier_changes"); err == nil {
+		state.CarrierChanges, _ = strconv.ParseUint(changes, 10, 64)
+	}
+	return state, nil
+}
+
+// readSysfsValue 读取sysfs中的单值文件
+func readSysfsValue(dir, name string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,38 @@
+//go:build linux
+
+package devicemonitor
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// RunInNamespace 在指定的网络命名空间内执行fn，path为空时在当前命名空间执行
+// 在fn中创建的socket（抓包句柄）在退出命名空间后仍属于该命名空间
+func RunInNamespace(path string, fn func() error) error {
+	if path == "" {
+		return fn()
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		// 切换命名空间只影响当前线程，协程退出时不解锁，线程随之销毁，无需切换回原命名空间
+		runtime.LockOSThread()
+
+		target, err := os.Open(path)
+		if err != nil {
+			result <- fmt.Errorf("打开网络命名空间 %s 失败: %v", path, err)
+			return
+		}
+		defer target.Close()
+		if err := unix.Setns(int(target.Fd()), unix.CLONE_NEWNET); err != nil {
+			result <- fmt.Errorf("进入网络命名空间 %s 失败: %v", path, err)
+			return
+		}
+		result <- fn()
+	}()
+	return <-result
+}
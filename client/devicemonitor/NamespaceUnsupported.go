@@ -0,0 +1,13 @@
+//go:build !linux
+
+package devicemonitor
+
+import "fmt"
+
+// RunInNamespace 非Linux系统没有网络命名空间，path为空时直接执行fn
+func RunInNamespace(path string, fn func() error) error {
+	if path == "" {
+		return fn()
+	}
+	return fmt.Errorf("网络命名空间仅支持Linux")
+}
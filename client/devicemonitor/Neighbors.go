@@ -0,0 +1,74 @@
+package devicemonitor
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	arpFile = "/proc/net/arp"
+
+	// ARP表项标志位：已解析完成
+	atfComplete = 0x2
+)
+
+// readARPTable 读取/proc/net/arp中已解析的表项，返回指定网卡上IP到MAC的映射
+func readARPTable(device string) (map[string]net.HardwareAddr, error) {
+	file, err := os.Open(arpFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	neighbors := make(map[string]net.HardwareAddr)
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // 跳过表头
+	for scanner.Scan() {
+		// 字段：IP地址 硬件类型 标志 MAC地址 掩码 网卡
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 || fields[5] != device {
+			continue
+		}
+		flags, err := strconv.ParseUint(strings.TrimPrefix(fields[2], "0x"), 16, 32)
+		if err != nil || flags&atfComplete == 0 {
+			continue
+		}
+		mac, err := net.ParseMAC(fields[3])
+		if err != nil {
+			continue
+		}
+		neighbors[fields[0]] = mac
+	}
+	return neighbors, scanner.Err()
+}
+
+// GatewayMACs 获取指定网卡上IPv4网关的MAC地址
+// 网关从路由表中经该网卡的路由获取，MAC地址从ARP表获取，尚未解析的网关会被忽略
+func GatewayMACs(device string) ([]net.HardwareAddr, error) {
+	routes, err := ReadRoutes()
+	if err != nil {
+		return nil, err
+	}
+	neighbors, err := readARPTable(device)
+	if err != nil {
+		return nil, err
+	}
+
+	var macs []net.HardwareAddr
+	seen := make(map[string]bool)
+	for _, route := range routes {
+		if route.Interface != device || route.Gateway == nil || route.Gateway.To4() == nil {
+			continue
+		}
+		mac, ok := neighbors[route.Gateway.String()]
+		if !ok || seen[mac.String()] {
+			continue
+		}
+		seen[mac.String()] = true
+		macs = append(macs, mac)
+	}
+	return macs, nil
+}
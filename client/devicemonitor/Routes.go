@@ -0,0 +1,206 @@
+package devicemonitor
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	ipv4RouteFile = "/proc/net/route"
+	ipv6RouteFile = "/proc/net/ipv6_route"
+
+	// 路由标志位（linux/route.h）
+	rtfUp     = 0x0001
+	rtfReject = 0x0200
+)
+
+// Route 内核路由表项
+type Route struct {
+	// 出口网卡
+	Interface string
+	// 目的网络
+	Destination *net.IPNet
+	// 下一跳网关，直连路由为nil
+	Gateway net.IP
+	// 路由优先级，越小越优先
+	Metric uint32
+}
+
+// ReadRoutes 读取内核IPv4和IPv6路由表
+func ReadRoutes() ([]Route, error) {
+	routes, err := readIPv4Routes()
+	if err != nil {
+		return nil, err
+	}
+
+	// 内核未启用IPv6时没有ipv6_route文件
+	ipv6Routes, err := readIPv6Routes()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return append(routes, ipv6Routes...), nil
+}
+
+// readIPv4Routes 解析/proc/net/route，地址字段为本机字节序的十六进制
+func readIPv4Routes() ([]Route, error) {
+	file, err := os.Open(ipv4RouteFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var routes []Route
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // 跳过表头
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 {
+			continue
+		}
+
+		flags, err := strconv.ParseUint(fields[3], 16, 32)
+		if err != nil || flags&rtfUp == 0 || flags&rtfReject != 0 {
+			continue
+		}
+		dst, err1 := parseIPv4Hex(fields[1])
+		gateway, err2 := parseIPv4Hex(fields[2])
+		mask, err3 := parseIPv4Hex(fields[7])
+		metric, err4 := strconv.ParseUint(fields[6], 10, 32)
+		if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+			continue
+		}
+
+		route := Route{
+			Interface:   fields[0],
+			Destination: &net.IPNet{IP: dst, Mask: net.IPMask(mask)},
+			Metric:      uint32(metric),
+		}
+		if !gateway.IsUnspecified() {
+			route.Gateway = gateway
+		}
+		routes = append(routes, route)
+	}
+	return routes, scanner.Err()
+}
+
+// parseIPv4Hex 解析本机字节序的十六进制IPv4地址
+func parseIPv4Hex(s string) (net.IP, error) {
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return nil, err
+	}
+	ip := make(net.IP, net.IPv4len)
+	binary.NativeEndian.PutUint32(ip, uint32(v))
+	return ip, nil
+}
+
+// readIPv6Routes 解析/proc/net/ipv6_route
+// 字段：目的地址 前缀长度 源地址 源前缀长度 下一跳 优先级 引用计数 使用次数 标志 网卡
+func readIPv6Routes() ([]Route, error) {
+	file, err := os.Open(ipv6RouteFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var routes []Route
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+
+		flags, err := strconv.ParseUint(fields[8], 16, 32)
+		if err != nil || flags&rtfUp == 0 || flags&rtfReject != 0 {
+			continue
+		}
+		dst, err1 := hex.DecodeString(fields[0])
+		prefixLen, err2 := strconv.ParseUint(fields[1], 16, 8)
+		gateway, err3 := hex.DecodeString(fields[4])
+		metric, err4 := strconv.ParseUint(fields[5], 16, 32)
+		if err1 != nil || err2 != nil || err3 != nil || err4 != nil ||
+			len(dst) != net.IPv6len || len(gateway) != net.IPv6len {
+			continue
+		}
+
+		route := Route{
+			Interface:   fields[9],
+			Destination: &net.IPNet{IP: net.IP(dst), Mask: net.CIDRMask(int(prefixLen), 128)},
+			Metric:      uint32(metric),
+		}
+		if !net.IP(gateway).IsUnspecified() {
+			route.Gateway = net.IP(gateway)
+		}
+		routes = append(routes, route)
+	}
+	return routes, scanner.Err()
+}
+
+// LookupRoute 按最长前缀匹配查找到目的地址的路由，前缀相同时选择优先级最高的
+func LookupRoute(routes []Route, dst net.IP) (*Route, error) {
+	isIPv4 := dst.To4() != nil
+	var best *Route
+	bestLen := -1
+	for i := range routes {
+		route := &routes[i]
+		if (route.Destination.IP.To4() != nil) != isIPv4 || !route.Destination.Contains(dst) {
+			continue
+		}
+		// 非环回地址不走lo上的本地路由
+		if route.Interface == "lo" && !dst.IsLoopback() {
+			continue
+		}
+		ones, _ := route.Destination.Mask.Size()
+		if ones > bestLen || (ones == bestLen && route.Metric < best.Metric) {
+			best = route
+			bestLen = ones
+		}
+	}
+
+	if best == nil {
+		return nil, fmt.Errorf("没有到 %s 的路由", dst)
+	}
+	return best, nil
+}
+
+// routeDevice 从路由表中选择出口网卡
+// 优先使用默认路由，没有默认路由（如隔离网络）时使用到服务器地址的路由
+func routeDevice(serverHost string) (string, error) {
+	routes, err := ReadRoutes()
+	if err != nil {
+		return "", err
+	}
+
+	for _, dst := range []net.IP{net.IPv4zero, net.IPv6unspecified} {
+		if route, err := LookupRoute(routes, dst); err == nil && isDefaultRoute(route) {
+			return route.Interface, nil
+		}
+	}
+
+	if serverHost == "" {
+		return "", fmt.Errorf("路由表中没有默认路由")
+	}
+	ips, err := net.LookupIP(serverHost)
+	if err != nil {
+		return "", fmt.Errorf("解析服务器地址 %s 失败: %v", serverHost, err)
+	}
+	for _, ip := range ips {
+		if route, err := LookupRoute(routes, ip); err == nil {
+			return route.Interface, nil
+		}
+	}
+	return "", fmt.Errorf("路由表中没有默认路由，也没有到服务器 %s 的路由", serverHost)
+}
+
+// isDefaultRoute 判断是否为默认路由（前缀长度为0）
+func isDefaultRoute(route *Route) bool {
+	ones, _ := route.Destination.Mask.Size()
+	return ones == 0
+}
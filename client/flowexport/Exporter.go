@@ -0,0 +1,64 @@
+package flowexport
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// encoder 将流记录编码为导出报文，保存序号和模板发送状态，只由所属导出器调用
+type encoder interface {
+	encode(records []Record, now time.Time) [][]byte
+}
+
+// Exporter 通过UDP向单个收集器导出流记录
+type Exporter struct {
+	address string
+	version string
+	conn    net.Conn
+	encoder encoder
+}
+
+// NewExporter 创建到收集器的导出器，version为v5、v9或ipfix
+// domainID为v9的Source ID、IPFIX的Observation Domain ID，v5使用低8位作为Engine ID
+func NewExporter(address, version string, domainID uint32) (*Exporter, error) {
+	started := time.Now()
+	var enc encoder
+	switch version {
+	case VersionV5:
+		enc = &netflowV5{started: started, engineID: uint8(domainID)}
+	case VersionV9:
+		enc = newNetFlowV9(started, domainID)
+	case VersionIPFIX:
+		enc = newIPFIX(started, domainID)
+	default:
+		return nil, fmt.Errorf("不支持的流记录导出格式: %s", version)
+	}
+
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("连接流记录收集器 %s 失败: %v", address, err)
+	}
+	return &Exporter{address: address, version: version, conn: conn, encoder: enc}, nil
+}
+
+// Export 编码并发送流记录，返回第一个发送错误，发送失败的报文不重发
+func (e *Exporter) Export(records []Record) error {
+	var firstErr error
+	for _, packet := range e.encoder.encode(records, time.Now()) {
+		if _, err := e.conn.Write(packet); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("向收集器 %s 发送流记录失败: %v", e.address, err)
+		}
+	}
+	return firstErr
+}
+
+// String 收集器地址及导出格式
+func (e *Exporter) String() string {
+	return fmt.Sprintf("%s(%s)", e.address, e.version)
+}
+
+// Close 关闭到收集器的连接
+func (e *Exporter) Close() error {
+	return e.conn.Close()
+}
@@ -0,0 +1,393 @@
+package flowexport
+
+import (
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+)
+
+// collector 本地UDP收集器，接收导出器发送的报文
+type collector struct {
+	t    *testing.T
+	conn net.PacketConn
+}
+
+// newCollector 在本地随机端口启动收集器
+func newCollector(t *testing.T) *collector {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &collector{t: t, conn: conn}
+}
+
+// exporter 创建连接到该收集器的导出器
+func (c *collector) exporter(version string, domainID uint32) *Exporter {
+	c.t.Helper()
+	e, err := NewExporter(c.conn.LocalAddr().String(), version, domainID)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.t.Cleanup(func() { e.Close() })
+	return e
+}
+
+// receiveAll 接收报文直到一段时间内没有新报文
+func (c *collector) receiveAll() [][]byte {
+	var packets [][]byte
+	buf := make([]byte, 65535)
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		size, _, err := c.conn.ReadFrom(buf)
+		if err != nil {
+			return packets
+		}
+		packets = append(packets, append([]byte(nil), buf[:size]...))
+	}
+}
+
+// receive 接收报文并检查数量
+func (c *collector) receive(n int) [][]byte {
+	c.t.Helper()
+	packets := c.receiveAll()
+	if len(packets) != n {
+		c.t.Fatalf("收到 %d 个报文，期望 %d 个", len(packets), n)
+	}
+	return packets
+}
+
+// testRecords 生成count条IPv4或IPv6的TCP流记录，第i条记录的数据包数为i+1
+// 开始时间晚于导出器启动时间，v5、v9的相对时间不会被截断为0
+func testRecords(count int, ipv4 bool) []Record {
+	start := time.Now().Add(time.Millisecond).Truncate(time.Millisecond)
+	records := make([]Record, count)
+	for i := range records {
+		src, dst := netip.AddrFrom4([4]byte{10, 0, byte(i >> 8), byte(i)}), netip.AddrFrom4([4]byte{192, 0, 2, 1})
+		if !ipv4 {
+			src, dst = netip.MustParseAddr("2001:db8::1"), netip.MustParseAddr("2001:db8::2")
+		}
+		records[i] = Record{
+			Protocol: 6,
+			Src:      netip.AddrPortFrom(src, uint16(40000+i)),
+			Dst:      netip.AddrPortFrom(dst, 443),
+			TCPFlags: 0x1b,
+			Packets:  uint64(i + 1),
+			Bytes:    uint64(1500 * (i + 1)),
+			Start:    start,
+			End:      start.Add(5 * time.Second),
+		}
+	}
+	return records
+}
+
+func TestExportV5(t *testing.T) {
+	c := newCollector(t)
+	e := c.exporter(VersionV5, 7)
+
+	// IPv6记录不导出
+	records := append(testRecords(3, true), testRecords(1, false)...)
+	if err := e.Export(records); err != nil {
+		t.Fatal(err)
+	}
+	packet := c.receive(1)[0]
+	if version := binary.BigEndian.Uint16(packet[0:]); version != 5 {
+		t.Fatalf("版本 = %d，期望 5", version)
+	}
+	if count := binary.BigEndian.Uint16(packet[2:]); count != 3 {
+		t.Fatalf("记录数 = %d，期望 3", count)
+	}
+	if len(packet) != netflowV5HeaderSize+3*netflowV5RecordSize {
+		t.Fatalf("报文长度 = %d，期望 %d", len(packet), netflowV5HeaderSize+3*netflowV5RecordSize)
+	}
+	if sequence := binary.BigEndian.Uint32(packet[16:]); sequence != 0 {
+		t.Errorf("序号 = %d，期望 0", sequence)
+	}
+	if packet[21] != 7 {
+		t.Errorf("Engine ID = %d，期望 7", packet[21])
+	}
+
+	r := packet[netflowV5HeaderSize+netflowV5RecordSize:]
+	want := records[1]
+	if src := netip.AddrFrom4([4]byte(r[0:4])); src != want.Src.Addr() {
+		t.Errorf("源地址 = %v，期望 %v", src, want.Src.Addr())
+	}
+	if dst := netip.AddrFrom4([4]byte(r[4:8])); dst != want.Dst.Addr() {
+		t.Errorf("目的地址 = %v，期望 %v", dst, want.Dst.Addr())
+	}
+	if packets := binary.BigEndian.Uint32(r[16:]); packets != uint32(want.Packets) {
+		t.Errorf("数据包数 = %d，期望 %d", packets, want.Packets)
+	}
+	if bytes := binary.BigEndian.Uint32(r[20:]); bytes != uint32(want.Bytes) {
+		t.Errorf("字节数 = %d，期望 %d", bytes, want.Bytes)
+	}
+	if first, last := binary.BigEndian.Uint32(r[24:]), binary.BigEndian.Uint32(r[28:]); last-first != 5000 {
+		t.Errorf("流持续时间 = %dms，期望 5000ms", last-first)
+	}
+	if srcPort, dstPort := binary.BigEndian.Uint16(r[32:]), binary.BigEndian.Uint16(r[34:]); srcPort != want.Src.Port() || dstPort != want.Dst.Port() {
+		t.Errorf("端口 = %d -> %d，期望 %d -> %d", srcPort, dstPort, want.Src.Port(), want.Dst.Port())
+	}
+	if r[37] != want.TCPFlags || r[38] != want.Protocol {
+		t.Errorf("TCP标志位、协议 = %#x %d，期望 %#x %d", r[37], r[38], want.TCPFlags, want.Protocol)
+	}
+
+	// 序号为已导出的流记录总数，超过30条时拆分为多个报文
+	if err := e.Export(testRecords(65, true)); err != nil {
+		t.Fatal(err)
+	}
+	for i, packet := range c.receive(3) {
+		wantCount := []uint16{30, 30, 5}[i]
+		if count := binary.BigEndian.Uint16(packet[2:]); count != wantCount {
+			t.Errorf("报文 %d 记录数 = %d，期望 %d", i, count, wantCount)
+		}
+		if len(packet) != netflowV5HeaderSize+int(wantCount)*netflowV5RecordSize {
+			t.Errorf("报文 %d 长度 = %d", i, len(packet))
+		}
+		if sequence := binary.BigEndian.Uint32(packet[16:]); sequence != uint32(3+30*i) {
+			t.Errorf("报文 %d 序号 = %d，期望 %d", i, sequence, 3+30*i)
+		}
+	}
+}
+
+// decodedPacket 按模板解码的v9或IPFIX报文
+type decodedPacket struct {
+	version  uint16
+	count    uint16
+	sequence uint32
+	domainID uint32
+	// 报文中集合编号的顺序
+	setIDs []uint16
+	// 数据记录，字段编号到字段值
+	records []map[uint16][]byte
+}
+
+// decodeTemplatePacket 解码v9或IPFIX报文，templates在收到模板集时更新，数据集按其中的模板解码
+func decodeTemplatePacket(t *testing.T, packet []byte, ipfix bool, templates map[uint16][]templateField) decodedPacket {
+	t.Helper()
+	var d decodedPacket
+	d.version = binary.BigEndian.Uint16(packet[0:])
+	headerSize, templateSetID := 20, uint16(0)
+	if ipfix {
+		headerSize, templateSetID = 16, 2
+		if length := binary.BigEndian.Uint16(packet[2:]); int(length) != len(packet) {
+			t.Fatalf("IPFIX报文长度字段 = %d，实际 %d", length, len(packet))
+		}
+		d.sequence = binary.BigEndian.Uint32(packet[8:])
+		d.domainID = binary.BigEndian.Uint32(packet[12:])
+	} else {
+		d.count = binary.BigEndian.Uint16(packet[2:])
+		d.sequence = binary.BigEndian.Uint32(packet[12:])
+		d.domainID = binary.BigEndian.Uint32(packet[16:])
+	}
+
+	rest := packet[headerSize:]
+	for len(rest) > 0 {
+		if len(rest) < 4 {
+			t.Fatalf("集合头不完整，剩余 %d 字节", len(rest))
+		}
+		setID, length := binary.BigEndian.Uint16(rest[0:]), int(binary.BigEndian.Uint16(rest[2:]))
+		if length < 4 || length > len(rest) {
+			t.Fatalf("集合 %d 长度 = %d，剩余 %d 字节", setID, length, len(rest))
+		}
+		if length%4 != 0 {
+			t.Errorf("集合 %d 长度 %d 未按4字节对齐", setID, length)
+		}
+		d.setIDs = append(d.setIDs, setID)
+		body := rest[4:length]
+		rest = rest[length:]
+
+		if setID == templateSetID {
+			for len(body) > 0 {
+				id, fieldCount := binary.BigEndian.Uint16(body[0:]), int(binary.BigEndian.Uint16(body[2:]))
+				body = body[4:]
+				fields := make([]templateField, fieldCount)
+				for i := range fields {
+					fields[i] = templateField{binary.BigEndian.Uint16(body[0:]), binary.BigEndian.Uint16(body[2:])}
+					body = body[4:]
+				}
+				templates[id] = fields
+			}
+			continue
+		}
+
+		fields, ok := templates[setID]
+		if !ok {
+			t.Fatalf("数据集 %d 没有对应的模板", setID)
+		}
+		recordLength := 0
+		for _, field := range fields {
+			recordLength += int(field.length)
+		}
+		for len(body) >= recordLength {
+			record := make(map[uint16][]byte)
+			for _, field := range fields {
+				record[field.id] = body[:field.length]
+				body = body[field.length:]
+			}
+			d.records = append(d.records, record)
+		}
+		// 剩余的只能是填充
+		for _, b := range body {
+			if b != 0 {
+				t.Errorf("数据集 %d 的填充不为0", setID)
+			}
+		}
+		if len(body) >= 4 {
+			t.Errorf("数据集 %d 的填充为 %d 字节", setID, len(body))
+		}
+	}
+	return d
+}
+
+// fieldUint 以网络字节序读取字段值
+func fieldUint(b []byte) uint64 {
+	var value uint64
+	for _, v := range b {
+		value = value<<8 | uint64(v)
+	}
+	return value
+}
+
+func TestExportTemplates(t *testing.T) {
+	for _, tt := range []struct {
+		version string
+		ipfix   bool
+	}{
+		{VersionV9, false},
+		{VersionIPFIX, true},
+	} {
+		t.Run(tt.version, func(t *testing.T) {
+			c := newCollector(t)
+			e := c.exporter(tt.version, 42)
+			templates := make(map[uint16][]templateField)
+			templateSetID, wantVersion := uint16(0), uint16(9)
+			if tt.ipfix {
+				templateSetID, wantVersion = 2, 10
+			}
+
+			// IPv4、IPv6交替，导出时按地址族分为两个数据集
+			var records []Record
+			ipv4, ipv6 := testRecords(3, true), testRecords(2, false)
+			records = append(records, ipv4[0], ipv6[0], ipv4[1], ipv6[1], ipv4[2])
+			if err := e.Export(records); err != nil {
+				t.Fatal(err)
+			}
+			d := decodeTemplatePacket(t, c.receive(1)[0], tt.ipfix, templates)
+			if d.version != wantVersion || d.domainID != 42 || d.sequence != 0 {
+				t.Fatalf("报文头 版本 %d 域 %d 序号 %d，期望 %d 42 0", d.version, d.domainID, d.sequence, wantVersion)
+			}
+			// 模板集在数据集之前
+			if want := []uint16{templateSetID, templateIPv4, templateIPv6}; !slices.Equal(d.setIDs, want) {
+				t.Fatalf("集合编号 = %v，期望 %v", d.setIDs, want)
+			}
+			if len(templates[templateIPv4]) == 0 || len(templates[templateIPv6]) == 0 {
+				t.Fatalf("模板集应包含模板 %d 和 %d: %v", templateIPv4, templateIPv6, templates)
+			}
+			// v9的记录数包含2条模板记录
+			if !tt.ipfix && d.count != 2+5 {
+				t.Errorf("记录数 = %d，期望 7", d.count)
+			}
+			if len(d.records) != 5 {
+				t.Fatalf("数据记录数 = %d，期望 5", len(d.records))
+			}
+
+			got, want := d.records[1], ipv4[1]
+			if src := netip.AddrFrom4([4]byte(got[fieldIPv4Src])); src != want.Src.Addr() {
+				t.Errorf("源地址 = %v，期望 %v", src, want.Src.Addr())
+			}
+			if port := fieldUint(got[fieldSrcPort]); port != uint64(want.Src.Port()) {
+				t.Errorf("源端口 = %d，期望 %d", port, want.Src.Port())
+			}
+			if packets, bytes := fieldUint(got[fieldPackets]), fieldUint(got[fieldOctets]); packets != want.Packets || bytes != want.Bytes {
+				t.Errorf("数据包数、字节数 = %d %d，期望 %d %d", packets, bytes, want.Packets, want.Bytes)
+			}
+			if flags := fieldUint(got[fieldTCPFlags]); flags != uint64(want.TCPFlags) {
+				t.Errorf("TCP标志位 = %#x，期望 %#x", flags, want.TCPFlags)
+			}
+			if tt.ipfix {
+				if start := fieldUint(got[fieldStartMillis]); start != uint64(want.Start.UnixMilli()) {
+					t.Errorf("开始时间 = %d，期望 %d", start, want.Start.UnixMilli())
+				}
+			} else if first, last := fieldUint(got[fieldFirstSwitched]), fieldUint(got[fieldLastSwitched]); last-first != 5000 {
+				t.Errorf("流持续时间 = %dms，期望 5000ms", last-first)
+			}
+			if dst := netip.AddrFrom16([16]byte(d.records[3][fieldIPv6Dst])); dst != ipv6[0].Dst.Addr() {
+				t.Errorf("IPv6目的地址 = %v，期望 %v", dst, ipv6[0].Dst.Addr())
+			}
+
+			// 模板重发间隔内不再发送模板；v9序号为报文数，IPFIX为数据记录数
+			if err := e.Export(ipv4[:2]); err != nil {
+				t.Fatal(err)
+			}
+			d = decodeTemplatePacket(t, c.receive(1)[0], tt.ipfix, templates)
+			if want := []uint16{templateIPv4}; !slices.Equal(d.setIDs, want) {
+				t.Errorf("集合编号 = %v，期望 %v", d.setIDs, want)
+			}
+			wantSequence := uint32(1)
+			if tt.ipfix {
+				wantSequence = 5
+			}
+			if d.sequence != wantSequence {
+				t.Errorf("序号 = %d，期望 %d", d.sequence, wantSequence)
+			}
+		})
+	}
+}
+
+func TestExportTemplatesSplit(t *testing.T) {
+	for _, tt := range []struct {
+		version string
+		ipfix   bool
+	}{
+		{VersionV9, false},
+		{VersionIPFIX, true},
+	} {
+		t.Run(tt.version, func(t *testing.T) {
+			c := newCollector(t)
+			e := c.exporter(tt.version, 1)
+			templates := make(map[uint16][]templateField)
+
+			records := append(testRecords(100, true), testRecords(20, false)...)
+			if err := e.Export(records); err != nil {
+				t.Fatal(err)
+			}
+			packets := c.receiveAll()
+			if len(packets) < 2 {
+				t.Fatalf("%d 条记录只导出为 %d 个报文，期望拆分", len(records), len(packets))
+			}
+
+			var total int
+			var sequence uint32
+			for i, packet := range packets {
+				if len(packet) > maxPacketSize {
+					t.Errorf("报文 %d 长度 %d 超过 %d", i, len(packet), maxPacketSize)
+				}
+				d := decodeTemplatePacket(t, packet, tt.ipfix, templates)
+				// 只有第一个报文附带模板
+				hasTemplates := d.setIDs[0] == 0 || d.setIDs[0] == 2
+				if hasTemplates != (i == 0) {
+					t.Errorf("报文 %d 集合编号 = %v", i, d.setIDs)
+				}
+				if d.sequence != sequence {
+					t.Errorf("报文 %d 序号 = %d，期望 %d", i, d.sequence, sequence)
+				}
+				if tt.ipfix {
+					sequence += uint32(len(d.records))
+				} else {
+					sequence++
+				}
+				for _, record := range d.records {
+					total += int(fieldUint(record[fieldPackets]))
+				}
+			}
+			// 第i条记录的数据包数为i+1，按记录数求和校验没有丢失或重复
+			if want := 100*101/2 + 20*21/2; total != want {
+				t.Errorf("数据包数之和 = %d，期望 %d", total, want)
+			}
+		})
+	}
+}
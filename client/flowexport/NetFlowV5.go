@@ -0,0 +1,66 @@
+package flowexport
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+const (
+	netflowV5HeaderSize = 24
+	netflowV5RecordSize = 48
+	// 单个v5报文最多包含的记录数
+	netflowV5MaxRecords = 30
+)
+
+// netflowV5 NetFlow v5编码，格式固定，只支持IPv4，IPv6流记录不导出
+type netflowV5 struct {
+	started  time.Time
+	engineID uint8
+	// 已导出的流记录总数
+	sequence uint32
+}
+
+// encode 将IPv4流记录编码为v5报文，每个报文最多30条记录
+func (e *netflowV5) encode(records []Record, now time.Time) [][]byte {
+	var ipv4 []*Record
+	for i := range records {
+		if records[i].Src.Addr().Is4() && records[i].Dst.Addr().Is4() {
+			ipv4 = append(ipv4, &records[i])
+		}
+	}
+
+	var packets [][]byte
+	for len(ipv4) > 0 {
+		count := min(len(ipv4), netflowV5MaxRecords)
+		packet := make([]byte, netflowV5HeaderSize, netflowV5HeaderSize+count*netflowV5RecordSize)
+		binary.BigEndian.PutUint16(packet[0:], 5)
+		binary.BigEndian.PutUint16(packet[2:], uint16(count))
+		binary.BigEndian.PutUint32(packet[4:], uptimeMillis(now, e.started))
+		putHeaderTime(packet[8:], now)
+		binary.BigEndian.PutUint32(packet[12:], uint32(now.Nanosecond()))
+		binary.BigEndian.PutUint32(packet[16:], e.sequence)
+		// engine_type为0，sampling_interval为0：采样时计数已按采样率放大
+		packet[21] = e.engineID
+
+		for _, r := range ipv4[:count] {
+			src, dst := r.Src.Addr().As4(), r.Dst.Addr().As4()
+			packet = append(packet, src[:]...)
+			packet = append(packet, dst[:]...)
+			// 下一跳、输入和输出接口未知
+			packet = append(packet, 0, 0, 0, 0, 0, 0, 0, 0)
+			packet = appendUint(packet, r.Packets, 4)
+			packet = appendUint(packet, r.Bytes, 4)
+			packet = appendUint(packet, uint64(uptimeMillis(r.Start, e.started)), 4)
+			packet = appendUint(packet, uint64(uptimeMillis(r.End, e.started)), 4)
+			packet = appendUint(packet, uint64(r.Src.Port()), 2)
+			packet = appendUint(packet, uint64(r.Dst.Port()), 2)
+			packet = append(packet, 0, r.TCPFlags, r.Protocol, 0)
+			// 源、目的ASN和掩码长度未知，2字节填充
+			packet = append(packet, 0, 0, 0, 0, 0, 0, 0, 0)
+		}
+		packets = append(packets, packet)
+		e.sequence += uint32(count)
+		ipv4 = ipv4[count:]
+	}
+	return packets
+}
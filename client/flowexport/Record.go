@@ -0,0 +1,55 @@
+package flowexport
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"time"
+)
+
+// 导出格式
+const (
+	VersionV5    = "v5"
+	VersionV9    = "v9"
+	VersionIPFIX = "ipfix"
+)
+
+// 单个导出报文的最大长度，避免在常见MTU下分片
+const maxPacketSize = 1400
+
+// Record 单向流记录，采样时数据包数和字节数为按采样率放大的估算值
+type Record struct {
+	Protocol uint8
+	Src      netip.AddrPort
+	Dst      netip.AddrPort
+	// 流中所有TCP数据包标志位的或
+	TCPFlags uint8
+	Packets  uint64
+	Bytes    uint64
+	// 第一个和最后一个数据包的抓包时间
+	Start time.Time
+	End   time.Time
+}
+
+// appendUint 按指定字节数以网络字节序写入，超出范围时取该长度的最大值
+func appendUint(b []byte, value uint64, length int) []byte {
+	if length < 8 && value >= 1<<(8*length) {
+		value = 1<<(8*length) - 1
+	}
+	for i := length - 1; i >= 0; i-- {
+		b = append(b, byte(value>>(8*i)))
+	}
+	return b
+}
+
+// uptimeMillis 时间相对导出器启动时间的毫秒数，用于NetFlow的sysUptime及流开始、结束时间
+func uptimeMillis(t, started time.Time) uint32 {
+	if t.Before(started) {
+		return 0
+	}
+	return uint32(t.Sub(started).Milliseconds())
+}
+
+// putHeaderTime 写入导出时间（Unix秒）
+func putHeaderTime(b []byte, now time.Time) {
+	binary.BigEndian.PutUint32(b, uint32(now.Unix()))
+}
@@ -0,0 +1,278 @@
+package flowexport
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// 字段（信息元素）编号，NetFlow v9与IPFIX编号相同
+const (
+	fieldOctets        = 1
+	fieldPackets       = 2
+	fieldProtocol      = 4
+	fieldTCPFlags      = 6
+	fieldSrcPort       = 7
+	fieldIPv4Src       = 8
+	fieldDstPort       = 11
+	fieldIPv4Dst       = 12
+	fieldLastSwitched  = 21
+	fieldFirstSwitched = 22
+	fieldIPv6Src       = 27
+	fieldIPv6Dst       = 28
+	fieldStartMillis   = 152
+	fieldEndMillis     = 153
+)
+
+// 模板编号，数据集编号与模板编号相同
+const (
+	templateIPv4 = 256
+	templateIPv6 = 257
+)
+
+// 模板的重发间隔，UDP导出时收集器可能在启动后才开始接收，需要定期重发模板
+const templateRefreshInterval = time.Minute
+
+// templateField 模板中的字段编号及长度
+type templateField struct {
+	id     uint16
+	length uint16
+}
+
+// template 一种地址族的流记录模板
+type template struct {
+	id     uint16
+	fields []templateField
+}
+
+// recordLength 按模板编码一条记录的长度
+func (t *template) recordLength() int {
+	length := 0
+	for _, field := range t.fields {
+		length += int(field.length)
+	}
+	return length
+}
+
+// netflowV9Templates NetFlow v9模板，开始、结束时间为相对sysUptime的毫秒数
+var netflowV9Templates = [2]template{
+	{id: templateIPv4, fields: []templateField{
+		{fieldIPv4Src, 4}, {fieldIPv4Dst, 4}, {fieldSrcPort, 2}, {fieldDstPort, 2}, {fieldProtocol, 1},
+		{fieldTCPFlags, 1}, {fieldPackets, 8}, {fieldOctets, 8}, {fieldFirstSwitched, 4}, {fieldLastSwitched, 4},
+	}},
+	{id: templateIPv6, fields: []templateField{
+		{fieldIPv6Src, 16}, {fieldIPv6Dst, 16}, {fieldSrcPort, 2}, {fieldDstPort, 2}, {fieldProtocol, 1},
+		{fieldTCPFlags, 1}, {fieldPackets, 8}, {fieldOctets, 8}, {fieldFirstSwitched, 4}, {fieldLastSwitched, 4},
+	}},
+}
+
+// ipfixTemplates IPFIX模板，开始、结束时间为Unix毫秒时间戳，tcpControlBits为2字节
+var ipfixTemplates = [2]template{
+	{id: templateIPv4, fields: []templateField{
+		{fieldIPv4Src, 4}, {fieldIPv4Dst, 4}, {fieldSrcPort, 2}, {fieldDstPort, 2}, {fieldProtocol, 1},
+		{fieldTCPFlags, 2}, {fieldPackets, 8}, {fieldOctets, 8}, {fieldStartMillis, 8}, {fieldEndMillis, 8},
+	}},
+	{id: templateIPv6, fields: []templateField{
+		{fieldIPv6Src, 16}, {fieldIPv6Dst, 16}, {fieldSrcPort, 2}, {fieldDstPort, 2}, {fieldProtocol, 1},
+		{fieldTCPFlags, 2}, {fieldPackets, 8}, {fieldOctets, 8}, {fieldStartMillis, 8}, {fieldEndMillis, 8},
+	}},
+}
+
+// templateEncoder NetFlow v9和IPFIX编码，两者都由模板集和数据集组成，报文头和集合编号不同
+type templateEncoder struct {
+	ipfix     bool
+	templates [2]template
+	started   time.Time
+	// NetFlow v9的Source ID、IPFIX的Observation Domain ID
+	domainID uint32
+	// NetFlow v9为已发送的报文数，IPFIX为已发送的数据记录数
+	sequence      uint32
+	templatesSent time.Time
+}
+
+// newNetFlowV9 创建NetFlow v9编码
+func newNetFlowV9(started time.Time, domainID uint32) *templateEncoder {
+	return &templateEncoder{templates: netflowV9Templates, started: started, domainID: domainID}
+}
+
+// newIPFIX 创建IPFIX编码
+func newIPFIX(started time.Time, domainID uint32) *templateEncoder {
+	return &templateEncoder{ipfix: true, templates: ipfixTemplates, started: started, domainID: domainID}
+}
+
+// headerSize 报文头长度
+func (e *templateEncoder) headerSize() int {
+	if e.ipfix {
+		return 16
+	}
+	return 20
+}
+
+// templateSetID 模板集编号
+func (e *templateEncoder) templateSetID() uint16 {
+	if e.ipfix {
+		return 2
+	}
+	return 0
+}
+
+// encode 将流记录编码为一个或多个报文，距上次发送模板超过重发间隔时在第一个报文中附带模板
+func (e *templateEncoder) encode(records []Record, now time.Time) [][]byte {
+	if len(records) == 0 {
+		return nil
+	}
+
+	var packets [][]byte
+	var packet []byte
+	// 报文中的记录数（v9报文头的count包含模板记录）和数据记录数
+	var count, dataRecords int
+	// 当前数据集的起始位置，没有打开的数据集时为-1
+	setStart := -1
+	var setID uint16
+
+	closeSet := func() {
+		if setStart < 0 {
+			return
+		}
+		for (len(packet)-setStart)%4 != 0 {
+			packet = append(packet, 0)
+		}
+		binary.BigEndian.PutUint16(packet[setStart+2:], uint16(len(packet)-setStart))
+		setStart = -1
+	}
+	startPacket := func() {
+		packet = make([]byte, e.headerSize(), maxPacketSize)
+		count, dataRecords = 0, 0
+		if now.Sub(e.templatesSent) >= templateRefreshInterval {
+			packet = e.appendTemplates(packet)
+			count += len(e.templates)
+			e.templatesSent = now
+		}
+	}
+	finishPacket := func() {
+		closeSet()
+		e.putHeader(packet, count, now)
+		packets = append(packets, packet)
+		if e.ipfix {
+			e.sequence += uint32(dataRecords)
+		} else {
+			e.sequence++
+		}
+	}
+
+	// 按地址族排列，同一地址族的记录写入同一个数据集
+	ordered := make([]*Record, 0, len(records))
+	for _, ipv4 := range []bool{true, false} {
+		for i := range records {
+			if records[i].Src.Addr().Is4() == ipv4 {
+				ordered = append(ordered, &records[i])
+			}
+		}
+	}
+
+	startPacket()
+	for _, r := range ordered {
+		t := &e.templates[0]
+		if !r.Src.Addr().Is4() {
+			t = &e.templates[1]
+		}
+		needed := t.recordLength()
+		if setStart < 0 || setID != t.id {
+			// 新数据集的集合头及可能的填充
+			needed += 4 + 3
+		}
+		if len(packet)+needed > maxPacketSize && dataRecords > 0 {
+			finishPacket()
+			startPacket()
+		}
+		if setStart < 0 || setID != t.id {
+			closeSet()
+			setStart, setID = len(packet), t.id
+			packet = binary.BigEndian.AppendUint16(packet, t.id)
+			packet = append(packet, 0, 0)
+		}
+		packet = e.appendRecord(packet, t, r)
+		count++
+		dataRecords++
+	}
+	finishPacket()
+	return packets
+}
+
+// appendTemplates 写入包含所有模板的模板集
+func (e *templateEncoder) appendTemplates(packet []byte) []byte {
+	start := len(packet)
+	packet = binary.BigEndian.AppendUint16(packet, e.templateSetID())
+	packet = append(packet, 0, 0)
+	for _, t := range e.templates {
+		packet = binary.BigEndian.AppendUint16(packet, t.id)
+		packet = binary.BigEndian.AppendUint16(packet, uint16(len(t.fields)))
+		for _, field := range t.fields {
+			packet = binary.BigEndian.AppendUint16(packet, field.id)
+			packet = binary.BigEndian.AppendUint16(packet, field.length)
+		}
+	}
+	binary.BigEndian.PutUint16(packet[start+2:], uint16(len(packet)-start))
+	return packet
+}
+
+// appendRecord 按模板写入一条数据记录
+func (e *templateEncoder) appendRecord(packet []byte, t *template, r *Record) []byte {
+	for _, field := range t.fields {
+		length := int(field.length)
+		switch field.id {
+		case fieldIPv4Src:
+			addr := r.Src.Addr().As4()
+			packet = append(packet, addr[:]...)
+		case fieldIPv4Dst:
+			addr := r.Dst.Addr().As4()
+			packet = append(packet, addr[:]...)
+		case fieldIPv6Src:
+			addr := r.Src.Addr().As16()
+			packet = append(packet, addr[:]...)
+		case fieldIPv6Dst:
+			addr := r.Dst.Addr().As16()
+			packet = append(packet, addr[:]...)
+		case fieldSrcPort:
+			packet = appendUint(packet, uint64(r.Src.Port()), length)
+		case fieldDstPort:
+			packet = appendUint(packet, uint64(r.Dst.Port()), length)
+		case fieldProtocol:
+			packet = appendUint(packet, uint64(r.Protocol), length)
+		case fieldTCPFlags:
+			packet = appendUint(packet, uint64(r.TCPFlags), length)
+		case fieldPackets:
+			packet = appendUint(packet, r.Packets, length)
+		case fieldOctets:
+			packet = appendUint(packet, r.Bytes, length)
+		case fieldFirstSwitched:
+			packet = appendUint(packet, uint64(uptimeMillis(r.Start, e.started)), length)
+		case fieldLastSwitched:
+			packet = appendUint(packet, uint64(uptimeMillis(r.End, e.started)), length)
+		case fieldStartMillis:
+			packet = appendUint(packet, uint64(r.Start.UnixMilli()), length)
+		case fieldEndMillis:
+			packet = appendUint(packet, uint64(r.End.UnixMilli()), length)
+		}
+	}
+	return packet
+}
+
+// putHeader 写入报文头
+// v9：版本(2) 记录数(2) sysUptime(4) Unix秒(4) 报文序号(4) Source ID(4)
+// IPFIX：版本(2) 报文长度(2) 导出时间(4) 数据记录序号(4) Observation Domain ID(4)
+func (e *templateEncoder) putHeader(packet []byte, count int, now time.Time) {
+	if e.ipfix {
+		binary.BigEndian.PutUint16(packet[0:], 10)
+		binary.BigEndian.PutUint16(packet[2:], uint16(len(packet)))
+		putHeaderTime(packet[4:], now)
+		binary.BigEndian.PutUint32(packet[8:], e.sequence)
+		binary.BigEndian.PutUint32(packet[12:], e.domainID)
+		return
+	}
+	binary.BigEndian.PutUint16(packet[0:], 9)
+	binary.BigEndian.PutUint16(packet[2:], uint16(count))
+	binary.BigEndian.PutUint32(packet[4:], uptimeMillis(now, e.started))
+	putHeaderTime(packet[8:], now)
+	binary.BigEndian.PutUint32(packet[12:], e.sequence)
+	binary.BigEndian.PutUint32(packet[16:], e.domainID)
+}
@@ -0,0 +1,187 @@
+package geoip
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CSV数据库各字段可用的列名（不区分大小写），兼容MaxMind GeoLite2 CSV和iptoasn等常见格式
+var csvColumns = map[string][]string{
+	"network":      {"network", "cidr", "prefix"},
+	"start":        {"start", "start_ip", "range_start", "first_ip"},
+	"end":          {"end", "end_ip", "range_end", "last_ip"},
+	"asn":          {"asn", "as_number", "autonomous_system_number"},
+	"organization": {"organization", "org", "as_name", "as_description", "autonomous_system_organization"},
+	"country":      {"country", "country_code", "country_iso_code"},
+	"label":        {"label", "category", "group"},
+}
+
+// addrRange 数据库中的一个地址段
+type addrRange struct {
+	start, end netip.Addr
+	info       Info
+}
+
+// csvDatabase 按起始地址排序的地址段
+type csvDatabase struct {
+	ranges []addrRange
+	// maxEnd[i]为前i+1个地址段中最大的结束地址，用于在嵌套的地址段中向前查找
+	maxEnd []netip.Addr
+}
+
+// openCSV 加载CSV数据库（.tsv按制表符分隔），首行为列名，地址段用network（CIDR）或start、end列表示
+// 地址段可以嵌套（如在运营商网段中单独标注合作伙伴的网段），查询时取起始地址最大的匹配段
+func openCSV(path string) (*csvDatabase, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	reader.Comment = '#'
+	if strings.EqualFold(filepath.Ext(path), ".tsv") {
+		reader.Comma = '\t'
+		reader.LazyQuotes = true
+	}
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("读取列名失败: %v", err)
+	}
+	columns := make(map[string]int)
+	for field, names := range csvColumns {
+		for i, name := range header {
+			if containsFold(names, strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))) {
+				columns[field] = i
+				break
+			}
+		}
+	}
+	_, hasNetwork := columns["network"]
+	_, hasStart := columns["start"]
+	_, hasEnd := columns["end"]
+	if !hasNetwork && !(hasStart && hasEnd) {
+		return nil, fmt.Errorf("缺少network列或start、end列")
+	}
+
+	db := &csvDatabase{}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("第%d行格式无效: %v", line, err)
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		var r addrRange
+		if hasNetwork {
+			prefix, err := netip.ParsePrefix(field("network"))
+			if err != nil {
+				return nil, fmt.Errorf("第%d行网段无效: %v", line, err)
+			}
+			r.start, r.end = prefixRange(prefix)
+		} else {
+			r.start, err = netip.ParseAddr(field("start"))
+			if err == nil {
+				r.end, err = netip.ParseAddr(field("end"))
+			}
+			if err != nil {
+				return nil, fmt.Errorf("第%d行地址无效: %v", line, err)
+			}
+			r.start, r.end = r.start.Unmap(), r.end.Unmap()
+			if r.start.BitLen() != r.end.BitLen() || r.end.Less(r.start) {
+				return nil, fmt.Errorf("第%d行地址范围无效: %s-%s", line, r.start, r.end)
+			}
+		}
+		// iptoasn用AS0表示未分配的地址段
+		if asn := strings.TrimPrefix(strings.ToUpper(field("asn")), "AS"); asn != "" {
+			value, err := strconv.ParseUint(asn, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("第%d行ASN无效: %q", line, field("asn"))
+			}
+			r.info.ASN = uint32(value)
+		}
+		r.info.Organization = field("organization")
+		r.info.Country = strings.ToUpper(field("country"))
+		if r.info.Country == "NONE" {
+			r.info.Country = ""
+		}
+		r.info.Label = field("label")
+		if r.info == (Info{}) {
+			continue
+		}
+		db.ranges = append(db.ranges, r)
+	}
+
+	// 起始地址相同时范围大的在前，查询时优先匹配范围小的
+	sort.SliceStable(db.ranges, func(i, j int) bool {
+		a, b := &db.ranges[i], &db.ranges[j]
+		if c := a.start.Compare(b.start); c != 0 {
+			return c < 0
+		}
+		return b.end.Less(a.end)
+	})
+	db.maxEnd = make([]netip.Addr, len(db.ranges))
+	for i, r := range db.ranges {
+		db.maxEnd[i] = r.end
+		if i > 0 && r.end.Less(db.maxEnd[i-1]) {
+			db.maxEnd[i] = db.maxEnd[i-1]
+		}
+	}
+	return db, nil
+}
+
+// lookup 查找包含地址且起始地址最大的地址段
+func (d *csvDatabase) lookup(addr netip.Addr) (Info, bool) {
+	i := sort.Search(len(d.ranges), func(i int) bool {
+		return addr.Less(d.ranges[i].start)
+	}) - 1
+	for ; i >= 0 && !d.maxEnd[i].Less(addr); i-- {
+		if r := &d.ranges[i]; !r.end.Less(addr) {
+			return r.info, true
+		}
+	}
+	return Info{}, false
+}
+
+// prefixRange 网段的第一个和最后一个地址，IPv4映射的IPv6网段（如::ffff:1.2.3.0/120）按IPv4处理
+func prefixRange(prefix netip.Prefix) (netip.Addr, netip.Addr) {
+	if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+	}
+	prefix = prefix.Masked()
+	start := prefix.Addr()
+	raw := start.AsSlice()
+	for bit := prefix.Bits(); bit < len(raw)*8; bit++ {
+		raw[bit/8] |= 0x80 >> (bit % 8)
+	}
+	end, _ := netip.AddrFromSlice(raw)
+	return start, end
+}
+
+// containsFold 不区分大小写地判断列表中是否包含name
+func containsFold(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package geoip
+
+import (
+	"fmt"
+	"net/netip"
+	"path/filepath"
+	"strings"
+)
+
+// Info 地址所属的自治系统、国家和自定义标签，数据库中没有的字段为空
+type Info struct {
+	ASN          uint32
+	Organization string
+	// ISO 3166-1两位国家代码
+	Country string
+	// CSV数据库中的自定义分类，如云厂商、合作伙伴
+	Label string
+}
+
+// merge 用other中非空的字段补充当前结果，先加载的数据库优先
+func (i *Info) merge(other Info) {
+	if i.ASN == 0 {
+		i.ASN, i.Organization = other.ASN, other.Organization
+	}
+	if i.Country == "" {
+		i.Country = other.Country
+	}
+	if i.Label == "" {
+		i.Label = other.Label
+	}
+}
+
+// source 单个地址数据库
+type source interface {
+	lookup(addr netip.Addr) (Info, bool)
+}
+
+// Database 本地离线地址数据库，可同时加载多个文件（如ASN库和国家库）
+type Database struct {
+	sources []source
+}
+
+// Open 加载数据库文件，按扩展名识别格式：.mmdb为MaxMind格式，其他按CSV解析
+func Open(paths []string) (*Database, error) {
+	db := &Database{}
+	for _, path := range paths {
+		var src source
+		var err error
+		if strings.EqualFold(filepath.Ext(path), ".mmdb") {
+			src, err = openMMDB(path)
+		} else {
+			src, err = openCSV(path)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("加载地址数据库 %s 失败: %v", path, err)
+		}
+		db.sources = append(db.sources, src)
+	}
+	return db, nil
+}
+
+// Lookup 查询地址所属的ASN、国家和标签，合并各数据库的结果
+func (d *Database) Lookup(addr netip.Addr) Info {
+	var info Info
+	if d == nil {
+		return info
+	}
+	addr = addr.Unmap()
+	for _, src := range d.sources {
+		if found, ok := src.lookup(addr); ok {
+			info.merge(found)
+		}
+	}
+	return info
+}
@@ -0,0 +1,361 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+	"sync"
+)
+
+// 元数据位于文件末尾128KB内，以该标记开头
+var mmdbMetadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+const mmdbMetadataMaxSize = 128 * 1024
+
+// 搜索树与数据区之间的16字节分隔
+const mmdbDataSeparator = 16
+
+// 数据区字段类型
+const (
+	mmdbExtended = iota
+	mmdbPointer
+	mmdbString
+	mmdbDouble
+	mmdbBytes
+	mmdbUint16
+	mmdbUint32
+	mmdbMap
+	mmdbInt32
+	mmdbUint64
+	mmdbUint128
+	mmdbArray
+	mmdbContainer
+	mmdbEndMarker
+	mmdbBool
+	mmdbFloat
+)
+
+// mmdbDatabase MaxMind DB格式数据库（GeoLite2/GeoIP2的ASN、Country、City库及兼容格式）
+// 整个文件读入内存，按二叉搜索树逐位查找地址对应的数据记录
+type mmdbDatabase struct {
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	// 数据区起始位置
+	dataStart uint
+	// IPv6库中IPv4地址（::/96）对应的节点
+	ipv4Start uint
+	// 已解析的记录，同一网段的地址共享记录
+	cacheMutex sync.Mutex
+	cache      map[uint]Info
+}
+
+// openMMDB 加载MaxMind DB格式数据库
+func openMMDB(path string) (*mmdbDatabase, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	searchFrom := 0
+	if len(data) > mmdbMetadataMaxSize {
+		searchFrom = len(data) - mmdbMetadataMaxSize
+	}
+	index := bytes.LastIndex(data[searchFrom:], mmdbMetadataMarker)
+	if index < 0 {
+		return nil, fmt.Errorf("不是MaxMind DB格式：找不到元数据")
+	}
+	metadataStart := uint(searchFrom + index + len(mmdbMetadataMarker))
+
+	metadata := &mmdbDecoder{data: data[metadataStart:]}
+	value, _, err := metadata.decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("解析元数据失败: %v", err)
+	}
+	fields, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("元数据格式无效")
+	}
+	db := &mmdbDatabase{
+		data:       data,
+		nodeCount:  uint(toUint(fields["node_count"])),
+		recordSize: uint(toUint(fields["record_size"])),
+		ipVersion:  uint(toUint(fields["ip_version"])),
+		cache:      make(map[uint]Info),
+	}
+	if db.recordSize != 24 && db.recordSize != 28 && db.recordSize != 32 {
+		return nil, fmt.Errorf("不支持的记录长度: %d", db.recordSize)
+	}
+	if db.ipVersion != 4 && db.ipVersion != 6 {
+		return nil, fmt.Errorf("不支持的IP版本: %d", db.ipVersion)
+	}
+	treeSize := db.nodeCount * db.recordSize / 4
+	db.dataStart = treeSize + mmdbDataSeparator
+	if db.dataStart > metadataStart {
+		return nil, fmt.Errorf("搜索树大小超出文件范围")
+	}
+
+	if db.ipVersion == 6 {
+		for i := 0; i < 96 && db.ipv4Start < db.nodeCount; i++ {
+			db.ipv4Start = db.readNode(db.ipv4Start, 0)
+		}
+	}
+	return db, nil
+}
+
+// readNode 读取节点的左（bit为0）或右记录
+func (d *mmdbDatabase) readNode(node uint, bit uint) uint {
+	b := d.data[node*d.recordSize/4:]
+	switch d.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+// lookup 沿搜索树查找地址，叶子记录指向数据区
+func (d *mmdbDatabase) lookup(addr netip.Addr) (Info, bool) {
+	if addr.Is6() && d.ipVersion == 4 {
+		return Info{}, false
+	}
+	raw := addr.AsSlice()
+	node := uint(0)
+	if addr.Is4() && d.ipVersion == 6 {
+		node = d.ipv4Start
+	}
+	for i := 0; i < len(raw)*8 && node < d.nodeCount; i++ {
+		bit := uint(raw[i/8]>>(7-i%8)) & 1
+		node = d.readNode(node, bit)
+	}
+	// 等于节点数表示没有数据，小于表示树结构损坏
+	if node <= d.nodeCount {
+		return Info{}, false
+	}
+	offset := node - d.nodeCount - mmdbDataSeparator
+	d.cacheMutex.Lock()
+	defer d.cacheMutex.Unlock()
+	if info, ok := d.cache[offset]; ok {
+		return info, info != (Info{})
+	}
+
+	decoder := &mmdbDecoder{data: d.data[d.dataStart:]}
+	value, _, err := decoder.decode(offset, 0)
+	var info Info
+	if record, ok := value.(map[string]any); ok && err == nil {
+		info = recordInfo(record)
+	}
+	d.cache[offset] = info
+	return info, info != (Info{})
+}
+
+// recordInfo 从GeoLite2/GeoIP2记录中取出ASN、组织和国家代码，没有所在国家时使用注册国家
+func recordInfo(record map[string]any) Info {
+	info := Info{ASN: uint32(toUint(record["autonomous_system_number"]))}
+	info.Organization, _ = record["autonomous_system_organization"].(string)
+	for _, key := range []string{"country", "registered_country"} {
+		if country, ok := record[key].(map[string]any); ok {
+			if code, ok := country["iso_code"].(string); ok && code != "" {
+				info.Country = code
+				break
+			}
+		}
+	}
+	return info
+}
+
+// toUint 将数据区中的无符号整数转换为uint64，其他类型返回0
+func toUint(value any) uint64 {
+	switch v := value.(type) {
+	case uint64:
+		return v
+	case int64:
+		if v >= 0 {
+			return uint64(v)
+		}
+	}
+	return 0
+}
+
+// 数据嵌套的最大深度，防止损坏的文件导致无限递归
+const mmdbMaxDepth = 32
+
+// mmdbDecoder 解码数据区，指针为相对数据区起始位置的偏移
+type mmdbDecoder struct {
+	data []byte
+}
+
+// decode 解码offset处的字段，返回值及下一个字段的位置
+// 整数统一解码为uint64（int32为int64），map为map[string]any，array为[]any
+func (d *mmdbDecoder) decode(offset uint, depth int) (any, uint, error) {
+	if depth > mmdbMaxDepth {
+		return nil, 0, fmt.Errorf("数据嵌套过深")
+	}
+	ctrl, err := d.byteAt(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset++
+	kind := uint(ctrl >> 5)
+
+	if kind == mmdbPointer {
+		pointer, next, err := d.pointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(pointer, depth+1)
+		return value, next, err
+	}
+
+	if kind == mmdbExtended {
+		extended, err := d.byteAt(offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		kind = 7 + uint(extended)
+		offset++
+	}
+
+	size := uint(ctrl & 0x1F)
+	if size >= 29 {
+		n := size - 28
+		b, err := d.bytes(offset, n)
+		if err != nil {
+			return nil, 0, err
+		}
+		offset += n
+		var extra uint
+		for _, v := range b {
+			extra = extra<<8 | uint(v)
+		}
+		switch size {
+		case 29:
+			size = 29 + extra
+		case 30:
+			size = 285 + extra
+		default:
+			size = 65821 + extra
+		}
+	}
+
+	switch kind {
+	case mmdbMap:
+		values := make(map[string]any, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("map的键不是字符串")
+			}
+			value, next, err := d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			values[name] = value
+			offset = next
+		}
+		return values, offset, nil
+	case mmdbArray:
+		values := make([]any, 0, size)
+		for i := uint(0); i < size; i++ {
+			value, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			values = append(values, value)
+			offset = next
+		}
+		return values, offset, nil
+	case mmdbBool:
+		return size != 0, offset, nil
+	case mmdbContainer, mmdbEndMarker:
+		return nil, offset, nil
+	}
+
+	b, err := d.bytes(offset, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset += size
+	switch kind {
+	case mmdbString:
+		return string(b), offset, nil
+	case mmdbBytes:
+		return append([]byte(nil), b...), offset, nil
+	case mmdbDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("double长度无效: %d", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case mmdbFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("float长度无效: %d", size)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), offset, nil
+	case mmdbUint16, mmdbUint32, mmdbUint64, mmdbUint128:
+		// uint128只保留低64位，ASN和国家库中不会出现
+		var value uint64
+		for _, v := range b {
+			value = value<<8 | uint64(v)
+		}
+		return value, offset, nil
+	case mmdbInt32:
+		var value uint32
+		for _, v := range b {
+			value = value<<8 | uint32(v)
+		}
+		return int64(int32(value)), offset, nil
+	}
+	return nil, 0, fmt.Errorf("未知的字段类型: %d", kind)
+}
+
+// pointer 解析指针，长度由控制字节的第4、5位决定
+func (d *mmdbDecoder) pointer(ctrl byte, offset uint) (uint, uint, error) {
+	n := uint(ctrl>>3)&0x3 + 1
+	b, err := d.bytes(offset, n)
+	if err != nil {
+		return 0, 0, err
+	}
+	var value uint
+	if n < 4 {
+		value = uint(ctrl & 0x7)
+	}
+	for _, v := range b {
+		value = value<<8 | uint(v)
+	}
+	switch n {
+	case 2:
+		value += 2048
+	case 3:
+		value += 526336
+	}
+	return value, offset + n, nil
+}
+
+// byteAt 读取单个字节，越界时返回错误
+func (d *mmdbDecoder) byteAt(offset uint) (byte, error) {
+	if offset >= uint(len(d.data)) {
+		return 0, fmt.Errorf("数据偏移越界: %d", offset)
+	}
+	return d.data[offset], nil
+}
+
+// bytes 读取n个字节，越界时返回错误
+func (d *mmdbDecoder) bytes(offset, n uint) ([]byte, error) {
+	if offset+n > uint(len(d.data)) {
+		return nil, fmt.Errorf("数据偏移越界: %d", offset+n)
+	}
+	return d.data[offset : offset+n], nil
+}
@@ -5,6 +5,7 @@ go 1.23.6
 require (
 	github.com/google/gopacket v1.1.19
 	github.com/quic-go/quic-go v0.50.0
+	golang.org/x/net v0.33.0
 )
 
 require (
@@ -26,7 +27,6 @@ require (
 	golang.org/x/crypto v0.32.0 // indirect
 	golang.org/x/exp v0.0.0-20240506185415-9bf2ced13842 // indirect
 	golang.org/x/mod v0.18.0 // indirect
-	golang.org/x/net v0.33.0 // indirect
 	golang.org/x/sync v0.10.0 // indirect
 	golang.org/x/text v0.21.0 // indirect
 	golang.org/x/tools v0.22.0 // indirect
@@ -35,5 +35,5 @@ require (
 
 require (
 	github.com/spf13/viper v1.20.0
-	golang.org/x/sys v0.29.0 // indirect
+	golang.org/x/sys v0.29.0
 )
@@ -4,10 +4,13 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"flag"
+	"io"
 	"log"
 	"network-monitor-client/bandwidthmonitor"
 	"network-monitor-client/config"
 	"network-monitor-client/devicemonitor"
+	"network-monitor-client/probemonitor"
 	"os"
 	"os/signal"
 	"sync"
@@ -25,24 +28,77 @@ type BandwidthData struct {
 	DownloadSpeed         float64   `json:"download_speed"`
 	AvgUploadPacketSize   float64   `json:"avg_upload_packet_size"`
 	AvgDownloadPacketSize float64   `json:"avg_download_packet_size"`
+	// 内网（东西向）流量速率，不计入上下行
+	InternalSpeed float64 `json:"internal_speed"`
+	// 按网关MAC区分的主机WAN/LAN带宽
+	Segments *bandwidthmonitor.SegmentStats `json:"segments,omitempty"`
+	// 各网卡的带宽统计，上面的速率字段为主机汇总
+	Interfaces []bandwidthmonitor.InterfaceStats `json:"interfaces,omitempty"`
+	// TCP健康指标（重传、零窗口、RST、SYN）
+	TCPHealth *bandwidthmonitor.TCPHealthStats `json:"tcp_health,omitempty"`
+	// 基于TCP握手的被动RTT统计
+	TCPRTT *bandwidthmonitor.TCPRTTStats `json:"tcp_rtt,omitempty"`
+	// 主动探测结果（时延、抖动、丢包）
+	Probes []probemonitor.ProbeResult `json:"probes,omitempty"`
+	// 被动DNS统计（查询、错误应答、时延）
+	DNS *bandwidthmonitor.DNSStats `json:"dns,omitempty"`
+	// DNS解析探测结果
+	DNSProbes []probemonitor.DNSProbeResult `json:"dns_probes,omitempty"`
+	// HTTP拨测结果
+	HTTPChecks []probemonitor.HTTPCheckResult `json:"http_checks,omitempty"`
+	// 抓包中断事件（网卡停用、删除或重建）
+	CaptureGaps []bandwidthmonitor.CaptureGap `json:"capture_gaps,omitempty"`
+	// 各网卡的抓包统计（接收、内核丢弃、网卡丢弃）
+	CaptureStats []bandwidthmonitor.CaptureStats `json:"capture_stats,omitempty"`
+	// 各网卡按VLAN和隧道（VXLAN、GENEVE、GRE、IP-in-IP）区分的流量
+	Encapsulation []bandwidthmonitor.EncapsulationStats `json:"encapsulation,omitempty"`
+	// 采样方式及主机汇总速率的误差范围，不采样时为空
+	Sampling *bandwidthmonitor.SamplingStats `json:"sampling,omitempty"`
+	// 各网卡的错误、丢弃、冲突计数及链路状态（运行状态、速率、双工）
+	InterfaceHealth []bandwidthmonitor.InterfaceHealthStats `json:"interface_health,omitempty"`
+	// 流量最大的本机进程（进程号、名称、命令行、用户、容器），进程号0为无法归属的流量
+	Processes []bandwidthmonitor.ProcessTraffic `json:"processes,omitempty"`
+	// 按容器（不在容器内时按cgroup）和网络命名空间汇总的进程流量
+	Containers []bandwidthmonitor.ContainerTraffic `json:"containers,omitempty"`
+	// 流量最大的远端网段及按ASN、国家、自定义分类汇总的流量（开启按远端统计时上报）
+	Remotes *bandwidthmonitor.RemoteStats `json:"remotes,omitempty"`
+	// 流量最大的服务器名称（TLS SNI、HTTP Host），名称为空的为无法识别的流量
+	Hostnames []bandwidthmonitor.HostnameTraffic `json:"hostnames,omitempty"`
 }
 
+// ServerMessage 服务器在上报数据流上返回的消息
+type ServerMessage struct {
+	// 需要执行的HTTP拨测任务
+	HTTPChecks []probemonitor.HTTPCheck `json:"http_checks,omitempty"`
+}
+
+const (
+	// 等待服务器返回消息的超时时间
+	serverMessageTimeout = 2 * time.Second
+	// 断线或发送失败时缓存的最大上报数量，按默认1秒的上报间隔约为5分钟
+	maxPendingReports = 300
+)
+
 type Client struct {
-	conn          quic.Connection
-	monitor       *bandwidthmonitor.BandwidthMonitor
-	deviceMonitor *devicemonitor.DeviceMonitor
-	failureCount  int
-	mutex         sync.Mutex
-	isMonitoring  bool
-	lastSendTime  time.Time
+	conn           quic.Connection
+	monitor        *bandwidthmonitor.HostMonitor
+	deviceMonitors []*devicemonitor.DeviceMonitor
+	probeMonitor   *probemonitor.ProbeMonitor
+	failureCount   int
+	mutex          sync.Mutex
+	isMonitoring   bool
+	lastSendTime   time.Time
+	// 发送失败或跳过发送的上报数据，下次发送时按顺序补发
+	pending []BandwidthData
 }
 
-func NewClient(m *bandwidthmonitor.BandwidthMonitor, d *devicemonitor.DeviceMonitor) *Client {
+func NewClient(m *bandwidthmonitor.HostMonitor, d []*devicemonitor.DeviceMonitor, p *probemonitor.ProbeMonitor) *Client {
 	return &Client{
-		monitor:       m,
-		deviceMonitor: d,
-		isMonitoring:  false,
-		lastSendTime:  time.Time{},
+		monitor:        m,
+		deviceMonitors: d,
+		probeMonitor:   p,
+		isMonitoring:   false,
+		lastSendTime:   time.Time{},
 	}
 }
 
@@ -95,8 +151,19 @@ func (c *Client) connect() error {
 	return nil
 }
 
+// canSend 是否可以发送上报，不能发送时不取出各统计的计数，留到下次上报
+func (c *Client) canSend() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// 确保发送间隔至少为500ms
+	return c.isMonitoring && c.conn != nil && time.Since(c.lastSendTime) >= 500*time.Millisecond
+}
+
+// sendData 发送上报数据，先按顺序补发之前未发送成功的上报，未发送成功的数据留到下次补发
 func (c *Client) sendData(data BandwidthData) error {
 	c.mutex.Lock()
+	c.queueReports(data)
 	if !c.isMonitoring || c.conn == nil {
 		c.mutex.Unlock()
 		return nil
@@ -110,18 +177,21 @@ func (c *Client) sendData(data BandwidthData) error {
 	}
 
 	conn := c.conn
+	reports := c.pending
+	c.pending = nil
 	c.mutex.Unlock()
 
-	stream, err := conn.OpenStreamSync(context.Background())
-	if err != nil {
-		c.handleFailure()
-		return err
-	}
-	defer stream.Close()
-
-	if err := json.NewEncoder(stream).Encode(data); err != nil {
-		c.handleFailure()
-		return err
+	for i, report := range reports {
+		if err := c.sendReport(conn, report); err != nil {
+			c.mutex.Lock()
+			pending := c.pending
+			c.pending = nil
+			c.queueReports(reports[i:]...)
+			c.queueReports(pending...)
+			c.mutex.Unlock()
+			c.handleFailure()
+			return err
+		}
 	}
 
 	c.mutex.Lock()
@@ -129,12 +199,110 @@ func (c *Client) sendData(data BandwidthData) error {
 	c.lastSendTime = now
 	c.mutex.Unlock()
 
+	if len(reports) > 1 {
+		log.Printf("补发未发送成功的上报数据: %d 条", len(reports)-1)
+	}
 	log.Printf("数据发送成功 - 上行: %.2f Mbps, 下行: %.2f Mbps",
 		data.UploadSpeed*8/1048576,
 		data.DownloadSpeed*8/1048576)
 	return nil
 }
 
+// queueReports 缓存待发送的上报数据，超出上限时丢弃最早的数据，调用方需持有锁
+func (c *Client) queueReports(reports ...BandwidthData) {
+	c.pending = append(c.pending, reports...)
+	if dropped := len(c.pending) - maxPendingReports; dropped > 0 {
+		log.Printf("未发送的上报数据超过 %d 条，丢弃最早的 %d 条", maxPendingReports, dropped)
+		c.pending = append([]BandwidthData(nil), c.pending[dropped:]...)
+	}
+}
+
+// sendReport 在新的数据流上发送一条上报数据
+func (c *Client) sendReport(conn quic.Connection, data BandwidthData) error {
+	stream, err := conn.OpenStreamSync(context.Background())
+	if err != nil {
+		return err
+	}
+
+	if err := json.NewEncoder(stream).Encode(data); err != nil {
+		stream.CancelWrite(0)
+		stream.CancelRead(0)
+		return err
+	}
+
+	// 关闭发送方向，在单独的协程中读取服务器返回的消息，不阻塞上报
+	stream.Close()
+	go c.readServerMessage(stream)
+	return nil
+}
+
+// readServerMessage 读取并处理服务器在数据流上的返回消息，服务器在数据入库前返回，超时后放弃
+func (c *Client) readServerMessage(stream quic.Stream) {
+	if err := stream.SetReadDeadline(time.Now().Add(serverMessageTimeout)); err != nil {
+		return
+	}
+
+	body, err := io.ReadAll(stream)
+	if err != nil {
+		log.Printf("读取服务器消息失败: %v", err)
+		return
+	}
+	if len(body) == 0 {
+		return
+	}
+
+	var message ServerMessage
+	if err := json.Unmarshal(body, &message); err != nil {
+		log.Printf("解析服务器消息失败: %v", err)
+		return
+	}
+
+	// 服务器每次都下发完整的任务列表，为空表示取消所有拨测
+	if c.probeMonitor != nil {
+		c.probeMonitor.SetHTTPChecks(message.HTTPChecks)
+	}
+}
+
+// collectData 汇总带宽统计和TCP指标生成上报数据
+func (c *Client) collectData(stats *bandwidthmonitor.HostStats) BandwidthData {
+	tcpHealth := c.monitor.TakeTCPHealth()
+	data := BandwidthData{
+		ClientID:              config.Config.Client.ID,
+		Alias:                 config.Config.Client.Alias,
+		Timestamp:             time.Now(),
+		UploadSpeed:           stats.Total.UploadSpeed,
+		DownloadSpeed:         stats.Total.DownloadSpeed,
+		AvgUploadPacketSize:   stats.Total.AvgUploadPacketSize,
+		AvgDownloadPacketSize: stats.Total.AvgDownloadPacketSize,
+		InternalSpeed:         stats.Total.InternalSpeed,
+		Segments:              stats.Total.Segments,
+		Interfaces:            stats.Interfaces,
+		Sampling:              stats.Total.Sampling,
+		TCPHealth:             &tcpHealth,
+		CaptureGaps:           c.monitor.TakeCaptureGaps(),
+		CaptureStats:          c.monitor.TakeCaptureStats(),
+		Encapsulation:         c.monitor.TakeEncapsulation(),
+		InterfaceHealth:       c.monitor.TakeInterfaceHealth(),
+	}
+	data.Processes, data.Containers = c.monitor.TakeProcesses()
+	data.Remotes = c.monitor.TakeRemotes()
+	data.Hostnames = c.monitor.TakeHostnames()
+
+	// 仅在本周期内有握手样本时上报RTT
+	if rtt := c.monitor.TakeTCPRTT(); rtt.Total.Count > 0 {
+		data.TCPRTT = &rtt
+	}
+	if dns := c.monitor.TakeDNS(); dns.Queries > 0 || dns.Responses > 0 || dns.Timeouts > 0 {
+		data.DNS = &dns
+	}
+	if c.probeMonitor != nil {
+		data.Probes = c.probeMonitor.TakeResults()
+		data.DNSProbes = c.probeMonitor.TakeDNSResults()
+		data.HTTPChecks = c.probeMonitor.TakeHTTPResults()
+	}
+	return data
+}
+
 func (c *Client) handleFailure() {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
@@ -191,15 +359,7 @@ func (c *Client) tryReconnect() bool {
 			return false
 		}
 
-		data := BandwidthData{
-			ClientID:              config.Config.Client.ID,
-			Alias:                 config.Config.Client.Alias,
-			Timestamp:             time.Now(),
-			UploadSpeed:           stats.UploadSpeed,
-			DownloadSpeed:         stats.DownloadSpeed,
-			AvgUploadPacketSize:   stats.AvgUploadPacketSize,
-			AvgDownloadPacketSize: stats.AvgDownloadPacketSize,
-		}
+		data := c.collectData(stats)
 
 		if err := c.sendData(data); err != nil {
 			log.Printf("测试数据包 %d/5 发送失败", i+1)
@@ -219,25 +379,124 @@ func (c *Client) tryReconnect() bool {
 	return true
 }
 
+// runReplay 回放pcap文件并输出处理能力，用于比较不同抓包和解码方式
+func runReplay(path string, options bandwidthmonitor.ReplayOptions) {
+	result, err := bandwidthmonitor.Replay(path, options)
+	if err != nil {
+		log.Fatalf("回放失败: %v", err)
+	}
+	log.Printf("回放 %d 个数据包（%d 字节，%d 轮），%d 个处理协程",
+		result.Packets, result.Bytes, result.Loops, options.Workers)
+	logReplayBenchmark("统计流程", &result.ReplayBenchmark)
+	if result.Baseline != nil {
+		logReplayBenchmark("完整解码（对照）", result.Baseline)
+		if result.NsPerPacket > 0 {
+			log.Printf("统计流程耗时为完整解码的 %.1f%%", result.NsPerPacket/result.Baseline.NsPerPacket*100)
+		}
+	}
+	log.Printf("统计结果 - 上行: %d 字节，下行: %d 字节，内网: %d 字节", result.Upload, result.Download, result.Internal)
+}
+
+// logReplayBenchmark 输出一种处理方式的耗时和内存分配
+func logReplayBenchmark(name string, b *bandwidthmonitor.ReplayBenchmark) {
+	log.Printf("%s: 耗时 %v，%.0f 包/秒，%.2f Mbps，%.0f ns/包，%.2f 次分配/包，%.0f 字节分配/包",
+		name, b.Duration, b.PacketsPerSecond, b.BytesPerSecond*8/1e6, b.NsPerPacket, b.AllocsPerPacket, b.AllocBytesPerPacket)
+}
+
 func main() {
+	replayFile := flag.String("replay", "", "回放pcap/pcapng文件，输出数据包处理能力后退出")
+	replayWorkers := flag.Int("replay-workers", 1, "回放时的处理协程数量")
+	replayLoops := flag.Int("replay-loops", 1, "回放时重复处理文件中数据包的次数")
+	replayBaseline := flag.Bool("replay-baseline", false, "回放时同时使用完整解码处理一遍作为对照")
+	flag.Parse()
+
 	if err := config.Init(); err != nil {
 		log.Fatalf("初始化配置失败: %v", err)
 	}
 
+	if *replayFile != "" {
+		runReplay(*replayFile, bandwidthmonitor.ReplayOptions{
+			Workers:  *replayWorkers,
+			Loops:    *replayLoops,
+			Baseline: *replayBaseline,
+		})
+		return
+	}
+
 	log.Printf("正在初始化网络监控客户端...")
 	log.Printf("采样间隔: %v，上报间隔: %v",
 		config.Config.Monitor.SampleInterval,
 		config.Config.Monitor.ReportInterval)
+	if sampling := config.Config.Capture.Sampling; sampling.Mode != "none" && sampling.Rate > 1 {
+		log.Printf("数据包采样: 方式=%s, 采样率=1/%d", sampling.Mode, sampling.Rate)
+	}
+	if config.Config.Processes.Enabled {
+		log.Printf("按进程统计流量: 每次上报流量最大的 %d 个进程", config.Config.Processes.Top)
+	}
+	if remotes := config.Config.Remotes; remotes.Enabled {
+		log.Printf("按远端网段统计流量: IPv4 /%d, IPv6 /%d, 每次上报流量最大的 %d 个网段, 地址数据库 %d 个",
+			remotes.IPv4Prefix, remotes.IPv6Prefix, remotes.Top, len(remotes.Databases))
+	}
+	if config.Config.Hostnames.Enabled {
+		log.Printf("按服务器名称统计流量: 每次上报流量最大的 %d 个名称", config.Config.Hostnames.Top)
+		if snaplen := config.Config.Capture.Snaplen; snaplen < config.MinHostnameSnaplen {
+			log.Printf("警告: capture.snaplen为 %d，小于 %d 时TLS ClientHello和HTTP请求头可能被截断，无法识别服务器名称",
+				snaplen, config.MinHostnameSnaplen)
+		}
+	}
+	if reverseDNS := config.Config.ReverseDNS; reverseDNS.Enabled {
+		if reverseDNS.PTRLookups {
+			log.Printf("从DNS应答学习地址名称: 最多 %d 个地址, PTR查询每秒 %d 次", reverseDNS.MaxEntries, reverseDNS.PTRRate)
+		} else {
+			log.Printf("从DNS应答学习地址名称: 最多 %d 个地址", reverseDNS.MaxEntries)
+		}
+	}
+	if flowExport := config.Config.FlowExport; flowExport.Enabled {
+		for _, collector := range flowExport.Collectors {
+			log.Printf("导出流记录: %s -> %s, 活跃超时 %v, 非活跃超时 %v",
+				collector.Version, collector.Address, flowExport.ActiveTimeout, flowExport.InactiveTimeout)
+		}
+	}
+
+	// 每个网卡创建一个设备监控器，未配置网卡时由设备监控器自动选择，抓包中断后会重新选择
+	devices := []string{""}
+	if len(config.Config.Capture.Interfaces) > 0 {
+		var err error
+		devices, err = devicemonitor.ResolveDevices(config.Config.Capture.Interfaces, config.Config.Server.Host)
+		if err != nil {
+			log.Fatalf("选择监控网卡失败: %v", err)
+		}
+	}
+	var deviceMonitors []*devicemonitor.DeviceMonitor
+	for _, device := range devices {
+		deviceMonitor := devicemonitor.NewDeviceMonitor(device, config.Config.Capture)
+		defer deviceMonitor.Close()
+		deviceMonitors = append(deviceMonitors, deviceMonitor)
+	}
+	for _, namespace := range config.Config.Capture.Namespaces {
+		for _, device := range namespace.Interfaces {
+			deviceMonitor := devicemonitor.NewNamespaceDeviceMonitor(namespace, device, config.Config.Capture)
+			defer deviceMonitor.Close()
+			deviceMonitors = append(deviceMonitors, deviceMonitor)
+		}
+	}
+
+	m := bandwidthmonitor.NewHostMonitor(deviceMonitors, config.Config.Monitor.SampleInterval)
 
-	deviceMonitor := devicemonitor.NewDeviceMonitor("")
-	defer deviceMonitor.Close()
+	// 启动主动探测，HTTP拨测任务由服务器连接后下发
+	probeMonitor := probemonitor.NewProbeMonitor(config.Config.Probe.Targets, config.Config.Probe.DNS,
+		config.Config.Probe.Timeout, config.Config.Probe.Count)
+	probeMonitor.Start()
+	defer probeMonitor.Stop()
 
-	m := bandwidthmonitor.NewBandwidthMonitor(deviceMonitor, config.Config.Monitor.SampleInterval)
-	client := NewClient(m, deviceMonitor)
+	client := NewClient(m, deviceMonitors, probeMonitor)
 	defer client.stop()
 
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	// 收到SIGHUP时重新读取采样配置
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
 
 	dataTicker := time.NewTicker(config.Config.Monitor.ReportInterval)
 	reconnectTicker := time.NewTicker(config.Config.Server.RetryInterval)
@@ -257,7 +516,7 @@ func main() {
 	for {
 		select {
 		case <-dataTicker.C:
-			if !client.isMonitoring {
+			if !client.canSend() {
 				continue
 			}
 
@@ -267,15 +526,7 @@ func main() {
 				continue
 			}
 
-			data := BandwidthData{
-				ClientID:              config.Config.Client.ID,
-				Alias:                 config.Config.Client.Alias,
-				Timestamp:             time.Now(),
-				UploadSpeed:           stats.UploadSpeed,
-				DownloadSpeed:         stats.DownloadSpeed,
-				AvgUploadPacketSize:   stats.AvgUploadPacketSize,
-				AvgDownloadPacketSize: stats.AvgDownloadPacketSize,
-			}
+			data := client.collectData(stats)
 
 			if err := client.sendData(data); err != nil {
 				log.Printf("发送数据失败: %v", err)
@@ -286,6 +537,15 @@ func main() {
 				client.tryReconnect()
 			}
 
+		case <-reload:
+			sampling, err := config.ReloadSampling()
+			if err != nil {
+				log.Printf("重新加载采样配置失败: %v", err)
+				continue
+			}
+			m.SetSampling(sampling)
+			log.Printf("采样配置已更新: 方式=%s, 采样率=1/%d", sampling.Mode, sampling.Rate)
+
 		case <-quit:
 			log.Println("正在关闭客户端...")
 			return
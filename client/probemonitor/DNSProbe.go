@@ -0,0 +1,280 @@
+package probemonitor
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"network-monitor-client/config"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DNSProbeResult 一次DNS解析探测的结果
+type DNSProbeResult struct {
+	// 目标名称
+	Name string `json:"name"`
+	// 实际使用的DNS服务器
+	Resolver string `json:"resolver"`
+	// 查询的域名和类型
+	Query string `json:"query"`
+	Type  string `json:"type"`
+	// 探测时间
+	Timestamp time.Time `json:"timestamp"`
+	// 解析耗时（毫秒）
+	Latency float64 `json:"latency_ms"`
+	// 响应码，如NOERROR、NXDOMAIN、SERVFAIL
+	Rcode string `json:"rcode,omitempty"`
+	// 应答记录
+	Answers []string `json:"answers,omitempty"`
+	// 响应码和应答内容是否符合预期
+	Success bool `json:"success"`
+	// 失败原因
+	Error string `json:"error,omitempty"`
+}
+
+// DNS查询类型映射
+var dnsTypes = map[string]dnsmessage.Type{
+	"A":     dnsmessage.TypeA,
+	"AAAA":  dnsmessage.TypeAAAA,
+	"CNAME": dnsmessage.TypeCNAME,
+	"MX":    dnsmessage.TypeMX,
+	"NS":    dnsmessage.TypeNS,
+	"TXT":   dnsmessage.TypeTXT,
+	"PTR":   dnsmessage.TypePTR,
+}
+
+// DNS响应码名称
+var rcodeNames = map[dnsmessage.RCode]string{
+	dnsmessage.RCodeSuccess:        "NOERROR",
+	dnsmessage.RCodeFormatError:    "FORMERR",
+	dnsmessage.RCodeServerFailure:  "SERVFAIL",
+	dnsmessage.RCodeNameError:      "NXDOMAIN",
+	dnsmessage.RCodeNotImplemented: "NOTIMP",
+	dnsmessage.RCodeRefused:        "REFUSED",
+}
+
+// rcodeName 获取响应码名称
+func rcodeName(rcode dnsmessage.RCode) string {
+	if name, ok := rcodeNames[rcode]; ok {
+		return name
+	}
+	return fmt.Sprintf("RCODE%d", rcode)
+}
+
+// RunDNSProbe 执行一次DNS解析探测
+func RunDNSProbe(target config.DNSProbeTarget, timeout time.Duration) DNSProbeResult {
+	result := DNSProbeResult{
+		Name:      target.Name,
+		Resolver:  target.Resolver,
+		Query:     target.Query,
+		Type:      target.Type,
+		Timestamp: time.Now(),
+	}
+
+	resolver, err := resolverAddress(target.Resolver)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Resolver = resolver
+
+	qtype, ok := dnsTypes[target.Type]
+	if !ok {
+		result.Error = fmt.Sprintf("不支持的查询类型: %s", target.Type)
+		return result
+	}
+
+	query, id, err := buildDNSQuery(target.Query, qtype)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	start := time.Now()
+	resp, err := exchangeDNS("udp", resolver, query, id, timeout)
+	// 应答被截断时改用TCP重新查询
+	if err == nil && resp.Header.Truncated {
+		resp, err = exchangeDNS("tcp", resolver, query, id, timeout)
+	}
+	result.Latency = float64(time.Since(start)) / float64(time.Millisecond)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Rcode = rcodeName(resp.Header.RCode)
+	result.Answers = formatAnswers(resp.Answers)
+
+	if result.Rcode != target.ExpectRcode {
+		result.Error = fmt.Sprintf("响应码 %s 与期望的 %s 不符", result.Rcode, target.ExpectRcode)
+		return result
+	}
+	if len(target.Expect) > 0 && !answersMatch(result.Answers, target.Expect) {
+		result.Error = fmt.Sprintf("应答 %v 不包含期望的内容 %v", result.Answers, target.Expect)
+		return result
+	}
+
+	result.Success = true
+	return result
+}
+
+// resolverAddress 补全DNS服务器端口，未配置时读取系统resolv.conf
+func resolverAddress(resolver string) (string, error) {
+	if resolver == "" {
+		var err error
+		resolver, err = systemResolver()
+		if err != nil {
+			return "", err
+		}
+	}
+	if _, _, err := net.SplitHostPort(resolver); err != nil {
+		return net.JoinHostPort(strings.Trim(resolver, "[]"), "53"), nil
+	}
+	return resolver, nil
+}
+
+// systemResolver 获取/etc/resolv.conf中的第一个DNS服务器
+func systemResolver() (string, error) {
+	file, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return "", fmt.Errorf("读取系统DNS配置失败: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return fields[1], nil
+		}
+	}
+	return "", errors.New("系统未配置DNS服务器")
+}
+
+// buildDNSQuery 构造递归查询报文
+func buildDNSQuery(name string, qtype dnsmessage.Type) ([]byte, uint16, error) {
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	qname, err := dnsmessage.NewName(name)
+	if err != nil {
+		return nil, 0, fmt.Errorf("域名无效: %v", err)
+	}
+
+	id := uint16(rand.Intn(1 << 16))
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	builder.EnableCompression()
+	if err := builder.StartQuestions(); err != nil {
+		return nil, 0, err
+	}
+	if err := builder.Question(dnsmessage.Question{Name: qname, Type: qtype, Class: dnsmessage.ClassINET}); err != nil {
+		return nil, 0, err
+	}
+	msg, err := builder.Finish()
+	if err != nil {
+		return nil, 0, fmt.Errorf("构造DNS查询失败: %v", err)
+	}
+	return msg, id, nil
+}
+
+// exchangeDNS 发送查询并等待ID匹配的应答
+func exchangeDNS(network, resolver string, query []byte, id uint16, timeout time.Duration) (*dnsmessage.Message, error) {
+	conn, err := net.DialTimeout(network, resolver, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	if network == "tcp" {
+		// TCP查询需要2字节长度前缀
+		framed := make([]byte, 2+len(query))
+		binary.BigEndian.PutUint16(framed, uint16(len(query)))
+		copy(framed[2:], query)
+		if _, err := conn.Write(framed); err != nil {
+			return nil, err
+		}
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return nil, err
+		}
+		return parseDNSResponse(buf, id)
+	}
+
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		// 忽略ID不匹配的迟到应答
+		if msg, err := parseDNSResponse(buf[:n], id); err == nil {
+			return msg, nil
+		}
+	}
+}
+
+// parseDNSResponse 解析应答并校验ID
+func parseDNSResponse(buf []byte, id uint16) (*dnsmessage.Message, error) {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(buf); err != nil {
+		return nil, fmt.Errorf("解析DNS应答失败: %v", err)
+	}
+	if !msg.Header.Response || msg.Header.ID != id {
+		return nil, errors.New("DNS应答ID不匹配")
+	}
+	return &msg, nil
+}
+
+// formatAnswers 将应答记录转换为文本
+func formatAnswers(answers []dnsmessage.Resource) []string {
+	var out []string
+	for _, answer := range answers {
+		switch body := answer.Body.(type) {
+		case *dnsmessage.AResource:
+			out = append(out, net.IP(body.A[:]).String())
+		case *dnsmessage.AAAAResource:
+			out = append(out, net.IP(body.AAAA[:]).String())
+		case *dnsmessage.CNAMEResource:
+			out = append(out, body.CNAME.String())
+		case *dnsmessage.MXResource:
+			out = append(out, body.MX.String())
+		case *dnsmessage.NSResource:
+			out = append(out, body.NS.String())
+		case *dnsmessage.PTRResource:
+			out = append(out, body.PTR.String())
+		case *dnsmessage.TXTResource:
+			out = append(out, strings.Join(body.TXT, ""))
+		}
+	}
+	return out
+}
+
+// answersMatch 判断应答中是否包含任一期望值（忽略大小写和末尾的点）
+func answersMatch(answers, expect []string) bool {
+	for _, answer := range answers {
+		for _, want := range expect {
+			if strings.EqualFold(strings.TrimSuffix(answer, "."), strings.TrimSuffix(want, ".")) {
+				return true
+			}
+		}
+	}
+	return false
+}
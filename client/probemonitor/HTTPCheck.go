@@ -0,0 +1,141 @@
+package probemonitor
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"time"
+)
+
+// 检查响应体内容时最多读取的字节数
+const maxHTTPBodySize = 1 << 20
+
+// HTTPCheck 服务器下发的HTTP/HTTPS拨测任务
+type HTTPCheck struct {
+	// 拨测名称
+	Name string `json:"name"`
+	// 请求地址
+	URL string `json:"url"`
+	// 请求方法
+	Method string `json:"method"`
+	// 期望的状态码，为0时接受所有小于400的状态码
+	ExpectStatus int `json:"expect_status,omitempty"`
+	// 响应体需要包含的内容
+	BodyContains string `json:"body_contains,omitempty"`
+	// 请求超时时间
+	Timeout time.Duration `json:"timeout"`
+	// 拨测周期
+	Interval time.Duration `json:"interval"`
+}
+
+// HTTPCheckResult 一次HTTP拨测的结果，各阶段耗时单位为毫秒
+type HTTPCheckResult struct {
+	Name       string    `json:"name"`
+	URL        string    `json:"url"`
+	Timestamp  time.Time `json:"timestamp"`
+	StatusCode int       `json:"status_code"`
+	// DNS解析耗时
+	DNS float64 `json:"dns_ms"`
+	// TCP连接耗时
+	Connect float64 `json:"connect_ms"`
+	// TLS握手耗时（HTTP为0）
+	TLS float64 `json:"tls_ms"`
+	// 从请求开始到收到首字节的耗时
+	TTFB float64 `json:"ttfb_ms"`
+	// 读取完响应体的总耗时
+	Total   float64 `json:"total_ms"`
+	Success bool    `json:"success"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// milliseconds 计算两个时间点之间的毫秒数，任一时间点缺失时返回0
+func milliseconds(start, end time.Time) float64 {
+	if start.IsZero() || end.IsZero() {
+		return 0
+	}
+	return float64(end.Sub(start)) / float64(time.Millisecond)
+}
+
+// RunHTTPCheck 执行一次HTTP拨测并记录各阶段耗时
+func RunHTTPCheck(check HTTPCheck) HTTPCheckResult {
+	result := HTTPCheckResult{
+		Name:      check.Name,
+		URL:       check.URL,
+		Timestamp: time.Now(),
+	}
+
+	method := check.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	var dnsStart, dnsDone, connectStart, connectDone, tlsStart, tlsDone, firstByte time.Time
+	trace := &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone:              func(httptrace.DNSDoneInfo) { dnsDone = time.Now() },
+		ConnectStart:         func(string, string) { connectStart = time.Now() },
+		ConnectDone:          func(string, string, error) { connectDone = time.Now() },
+		TLSHandshakeStart:    func() { tlsStart = time.Now() },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { tlsDone = time.Now() },
+		GotFirstResponseByte: func() { firstByte = time.Now() },
+	}
+
+	req, err := http.NewRequest(method, check.URL, nil)
+	if err != nil {
+		result.Error = fmt.Sprintf("创建请求失败: %v", err)
+		return result
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+	// 每次拨测使用新连接，保证各阶段耗时都能被测量
+	client := &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, DisableKeepAlives: true},
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		result.Total = milliseconds(start, time.Now())
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPBodySize))
+	end := time.Now()
+
+	result.StatusCode = resp.StatusCode
+	result.DNS = milliseconds(dnsStart, dnsDone)
+	result.Connect = milliseconds(connectStart, connectDone)
+	result.TLS = milliseconds(tlsStart, tlsDone)
+	result.TTFB = milliseconds(start, firstByte)
+	result.Total = milliseconds(start, end)
+
+	if err != nil {
+		result.Error = fmt.Sprintf("读取响应失败: %v", err)
+		return result
+	}
+	if check.ExpectStatus != 0 && resp.StatusCode != check.ExpectStatus {
+		result.Error = fmt.Sprintf("状态码 %d 与期望的 %d 不符", resp.StatusCode, check.ExpectStatus)
+		return result
+	}
+	if check.ExpectStatus == 0 && resp.StatusCode >= 400 {
+		result.Error = fmt.Sprintf("状态码 %d 表示请求失败", resp.StatusCode)
+		return result
+	}
+	if check.BodyContains != "" && !strings.Contains(string(body), check.BodyContains) {
+		result.Error = fmt.Sprintf("响应体不包含 %q", check.BodyContains)
+		return result
+	}
+
+	result.Success = true
+	return result
+}
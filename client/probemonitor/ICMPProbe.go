@@ -0,0 +1,116 @@
+package probemonitor
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"network-monitor-client/config"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	protocolICMP     = 1
+	protocolIPv6ICMP = 58
+)
+
+// 全局递增的ICMP序列号，保证并发探测时可区分回包
+var icmpSeq uint32
+
+// icmpProbe 发送ICMP Echo请求并等待应答
+// 优先使用原始套接字（需要root或CAP_NET_RAW），失败时退回到非特权ICMP套接字
+func icmpProbe(target config.ProbeTarget, timeout time.Duration) (time.Duration, error) {
+	dst, err := net.ResolveIPAddr("ip", target.Host)
+	if err != nil {
+		return 0, fmt.Errorf("解析地址失败: %v", err)
+	}
+
+	isIPv6 := dst.IP.To4() == nil
+	rawNetwork, udpNetwork, listenAddr := "ip4:icmp", "udp4", "0.0.0.0"
+	proto := protocolICMP
+	var echoType, replyType icmp.Type = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+	if isIPv6 {
+		rawNetwork, udpNetwork, listenAddr = "ip6:ipv6-icmp", "udp6", "::"
+		proto = protocolIPv6ICMP
+		echoType, replyType = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+	}
+
+	privileged := true
+	conn, err := icmp.ListenPacket(rawNetwork, listenAddr)
+	if err != nil {
+		privileged = false
+		conn, err = icmp.ListenPacket(udpNetwork, listenAddr)
+		if err != nil {
+			return 0, fmt.Errorf("创建ICMP套接字失败: %v", err)
+		}
+	}
+	defer conn.Close()
+
+	var peer net.Addr = dst
+	if !privileged {
+		peer = &net.UDPAddr{IP: dst.IP, Zone: dst.Zone}
+	}
+
+	payload := make([]byte, 16)
+	if _, err := rand.Read(payload); err != nil {
+		return 0, fmt.Errorf("生成探测负载失败: %v", err)
+	}
+	id := os.Getpid() & 0xffff
+	seq := int(atomic.AddUint32(&icmpSeq, 1) & 0xffff)
+	msg := icmp.Message{
+		Type: echoType,
+		Body: &icmp.Echo{ID: id, Seq: seq, Data: payload},
+	}
+	packet, err := msg.Marshal(nil)
+	if err != nil {
+		return 0, fmt.Errorf("构造ICMP报文失败: %v", err)
+	}
+
+	start := time.Now()
+	if err := conn.SetReadDeadline(start.Add(timeout)); err != nil {
+		return 0, err
+	}
+	if _, err := conn.WriteTo(packet, peer); err != nil {
+		return 0, fmt.Errorf("发送ICMP请求失败: %v", err)
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			return 0, err
+		}
+
+		reply, err := icmp.ParseMessage(proto, buf[:n])
+		if err != nil || reply.Type != replyType {
+			continue
+		}
+		echo, ok := reply.Body.(*icmp.Echo)
+		// 非特权套接字的ID由内核改写，只能按序列号和负载匹配
+		if !ok || echo.Seq != seq || (privileged && echo.ID != id) || !bytes.Equal(echo.Data, payload) {
+			continue
+		}
+		if !sameIP(from, dst.IP) {
+			continue
+		}
+		return time.Since(start), nil
+	}
+}
+
+// sameIP 判断回包来源是否为探测目标
+func sameIP(addr net.Addr, ip net.IP) bool {
+	switch v := addr.(type) {
+	case *net.IPAddr:
+		return v.IP.Equal(ip)
+	case *net.UDPAddr:
+		return v.IP.Equal(ip)
+	}
+	return false
+}
@@ -0,0 +1,366 @@
+package probemonitor
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"network-monitor-client/config"
+)
+
+// 未上报结果的最大缓存数量（断线期间防止内存无限增长）
+const maxPendingResults = 1000
+
+// ProbeResult 一轮探测的结果
+type ProbeResult struct {
+	// 目标名称
+	Name string `json:"name"`
+	// 探测类型：icmp、tcp、udp
+	Type string `json:"type"`
+	// 探测地址
+	Target string `json:"target"`
+	// 本轮探测开始时间
+	Timestamp time.Time `json:"timestamp"`
+	// 发送次数
+	Sent int `json:"sent"`
+	// 成功次数
+	Received int `json:"received"`
+	// 丢包率（百分比）
+	LossPercent float64 `json:"loss_percent"`
+	// 往返时延统计（毫秒）
+	MinRTT float64 `json:"min_rtt_ms"`
+	AvgRTT float64 `json:"avg_rtt_ms"`
+	MaxRTT float64 `json:"max_rtt_ms"`
+	// 抖动：相邻RTT差值绝对值的平均（毫秒）
+	Jitter float64 `json:"jitter_ms"`
+	// 最后一次失败的原因
+	Error string `json:"error,omitempty"`
+}
+
+// probeFunc 单次探测，返回往返时延
+type probeFunc func(target config.ProbeTarget, timeout time.Duration) (time.Duration, error)
+
+// ProbeMonitor 主动时延、丢包和DNS解析探测器
+type ProbeMonitor struct {
+	targets    []config.ProbeTarget
+	dnsTargets []config.DNSProbeTarget
+	timeout    time.Duration
+	count      int
+	results    []ProbeResult
+	dnsResults []DNSProbeResult
+	mutex      sync.Mutex
+	stopChan   chan struct{}
+	wg         sync.WaitGroup
+	// 服务器下发的HTTP拨测任务，更新时通过httpStop停止旧任务
+	httpChecks  []HTTPCheck
+	httpResults []HTTPCheckResult
+	httpStop    chan struct{}
+}
+
+// NewProbeMonitor 创建探测器
+func NewProbeMonitor(targets []config.ProbeTarget, dnsTargets []config.DNSProbeTarget, timeout time.Duration, count int) *ProbeMonitor {
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	if count <= 0 {
+		count = 5
+	}
+
+	return &ProbeMonitor{
+		targets:    targets,
+		dnsTargets: dnsTargets,
+		timeout:    timeout,
+		count:      count,
+		stopChan:   make(chan struct{}),
+	}
+}
+
+// Start 按各目标的周期开始探测
+func (pm *ProbeMonitor) Start() {
+	for _, target := range pm.targets {
+		pm.wg.Add(1)
+		go func(target config.ProbeTarget) {
+			defer pm.wg.Done()
+			pm.run(target)
+		}(target)
+	}
+	for _, target := range pm.dnsTargets {
+		pm.wg.Add(1)
+		go func(target config.DNSProbeTarget) {
+			defer pm.wg.Done()
+			pm.runDNS(target)
+		}(target)
+	}
+	log.Printf("开始主动探测，目标数量: %d，DNS探测数量: %d", len(pm.targets), len(pm.dnsTargets))
+}
+
+// Stop 停止探测并等待进行中的探测结束
+func (pm *ProbeMonitor) Stop() {
+	close(pm.stopChan)
+	pm.wg.Wait()
+}
+
+// run 周期性探测单个目标
+func (pm *ProbeMonitor) run(target config.ProbeTarget) {
+	interval := target.Interval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		pm.addResult(pm.RunRound(target))
+
+		select {
+		case <-ticker.C:
+		case <-pm.stopChan:
+			return
+		}
+	}
+}
+
+// runDNS 周期性执行DNS解析探测
+func (pm *ProbeMonitor) runDNS(target config.DNSProbeTarget) {
+	interval := target.Interval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		pm.addDNSResult(RunDNSProbe(target, pm.timeout))
+
+		select {
+		case <-ticker.C:
+		case <-pm.stopChan:
+			return
+		}
+	}
+}
+
+// SetHTTPChecks 替换HTTP拨测任务，任务未变化时保持原有调度
+func (pm *ProbeMonitor) SetHTTPChecks(checks []HTTPCheck) {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	if len(pm.httpChecks) == 0 && len(checks) == 0 || reflect.DeepEqual(pm.httpChecks, checks) {
+		return
+	}
+	if pm.httpStop != nil {
+		close(pm.httpStop)
+	}
+	pm.httpChecks = checks
+	pm.httpStop = make(chan struct{})
+
+	for _, check := range checks {
+		pm.wg.Add(1)
+		go func(check HTTPCheck, stop chan struct{}) {
+			defer pm.wg.Done()
+			pm.runHTTP(check, stop)
+		}(check, pm.httpStop)
+	}
+	log.Printf("更新HTTP拨测任务，数量: %d", len(checks))
+}
+
+// runHTTP 周期性执行HTTP拨测，直到任务被替换或探测器停止
+func (pm *ProbeMonitor) runHTTP(check HTTPCheck, stop chan struct{}) {
+	interval := check.Interval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-pm.stopChan:
+			return
+		default:
+		}
+
+		pm.addHTTPResult(RunHTTPCheck(check))
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		case <-pm.stopChan:
+			return
+		}
+	}
+}
+
+// RunRound 对目标执行一轮探测（count次）并汇总结果
+func (pm *ProbeMonitor) RunRound(target config.ProbeTarget) ProbeResult {
+	result := ProbeResult{
+		Name:      target.Name,
+		Type:      target.Type,
+		Target:    targetAddress(target),
+		Timestamp: time.Now(),
+	}
+
+	probe, err := probeFor(target.Type)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	var rtts []float64
+	for i := 0; i < pm.count; i++ {
+		select {
+		case <-pm.stopChan:
+			return summarize(result, rtts)
+		default:
+		}
+
+		result.Sent++
+		rtt, err := probe(target, pm.timeout)
+		if err != nil {
+			result.Error = err.Error()
+			continue
+		}
+		rtts = append(rtts, float64(rtt)/float64(time.Millisecond))
+	}
+
+	return summarize(result, rtts)
+}
+
+// probeFor 根据探测类型选择探测函数
+func probeFor(probeType string) (probeFunc, error) {
+	switch probeType {
+	case "icmp":
+		return icmpProbe, nil
+	case "tcp":
+		return tcpProbe, nil
+	case "udp":
+		return udpProbe, nil
+	}
+	return nil, fmt.Errorf("不支持的探测类型: %s", probeType)
+}
+
+// targetAddress 获取探测地址的文本形式
+func targetAddress(target config.ProbeTarget) string {
+	if target.Type == "icmp" {
+		return target.Host
+	}
+	return net.JoinHostPort(target.Host, strconv.Itoa(target.Port))
+}
+
+// summarize 计算丢包率、RTT和抖动
+func summarize(result ProbeResult, rtts []float64) ProbeResult {
+	result.Received = len(rtts)
+	if result.Sent > 0 {
+		result.LossPercent = float64(result.Sent-result.Received) / float64(result.Sent) * 100
+	}
+	if len(rtts) == 0 {
+		return result
+	}
+
+	result.MinRTT = rtts[0]
+	result.MaxRTT = rtts[0]
+	sum := 0.0
+	for _, rtt := range rtts {
+		sum += rtt
+		result.MinRTT = math.Min(result.MinRTT, rtt)
+		result.MaxRTT = math.Max(result.MaxRTT, rtt)
+	}
+	result.AvgRTT = sum / float64(len(rtts))
+
+	if len(rtts) > 1 {
+		diff := 0.0
+		for i := 1; i < len(rtts); i++ {
+			diff += math.Abs(rtts[i] - rtts[i-1])
+		}
+		result.Jitter = diff / float64(len(rtts)-1)
+	}
+
+	// 全部成功时不保留历史错误
+	if result.Received == result.Sent {
+		result.Error = ""
+	}
+	return result
+}
+
+// addResult 缓存探测结果等待上报
+func (pm *ProbeMonitor) addResult(result ProbeResult) {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	if len(pm.results) >= maxPendingResults {
+		pm.results = pm.results[1:]
+	}
+	pm.results = append(pm.results, result)
+
+	if result.Received < result.Sent {
+		log.Printf("探测 %s (%s) 丢包率 %.1f%%: %s", result.Name, result.Target, result.LossPercent, result.Error)
+	}
+}
+
+// TakeResults 获取自上次上报以来的探测结果
+func (pm *ProbeMonitor) TakeResults() []ProbeResult {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	results := pm.results
+	pm.results = nil
+	return results
+}
+
+// addDNSResult 缓存DNS探测结果等待上报
+func (pm *ProbeMonitor) addDNSResult(result DNSProbeResult) {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	if len(pm.dnsResults) >= maxPendingResults {
+		pm.dnsResults = pm.dnsResults[1:]
+	}
+	pm.dnsResults = append(pm.dnsResults, result)
+
+	if !result.Success {
+		log.Printf("DNS探测 %s (%s %s @%s) 失败: %s", result.Name, result.Query, result.Type, result.Resolver, result.Error)
+	}
+}
+
+// TakeDNSResults 获取自上次上报以来的DNS探测结果
+func (pm *ProbeMonitor) TakeDNSResults() []DNSProbeResult {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	results := pm.dnsResults
+	pm.dnsResults = nil
+	return results
+}
+
+// addHTTPResult 缓存HTTP拨测结果等待上报
+func (pm *ProbeMonitor) addHTTPResult(result HTTPCheckResult) {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	if len(pm.httpResults) >= maxPendingResults {
+		pm.httpResults = pm.httpResults[1:]
+	}
+	pm.httpResults = append(pm.httpResults, result)
+
+	if !result.Success {
+		log.Printf("HTTP拨测 %s (%s) 失败: %s", result.Name, result.URL, result.Error)
+	}
+}
+
+// TakeHTTPResults 获取自上次上报以来的HTTP拨测结果
+func (pm *ProbeMonitor) TakeHTTPResults() []HTTPCheckResult {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	results := pm.httpResults
+	pm.httpResults = nil
+	return results
+}
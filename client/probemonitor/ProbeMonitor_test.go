@@ -0,0 +1,223 @@
+package probemonitor
+
+import (
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"network-monitor-client/config"
+)
+
+// 本地探测的超时时间，回环地址上的探测远小于该值
+const testTimeout = time.Second
+
+// localTarget 构造指向本地地址的探测目标
+func localTarget(t *testing.T, probeType string, addr net.Addr) config.ProbeTarget {
+	t.Helper()
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := config.ProbeTarget{Name: "local", Type: probeType, Host: host}
+	if target.Port, err = net.LookupPort(addr.Network(), port); err != nil {
+		t.Fatal(err)
+	}
+	return target
+}
+
+// startTCPListener 启动本地TCP监听并接受所有连接
+func startTCPListener(t *testing.T) net.Listener {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	return ln
+}
+
+// startUDPEcho 启动本地UDP回显服务，drop返回true的数据包不回显
+func startUDPEcho(t *testing.T, drop func(n int) bool) net.PacketConn {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 1500)
+		for n := 0; ; n++ {
+			size, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if drop != nil && drop(n) {
+				continue
+			}
+			conn.WriteTo(buf[:size], addr)
+		}
+	}()
+	return conn
+}
+
+// closedAddr 获取一个已关闭的本地端口
+func closedAddr(t *testing.T, network string) net.Addr {
+	t.Helper()
+	switch network {
+	case "tcp":
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+		return ln.Addr()
+	default:
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		return conn.LocalAddr()
+	}
+}
+
+func TestTCPProbe(t *testing.T) {
+	ln := startTCPListener(t)
+
+	rtt, err := tcpProbe(localTarget(t, "tcp", ln.Addr()), testTimeout)
+	if err != nil {
+		t.Fatalf("探测本地TCP端口失败: %v", err)
+	}
+	if rtt <= 0 || rtt >= testTimeout {
+		t.Errorf("RTT = %v，期望在 (0, %v) 之间", rtt, testTimeout)
+	}
+}
+
+func TestUDPProbe(t *testing.T) {
+	echo := startUDPEcho(t, nil)
+
+	rtt, err := udpProbe(localTarget(t, "udp", echo.LocalAddr()), testTimeout)
+	if err != nil {
+		t.Fatalf("探测本地UDP回显服务失败: %v", err)
+	}
+	if rtt <= 0 || rtt >= testTimeout {
+		t.Errorf("RTT = %v，期望在 (0, %v) 之间", rtt, testTimeout)
+	}
+}
+
+func TestProbeClosedPort(t *testing.T) {
+	for _, probeType := range []string{"tcp", "udp"} {
+		t.Run(probeType, func(t *testing.T) {
+			target := localTarget(t, probeType, closedAddr(t, probeType))
+			pm := NewProbeMonitor(nil, nil, testTimeout, 3)
+
+			result := pm.RunRound(target)
+			if result.Sent != 3 || result.Received != 0 {
+				t.Errorf("发送 %d 接收 %d，期望发送 3 接收 0", result.Sent, result.Received)
+			}
+			if result.LossPercent != 100 {
+				t.Errorf("丢包率 = %v，期望 100", result.LossPercent)
+			}
+			if result.Error == "" {
+				t.Error("全部丢包时应保留失败原因")
+			}
+			if result.MinRTT != 0 || result.AvgRTT != 0 || result.MaxRTT != 0 || result.Jitter != 0 {
+				t.Errorf("全部丢包时RTT统计应为0: %+v", result)
+			}
+		})
+	}
+}
+
+func TestRunRoundPartialLoss(t *testing.T) {
+	// 丢弃第2、4次探测，超时后RunRound继续下一次探测
+	echo := startUDPEcho(t, func(n int) bool { return n%2 == 1 })
+	pm := NewProbeMonitor(nil, nil, 200*time.Millisecond, 4)
+
+	result := pm.RunRound(localTarget(t, "udp", echo.LocalAddr()))
+	if result.Sent != 4 || result.Received != 2 {
+		t.Fatalf("发送 %d 接收 %d，期望发送 4 接收 2", result.Sent, result.Received)
+	}
+	if result.LossPercent != 50 {
+		t.Errorf("丢包率 = %v，期望 50", result.LossPercent)
+	}
+	if result.Error == "" {
+		t.Error("部分丢包时应保留失败原因")
+	}
+	if result.MinRTT <= 0 || result.MinRTT > result.AvgRTT || result.AvgRTT > result.MaxRTT {
+		t.Errorf("RTT统计不满足 0 < min <= avg <= max: %+v", result)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	tests := []struct {
+		name   string
+		sent   int
+		rtts   []float64
+		loss   float64
+		min    float64
+		avg    float64
+		max    float64
+		jitter float64
+		err    string
+	}{
+		{name: "全部成功", sent: 4, rtts: []float64{10, 14, 12, 20}, min: 10, avg: 14, max: 20, jitter: (4 + 2 + 8) / 3.0},
+		{name: "部分丢包", sent: 4, rtts: []float64{5, 7}, loss: 50, min: 5, avg: 6, max: 7, jitter: 2, err: "timeout"},
+		{name: "单次成功", sent: 1, rtts: []float64{3}, min: 3, avg: 3, max: 3},
+		{name: "全部丢包", sent: 2, loss: 100, err: "timeout"},
+		{name: "未发送", sent: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := summarize(ProbeResult{Sent: tt.sent, Error: "timeout"}, tt.rtts)
+			if result.Received != len(tt.rtts) {
+				t.Errorf("Received = %d，期望 %d", result.Received, len(tt.rtts))
+			}
+			for _, check := range []struct {
+				field     string
+				got, want float64
+			}{
+				{"LossPercent", result.LossPercent, tt.loss},
+				{"MinRTT", result.MinRTT, tt.min},
+				{"AvgRTT", result.AvgRTT, tt.avg},
+				{"MaxRTT", result.MaxRTT, tt.max},
+				{"Jitter", result.Jitter, tt.jitter},
+			} {
+				if math.Abs(check.got-check.want) > 1e-9 {
+					t.Errorf("%s = %v，期望 %v", check.field, check.got, check.want)
+				}
+			}
+			if tt.sent > 0 && result.Error != tt.err {
+				t.Errorf("Error = %q，期望 %q", result.Error, tt.err)
+			}
+		})
+	}
+}
+
+func TestTakeResults(t *testing.T) {
+	pm := NewProbeMonitor(nil, nil, testTimeout, 1)
+	for i := 0; i < maxPendingResults+10; i++ {
+		pm.addResult(ProbeResult{Name: "local", Sent: 1, Received: 1, Timestamp: time.Unix(int64(i), 0)})
+	}
+
+	results := pm.TakeResults()
+	if len(results) != maxPendingResults {
+		t.Fatalf("缓存结果数 = %d，期望 %d", len(results), maxPendingResults)
+	}
+	// 超出上限时丢弃最早的结果
+	if results[0].Timestamp.Unix() != 10 {
+		t.Errorf("最早的结果时间 = %d，期望 10", results[0].Timestamp.Unix())
+	}
+	if len(pm.TakeResults()) != 0 {
+		t.Error("TakeResults 后缓存应为空")
+	}
+}
@@ -0,0 +1,24 @@
+package probemonitor
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	"network-monitor-client/config"
+)
+
+// tcpProbe 以TCP三次握手耗时作为往返时延
+func tcpProbe(target config.ProbeTarget, timeout time.Duration) (time.Duration, error) {
+	addr := net.JoinHostPort(target.Host, strconv.Itoa(target.Port))
+
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return 0, err
+	}
+	rtt := time.Since(start)
+	conn.Close()
+
+	return rtt, nil
+}
@@ -0,0 +1,47 @@
+package probemonitor
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"network-monitor-client/config"
+)
+
+// udpProbe 向UDP回显服务发送随机负载并等待原样返回
+func udpProbe(target config.ProbeTarget, timeout time.Duration) (time.Duration, error) {
+	addr := net.JoinHostPort(target.Host, strconv.Itoa(target.Port))
+	conn, err := net.DialTimeout("udp", addr, timeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return 0, fmt.Errorf("生成探测负载失败: %v", err)
+	}
+
+	start := time.Now()
+	if err := conn.SetDeadline(start.Add(timeout)); err != nil {
+		return 0, err
+	}
+	if _, err := conn.Write(token); err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return 0, err
+		}
+		// 忽略迟到的上一次探测回包
+		if bytes.Equal(buf[:n], token) {
+			return time.Since(start), nil
+		}
+	}
+}
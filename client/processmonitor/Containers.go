@@ -0,0 +1,169 @@
+package processmonitor
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 容器运行时
+const (
+	RuntimeDocker     = "docker"
+	RuntimeContainerd = "containerd"
+	RuntimeCRIO       = "cri-o"
+	RuntimePodman     = "podman"
+)
+
+// 各运行时保存容器配置的位置
+const (
+	dockerContainersDir = "/var/lib/docker/containers"
+	containerdTaskDir   = "/run/containerd/io.containerd.runtime.v2.task"
+	crioContainersDir   = "/run/containers/storage/overlay-containers"
+)
+
+// 容器ID为64位十六进制，cgroup路径中的形式：
+// docker-<id>.scope、/docker/<id>（Docker）、cri-containerd-<id>.scope（containerd）、
+// crio-<id>.scope（CRI-O）、libpod-<id>.scope（Podman）、/kubepods/.../<id>（cgroupfs驱动）
+var containerIDPattern = regexp.MustCompile(`(?:^|[/-])([0-9a-f]{64})(?:\.scope)?$`)
+
+// Container 进程所属的容器
+type Container struct {
+	ID      string
+	Runtime string
+	// 容器名称，Kubernetes容器为"命名空间/Pod/容器"，无法获取时为空
+	Name string
+}
+
+// readCgroup 读取进程的cgroup路径，优先使用cgroup v2，v1时使用name=systemd层级
+func readCgroup(dir string) (string, error) {
+	file, err := os.Open(filepath.Join(dir, "cgroup"))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	// 每行格式为"层级ID:控制器列表:路径"，cgroup v2的层级ID为0且控制器列表为空
+	var fallback string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		switch {
+		case fields[0] == "0" && fields[1] == "":
+			return fields[2], nil
+		case fields[1] == "name=systemd" || fallback == "":
+			fallback = fields[2]
+		}
+	}
+	return fallback, scanner.Err()
+}
+
+// parseContainer 从cgroup路径中识别容器ID和运行时，不属于容器时返回nil
+func parseContainer(cgroup string) *Container {
+	for _, segment := range strings.Split(cgroup, "/") {
+		match := containerIDPattern.FindStringSubmatch(segment)
+		if match == nil {
+			continue
+		}
+		container := &Container{ID: match[1]}
+		switch {
+		case strings.HasPrefix(segment, "docker"):
+			container.Runtime = RuntimeDocker
+		case strings.HasPrefix(segment, "cri-containerd"):
+			container.Runtime = RuntimeContainerd
+		case strings.HasPrefix(segment, "crio"):
+			container.Runtime = RuntimeCRIO
+		case strings.HasPrefix(segment, "libpod"):
+			container.Runtime = RuntimePodman
+		case strings.Contains(cgroup, "/docker/"):
+			container.Runtime = RuntimeDocker
+		}
+		return container
+	}
+	return nil
+}
+
+// containerName 从运行时的容器配置中读取容器名称
+// Docker读取config.v2.json中的名称，containerd和CRI-O读取OCI配置中的Kubernetes或nerdctl注解
+func containerName(container *Container) string {
+	if container.Runtime == RuntimeDocker || container.Runtime == "" {
+		if name := dockerContainerName(container.ID); name != "" {
+			return name
+		}
+	}
+
+	paths := []string{filepath.Join(crioContainersDir, container.ID, "userdata", "config.json")}
+	if matches, err := filepath.Glob(filepath.Join(containerdTaskDir, "*", container.ID, "config.json")); err == nil {
+		paths = append(matches, paths...)
+	}
+	for _, path := range paths {
+		if name := ociContainerName(path); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// dockerContainerName 读取Docker容器的名称
+func dockerContainerName(id string) string {
+	data, err := os.ReadFile(filepath.Join(dockerContainersDir, id, "config.v2.json"))
+	if err != nil {
+		return ""
+	}
+	var config struct {
+		Name string `json:"Name"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(config.Name, "/")
+}
+
+// ociContainerName 从OCI运行时配置的注解中读取容器名称
+func ociContainerName(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	var spec struct {
+		Annotations map[string]string `json:"annotations"`
+	}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return ""
+	}
+	annotations := spec.Annotations
+	// containerd（CRI）和CRI-O的Kubernetes注解
+	for _, keys := range [][3]string{
+		{"io.kubernetes.cri.sandbox-namespace", "io.kubernetes.cri.sandbox-name", "io.kubernetes.cri.container-name"},
+		{"io.kubernetes.pod.namespace", "io.kubernetes.pod.name", "io.kubernetes.container.name"},
+	} {
+		if pod := annotations[keys[1]]; pod != "" {
+			return annotations[keys[0]] + "/" + pod + "/" + annotations[keys[2]]
+		}
+	}
+	return annotations["nerdctl/name"]
+}
+
+// readNamespace 读取进程所在网络命名空间的inode，链接格式为"net:[inode]"
+func readNamespace(dir string) (uint64, error) {
+	link, err := os.Readlink(filepath.Join(dir, "ns", "net"))
+	if err != nil {
+		return 0, err
+	}
+	return parseLinkInode(link, "net:[")
+}
+
+// parseLinkInode 解析"类型:[inode]"格式的链接
+func parseLinkInode(link, prefix string) (uint64, error) {
+	value, ok := strings.CutPrefix(link, prefix)
+	if !ok {
+		return 0, strconv.ErrSyntax
+	}
+	return strconv.ParseUint(strings.TrimSuffix(value, "]"), 10, 64)
+}
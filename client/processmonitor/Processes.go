@@ -0,0 +1,238 @@
+package processmonitor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const procDir = "/proc"
+
+// 两次扫描/proc的最小间隔，有新的socket找不到所属进程时才重新扫描
+const ownerRescanInterval = 5 * time.Second
+
+// 上报的命令行最大长度
+const maxCmdlineLength = 256
+
+// Process 进程信息
+type Process struct {
+	PID     int
+	Comm    string
+	Cmdline string
+	User    string
+	// 进程所在的cgroup路径
+	Cgroup string
+	// 进程所属的容器，不在容器内时为nil
+	Container *Container
+	// 进程所在网络命名空间的inode
+	NetNS uint64
+}
+
+// Resolver 将连接映射到所属进程，缓存socket inode与进程号的对应关系
+// 读取其他用户进程的/proc/<pid>/fd需要root或CAP_SYS_PTRACE，没有权限的进程无法归属
+type Resolver struct {
+	mutex    sync.Mutex
+	owners   map[uint64]int
+	lastScan time.Time
+	// 各网络命名空间内的一个进程，用于读取命名空间内的socket表
+	namespaces map[uint64]int
+	// 进程信息缓存，每次扫描/proc后清空，避免进程号被复用后信息错误
+	processes map[int]*Process
+	// 容器ID到名称的缓存
+	containerNames map[string]string
+	users          map[string]string
+}
+
+// NewResolver 创建连接到进程的映射器
+func NewResolver() *Resolver {
+	return &Resolver{
+		owners:         make(map[uint64]int),
+		processes:      make(map[int]*Process),
+		containerNames: make(map[string]string),
+		users:          make(map[string]string),
+	}
+}
+
+// Resolve 查找各连接所属的进程号，无法归属的连接不在结果中
+// socket表按网络命名空间读取，在宿主机网桥或veth上抓到的容器流量也能归属到容器内的进程
+func (r *Resolver) Resolve(flows []Flow) (map[Flow]int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	table, err := ReadSockets(r.namespacePIDs())
+	if err != nil {
+		return nil, err
+	}
+	pids, missing := r.lookup(table, flows)
+	if missing && time.Since(r.lastScan) >= ownerRescanInterval {
+		r.scan()
+		// 扫描后可能发现新的网络命名空间
+		if table, err = ReadSockets(r.namespacePIDs()); err != nil {
+			return nil, err
+		}
+		pids, _ = r.lookup(table, flows)
+	}
+	return pids, nil
+}
+
+// lookup 按socket表和缓存的inode映射查找进程号，有连接找不到socket或所属进程时missing为true
+func (r *Resolver) lookup(table *SocketTable, flows []Flow) (pids map[Flow]int, missing bool) {
+	pids = make(map[Flow]int, len(flows))
+	for _, flow := range flows {
+		inode := table.Lookup(flow)
+		if inode == 0 {
+			missing = true
+			continue
+		}
+		if pid, ok := r.owners[inode]; ok {
+			pids[flow] = pid
+		} else {
+			missing = true
+		}
+	}
+	return pids, missing
+}
+
+// namespacePIDs 获取各网络命名空间内的一个进程号，未扫描过时为空
+func (r *Resolver) namespacePIDs() []int {
+	pids := make([]int, 0, len(r.namespaces))
+	for _, pid := range r.namespaces {
+		pids = append(pids, pid)
+	}
+	return pids
+}
+
+// scan 扫描/proc，建立socket inode到进程号的映射并记录各网络命名空间内的进程
+// 多个进程共享同一socket（如fork后的子进程）时取进程号最小的
+func (r *Resolver) scan() {
+	owners := make(map[uint64]int)
+	namespaces := make(map[uint64]int)
+	r.lastScan = time.Now()
+	r.processes = make(map[int]*Process)
+
+	entries, err := os.ReadDir(procDir)
+	if err != nil {
+		r.owners, r.namespaces = owners, namespaces
+		return
+	}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		dir := filepath.Join(procDir, entry.Name())
+		if netns, err := readNamespace(dir); err == nil {
+			if owner, ok := namespaces[netns]; !ok || pid < owner {
+				namespaces[netns] = pid
+			}
+		}
+
+		fdDir := filepath.Join(dir, "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			// 进程已退出或没有权限
+			continue
+		}
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil {
+				continue
+			}
+			inode, err := parseLinkInode(link, "socket:[")
+			if err != nil {
+				continue
+			}
+			if owner, ok := owners[inode]; !ok || pid < owner {
+				owners[inode] = pid
+			}
+		}
+	}
+	r.owners, r.namespaces = owners, namespaces
+}
+
+// Process 读取进程的名称、命令行、所属用户、cgroup和网络命名空间
+func (r *Resolver) Process(pid int) (*Process, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if process, ok := r.processes[pid]; ok {
+		return process, nil
+	}
+
+	dir := filepath.Join(procDir, strconv.Itoa(pid))
+	comm, err := os.ReadFile(filepath.Join(dir, "comm"))
+	if err != nil {
+		return nil, fmt.Errorf("读取进程 %d 的信息失败: %v", pid, err)
+	}
+	process := &Process{PID: pid, Comm: strings.TrimSpace(string(comm))}
+
+	// 命令行参数以NUL分隔，内核线程没有命令行
+	if cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline")); err == nil {
+		process.Cmdline = strings.TrimSpace(strings.ReplaceAll(string(cmdline), "\x00", " "))
+		if len(process.Cmdline) > maxCmdlineLength {
+			process.Cmdline = strings.ToValidUTF8(process.Cmdline[:maxCmdlineLength], "")
+		}
+	}
+	if uid, err := processUID(dir); err == nil {
+		process.User = r.userName(uid)
+	}
+	if cgroup, err := readCgroup(dir); err == nil {
+		process.Cgroup = cgroup
+		if container := parseContainer(cgroup); container != nil {
+			container.Name = r.containerName(container)
+			process.Container = container
+		}
+	}
+	process.NetNS, _ = readNamespace(dir)
+
+	r.processes[pid] = process
+	return process, nil
+}
+
+// processUID 从/proc/<pid>/status读取进程的真实用户ID
+func processUID(dir string) (string, error) {
+	file, err := os.Open(filepath.Join(dir, "status"))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "Uid:"); ok {
+			if fields := strings.Fields(value); len(fields) > 0 {
+				return fields[0], nil
+			}
+		}
+	}
+	return "", fmt.Errorf("%s/status中没有Uid", dir)
+}
+
+// userName 获取用户ID对应的用户名，找不到时使用用户ID
+func (r *Resolver) userName(uid string) string {
+	if name, ok := r.users[uid]; ok {
+		return name
+	}
+	name := uid
+	if u, err := user.LookupId(uid); err == nil {
+		name = u.Username
+	}
+	r.users[uid] = name
+	return name
+}
+
+// containerName 获取容器名称，容器ID不会复用，结果一直缓存
+func (r *Resolver) containerName(container *Container) string {
+	if name, ok := r.containerNames[container.ID]; ok {
+		return name
+	}
+	name := containerName(container)
+	r.containerNames[container.ID] = name
+	return name
+}
@@ -0,0 +1,178 @@
+package processmonitor
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// 传输层协议号
+const (
+	ProtocolTCP = 6
+	ProtocolUDP = 17
+)
+
+// 内核socket表（/proc/net或/proc/<pid>/net下的文件），IPv6表中的IPv4映射地址按IPv4处理
+var socketFiles = []struct {
+	name     string
+	protocol uint8
+}{
+	{"tcp", ProtocolTCP},
+	{"tcp6", ProtocolTCP},
+	{"udp", ProtocolUDP},
+	{"udp6", ProtocolUDP},
+}
+
+// Flow 本机一侧看到的连接五元组
+type Flow struct {
+	Protocol uint8
+	Local    netip.AddrPort
+	Remote   netip.AddrPort
+}
+
+// localSocket 监听或未连接socket的本地地址
+type localSocket struct {
+	protocol uint8
+	local    netip.AddrPort
+}
+
+// SocketTable 内核socket表中socket的inode
+type SocketTable struct {
+	// 已连接的socket，按五元组查找
+	connected map[Flow]uint64
+	// 监听或未连接（UDP）的socket，按本地地址查找
+	unconnected map[localSocket]uint64
+}
+
+// ReadSockets 读取TCP和UDP socket表，pids为各网络命名空间内的一个进程，为空时只读取当前命名空间
+// socket inode在所有命名空间内唯一，不同命名空间内五元组相同的连接只保留先读到的
+func ReadSockets(pids []int) (*SocketTable, error) {
+	table := &SocketTable{
+		connected:   make(map[Flow]uint64),
+		unconnected: make(map[localSocket]uint64),
+	}
+	if len(pids) == 0 {
+		return table, table.readSocketFiles(filepath.Join(procDir, "net"))
+	}
+
+	read := 0
+	for _, pid := range pids {
+		// 进程在扫描后已退出时跳过该命名空间，下次扫描时更新
+		if err := table.readSocketFiles(filepath.Join(procDir, strconv.Itoa(pid), "net")); err == nil {
+			read++
+		}
+	}
+	if read == 0 {
+		return table, table.readSocketFiles(filepath.Join(procDir, "net"))
+	}
+	return table, nil
+}
+
+// readSocketFiles 读取目录下的各socket表，内核未启用IPv6时没有tcp6、udp6文件
+func (t *SocketTable) readSocketFiles(dir string) error {
+	for _, file := range socketFiles {
+		if err := t.readSocketFile(filepath.Join(dir, file.name), file.protocol); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// readSocketFile 解析单个socket表
+// 字段：序号 本地地址:端口 远端地址:端口 状态 发送队列:接收队列 定时器 重传次数 uid 超时 inode ...
+func (t *SocketTable) readSocketFile(path string, protocol uint8) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // 跳过表头
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+		// TIME_WAIT等已不属于任何进程的socket没有inode
+		inode, err := strconv.ParseUint(fields[9], 10, 64)
+		if err != nil || inode == 0 {
+			continue
+		}
+		local, err1 := parseSocketAddr(fields[1])
+		remote, err2 := parseSocketAddr(fields[2])
+		if err1 != nil || err2 != nil {
+			continue
+		}
+
+		if remote.Port() == 0 && remote.Addr().IsUnspecified() {
+			key := localSocket{protocol: protocol, local: local}
+			if _, ok := t.unconnected[key]; !ok {
+				t.unconnected[key] = inode
+			}
+		} else {
+			key := Flow{Protocol: protocol, Local: local, Remote: remote}
+			if _, ok := t.connected[key]; !ok {
+				t.connected[key] = inode
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("读取 %s 失败: %v", path, err)
+	}
+	return nil
+}
+
+// parseSocketAddr 解析十六进制的地址:端口，地址按32位字为本机字节序，端口为大端
+func parseSocketAddr(s string) (netip.AddrPort, error) {
+	addrHex, portHex, ok := strings.Cut(s, ":")
+	if !ok {
+		return netip.AddrPort{}, fmt.Errorf("地址格式无效: %q", s)
+	}
+	port, err := strconv.ParseUint(portHex, 16, 16)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	raw, err := hex.DecodeString(addrHex)
+	if err != nil || (len(raw) != 4 && len(raw) != 16) {
+		return netip.AddrPort{}, fmt.Errorf("地址格式无效: %q", s)
+	}
+	for i := 0; i < len(raw); i += 4 {
+		binary.BigEndian.PutUint32(raw[i:], binary.NativeEndian.Uint32(raw[i:]))
+	}
+	addr, _ := netip.AddrFromSlice(raw)
+	return netip.AddrPortFrom(addr.Unmap(), uint16(port)), nil
+}
+
+// Lookup 查找连接所属socket的inode，找不到时返回0
+// 依次匹配已连接的socket、绑定本地地址的socket和绑定通配地址（含双栈的::）的socket
+func (t *SocketTable) Lookup(flow Flow) uint64 {
+	if inode, ok := t.connected[flow]; ok {
+		return inode
+	}
+	port := flow.Local.Port()
+	for _, local := range []netip.AddrPort{
+		flow.Local,
+		netip.AddrPortFrom(unspecified(flow.Local.Addr()), port),
+		netip.AddrPortFrom(netip.IPv6Unspecified(), port),
+	} {
+		if inode, ok := t.unconnected[localSocket{protocol: flow.Protocol, local: local}]; ok {
+			return inode
+		}
+	}
+	return 0
+}
+
+// unspecified 获取与地址同一协议族的通配地址
+func unspecified(addr netip.Addr) netip.Addr {
+	if addr.Is4() {
+		return netip.IPv4Unspecified()
+	}
+	return netip.IPv6Unspecified()
+}
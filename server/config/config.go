@@ -2,10 +2,43 @@ package config
 
 import (
 	"log"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
+// HTTPCheck 下发给客户端执行的HTTP/HTTPS拨测任务
+type HTTPCheck struct {
+	// 拨测名称
+	Name string `mapstructure:"name" json:"name"`
+	// 请求地址
+	URL string `mapstructure:"url" json:"url"`
+	// 请求方法，默认GET
+	Method string `mapstructure:"method" json:"method"`
+	// 期望的状态码，为0时接受所有小于400的状态码
+	ExpectStatus int `mapstructure:"expect_status" json:"expect_status,omitempty"`
+	// 响应体需要包含的内容，为空时不检查
+	BodyContains string `mapstructure:"body_contains" json:"body_contains,omitempty"`
+	// 请求超时时间
+	Timeout time.Duration `mapstructure:"timeout" json:"timeout"`
+	// 拨测周期
+	Interval time.Duration `mapstructure:"interval" json:"interval"`
+}
+
+// InterfaceAlerts 网卡错误和链路状态的告警阈值，为0时不检查该项
+type InterfaceAlerts struct {
+	// 每秒收发错误数
+	ErrorRate float64 `mapstructure:"error_rate"`
+	// 每秒收发丢弃数
+	DropRate float64 `mapstructure:"drop_rate"`
+	// 每秒冲突数
+	CollisionRate float64 `mapstructure:"collision_rate"`
+	// 每个上报周期内的载波变化次数（链路抖动）
+	CarrierChanges int `mapstructure:"carrier_changes"`
+}
+
 type config struct {
 	Server struct {
 		Host string `mapstructure:"host"`
@@ -21,6 +54,12 @@ type config struct {
 		Password string `mapstructure:"password"`
 		Name     string `mapstructure:"name"`
 	} `mapstructure:"database"`
+	// 客户端执行的HTTP拨测任务
+	HTTPChecks []HTTPCheck `mapstructure:"http_checks"`
+	// 告警阈值
+	Alerts struct {
+		Interface InterfaceAlerts `mapstructure:"interface"`
+	} `mapstructure:"alerts"`
 }
 
 var Config *config
@@ -31,6 +70,12 @@ func InitConfig() {
 	viper.SetConfigType("yaml")
 	viper.AddConfigPath(".")
 
+	// 未配置时使用默认的网卡告警阈值
+	viper.SetDefault("alerts.interface.error_rate", 1)
+	viper.SetDefault("alerts.interface.drop_rate", 100)
+	viper.SetDefault("alerts.interface.collision_rate", 1)
+	viper.SetDefault("alerts.interface.carrier_changes", 1)
+
 	if err := viper.ReadInConfig(); err != nil {
 		log.Fatalf("读取配置文件失败: %v", err)
 	}
@@ -40,5 +85,39 @@ func InitConfig() {
 		log.Fatalf("解析配置文件失败: %v", err)
 	}
 
+	validateHTTPChecks(config.HTTPChecks)
+	validateInterfaceAlerts(config.Alerts.Interface)
+
 	Config = &config
 }
+
+// 校验HTTP拨测配置并设置默认值
+func validateHTTPChecks(checks []HTTPCheck) {
+	for i := range checks {
+		check := &checks[i]
+		u, err := url.Parse(check.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			log.Fatalf("HTTP拨测[%d]地址无效: %q", i, check.URL)
+		}
+		if check.Name == "" {
+			check.Name = check.URL
+		}
+		check.Method = strings.ToUpper(check.Method)
+		if check.Method == "" {
+			check.Method = "GET"
+		}
+		if check.Timeout == 0 {
+			check.Timeout = 10 * time.Second
+		}
+		if check.Interval == 0 {
+			check.Interval = time.Minute
+		}
+	}
+}
+
+// 校验网卡告警阈值
+func validateInterfaceAlerts(alerts InterfaceAlerts) {
+	if alerts.ErrorRate < 0 || alerts.DropRate < 0 || alerts.CollisionRate < 0 || alerts.CarrierChanges < 0 {
+		log.Fatalf("网卡告警阈值不能为负数: %+v", alerts)
+	}
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// Alert 服务端根据客户端上报数据触发或解除的告警
+type Alert struct {
+	Interface string
+	// 告警类型，如interface_errors、interface_drops
+	Kind string
+	// 触发时的指标值和阈值
+	Value     float64
+	Threshold float64
+	// 为true时表示告警解除
+	Resolved bool
+	Message  string
+}
+
+// initAlertTable 创建告警记录表
+func initAlertTable() error {
+	createAlertTableSQL := `
+	CREATE TABLE IF NOT EXISTS alerts (
+		id SERIAL PRIMARY KEY,
+		client_id VARCHAR(64) NOT NULL,
+		timestamp TIMESTAMP NOT NULL,
+		interface VARCHAR(64) NOT NULL,
+		kind VARCHAR(32) NOT NULL,
+		value DOUBLE PRECISION NOT NULL,
+		threshold DOUBLE PRECISION NOT NULL,
+		resolved BOOLEAN NOT NULL DEFAULT FALSE,
+		message TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (client_id) REFERENCES clients(client_id) ON DELETE CASCADE
+	);
+
+	-- 创建客户端ID和时间的复合索引
+	CREATE INDEX IF NOT EXISTS idx_alerts_client_timestamp
+	ON alerts(client_id, timestamp DESC);
+	`
+
+	if _, err := Pool.Exec(ctx, createAlertTableSQL); err != nil {
+		return fmt.Errorf("创建告警记录表失败: %v", err)
+	}
+	return nil
+}
+
+// SaveAlerts 保存告警的触发和解除记录
+func SaveAlerts(clientID string, timestamp time.Time, alerts []Alert) error {
+	sql := `
+		INSERT INTO alerts (
+			client_id, timestamp, interface, kind, value, threshold, resolved, message
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+
+	for _, alert := range alerts {
+		_, err := Pool.Exec(ctx, sql,
+			clientID,
+			timestamp,
+			alert.Interface,
+			alert.Kind,
+			alert.Value,
+			alert.Threshold,
+			alert.Resolved,
+			alert.Message)
+		if err != nil {
+			return fmt.Errorf("保存告警记录失败: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// CaptureGap 客户端抓包中断事件
+// 中断开始时上报一次（End为空），恢复后以相同的Start再上报一次
+type CaptureGap struct {
+	Interface string     `json:"interface"`
+	Start     time.Time  `json:"start"`
+	End       *time.Time `json:"end,omitempty"`
+	Duration  float64    `json:"duration"`
+	Reason    string     `json:"reason"`
+}
+
+// initCaptureGapTable 创建抓包中断事件表
+func initCaptureGapTable() error {
+	createCaptureGapTableSQL := `
+	CREATE TABLE IF NOT EXISTS capture_gaps (
+		id SERIAL PRIMARY KEY,
+		client_id VARCHAR(64) NOT NULL,
+		interface VARCHAR(64) NOT NULL,
+		timestamp TIMESTAMP NOT NULL,
+		end_time TIMESTAMP,
+		duration DOUBLE PRECISION NOT NULL DEFAULT 0,
+		reason TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (client_id) REFERENCES clients(client_id) ON DELETE CASCADE,
+		UNIQUE (client_id, interface, timestamp)
+	);
+	`
+
+	if _, err := Pool.Exec(ctx, createCaptureGapTableSQL); err != nil {
+		return fmt.Errorf("创建抓包中断事件表失败: %v", err)
+	}
+	return nil
+}
+
+// SaveCaptureGaps 保存抓包中断事件，恢复事件更新对应的中断记录
+func SaveCaptureGaps(clientID string, gaps []CaptureGap) error {
+	sql := `
+		INSERT INTO capture_gaps (client_id, interface, timestamp, end_time, duration, reason)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (client_id, interface, timestamp) DO UPDATE
+		SET end_time = EXCLUDED.end_time, duration = EXCLUDED.duration
+	`
+
+	for _, gap := range gaps {
+		_, err := Pool.Exec(ctx, sql,
+			clientID,
+			gap.Interface,
+			gap.Start,
+			gap.End,
+			gap.Duration,
+			gap.Reason)
+		if err != nil {
+			return fmt.Errorf("保存抓包中断事件失败: %v", err)
+		}
+	}
+
+	return nil
+}
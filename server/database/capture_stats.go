@@ -0,0 +1,72 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// CaptureStat 客户端单个网卡在一个上报周期内的抓包统计
+type CaptureStat struct {
+	Interface string  `json:"interface"`
+	Received  uint64  `json:"received"`
+	Dropped   uint64  `json:"dropped"`
+	IfDropped uint64  `json:"if_dropped"`
+	LossRatio float64 `json:"loss_ratio"`
+}
+
+// Lossy 判断该周期内是否有丢包，有丢包时带宽统计偏低
+func (s *CaptureStat) Lossy() bool {
+	return s.Dropped > 0 || s.IfDropped > 0
+}
+
+// initCaptureStatsTable 创建抓包统计表
+func initCaptureStatsTable() error {
+	createCaptureStatsTableSQL := `
+	CREATE TABLE IF NOT EXISTS capture_stats (
+		id SERIAL PRIMARY KEY,
+		client_id VARCHAR(64) NOT NULL,
+		timestamp TIMESTAMP NOT NULL,
+		interface VARCHAR(64) NOT NULL,
+		received BIGINT NOT NULL,
+		dropped BIGINT NOT NULL,
+		if_dropped BIGINT NOT NULL,
+		loss_ratio DOUBLE PRECISION NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (client_id) REFERENCES clients(client_id) ON DELETE CASCADE
+	);
+
+	-- 创建客户端ID、网卡和时间的复合索引
+	CREATE INDEX IF NOT EXISTS idx_capture_stats_client_interface_timestamp
+	ON capture_stats(client_id, interface, timestamp DESC);
+	`
+
+	if _, err := Pool.Exec(ctx, createCaptureStatsTableSQL); err != nil {
+		return fmt.Errorf("创建抓包统计表失败: %v", err)
+	}
+	return nil
+}
+
+// SaveCaptureStats 保存各网卡的抓包统计
+func SaveCaptureStats(clientID string, timestamp time.Time, stats []CaptureStat) error {
+	sql := `
+		INSERT INTO capture_stats (
+			client_id, timestamp, interface, received, dropped, if_dropped, loss_ratio
+		) VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	for _, stat := range stats {
+		_, err := Pool.Exec(ctx, sql,
+			clientID,
+			timestamp,
+			stat.Interface,
+			int64(stat.Received),
+			int64(stat.Dropped),
+			int64(stat.IfDropped),
+			stat.LossRatio)
+		if err != nil {
+			return fmt.Errorf("保存抓包统计失败: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// ContainerTraffic 客户端单个容器（不在容器内的进程按cgroup）在一个上报周期内的流量（字节）
+type ContainerTraffic struct {
+	ContainerID      string `json:"container_id,omitempty"`
+	ContainerName    string `json:"container_name,omitempty"`
+	ContainerRuntime string `json:"container_runtime,omitempty"`
+	Cgroup           string `json:"cgroup"`
+	NetNS            uint64 `json:"netns"`
+	Processes        int    `json:"processes"`
+	UploadBytes      uint64 `json:"upload_bytes"`
+	DownloadBytes    uint64 `json:"download_bytes"`
+	InternalBytes    uint64 `json:"internal_bytes"`
+}
+
+// initContainerTrafficTable 创建容器流量表
+func initContainerTrafficTable() error {
+	createContainerTrafficTableSQL := `
+	CREATE TABLE IF NOT EXISTS container_traffic (
+		id SERIAL PRIMARY KEY,
+		client_id VARCHAR(64) NOT NULL,
+		timestamp TIMESTAMP NOT NULL,
+		container_id VARCHAR(64) NOT NULL,
+		container_name VARCHAR(255) NOT NULL,
+		container_runtime VARCHAR(16) NOT NULL,
+		cgroup TEXT NOT NULL,
+		netns BIGINT NOT NULL,
+		processes INTEGER NOT NULL,
+		upload_bytes BIGINT NOT NULL,
+		download_bytes BIGINT NOT NULL,
+		internal_bytes BIGINT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (client_id) REFERENCES clients(client_id) ON DELETE CASCADE
+	);
+
+	-- 创建客户端ID和时间的复合索引
+	CREATE INDEX IF NOT EXISTS idx_container_traffic_client_timestamp
+	ON container_traffic(client_id, timestamp DESC);
+	`
+
+	if _, err := Pool.Exec(ctx, createContainerTrafficTableSQL); err != nil {
+		return fmt.Errorf("创建容器流量表失败: %v", err)
+	}
+	return nil
+}
+
+// SaveContainerTraffic 保存流量最大的容器
+func SaveContainerTraffic(clientID string, timestamp time.Time, containers []ContainerTraffic) error {
+	sql := `
+		INSERT INTO container_traffic (
+			client_id, timestamp, container_id, container_name, container_runtime, cgroup, netns,
+			processes, upload_bytes, download_bytes, internal_bytes
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`
+
+	for _, container := range containers {
+		_, err := Pool.Exec(ctx, sql,
+			clientID,
+			timestamp,
+			container.ContainerID,
+			container.ContainerName,
+			container.ContainerRuntime,
+			container.Cgroup,
+			int64(container.NetNS),
+			container.Processes,
+			int64(container.UploadBytes),
+			int64(container.DownloadBytes),
+			int64(container.InternalBytes))
+		if err != nil {
+			return fmt.Errorf("保存容器流量失败: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -89,10 +89,16 @@ func initTables() error {
 		download_speed DOUBLE PRECISION NOT NULL,
 		avg_upload_packet_size DOUBLE PRECISION NOT NULL,
 		avg_download_packet_size DOUBLE PRECISION NOT NULL,
+		internal_speed DOUBLE PRECISION NOT NULL DEFAULT 0,
+		lossy BOOLEAN NOT NULL DEFAULT FALSE,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		FOREIGN KEY (client_id) REFERENCES clients(client_id) ON DELETE CASCADE
 	);
 
+	-- 旧版本创建的表补充内网速率和丢包标记字段
+	ALTER TABLE bandwidth_stats ADD COLUMN IF NOT EXISTS internal_speed DOUBLE PRECISION NOT NULL DEFAULT 0;
+	ALTER TABLE bandwidth_stats ADD COLUMN IF NOT EXISTS lossy BOOLEAN NOT NULL DEFAULT FALSE;
+
 	-- 创建时间和客户端ID的复合索引
 	CREATE INDEX IF NOT EXISTS idx_bandwidth_stats_client_timestamp 
 	ON bandwidth_stats(client_id, timestamp DESC);
@@ -107,6 +113,74 @@ func initTables() error {
 		return fmt.Errorf("创建带宽统计表失败: %v", err)
 	}
 
+	if err := initInterfaceBandwidthTable(); err != nil {
+		return err
+	}
+
+	if err := initTCPHealthTable(); err != nil {
+		return err
+	}
+
+	if err := initTCPRTTTable(); err != nil {
+		return err
+	}
+
+	if err := initProbeTable(); err != nil {
+		return err
+	}
+
+	if err := initDNSTables(); err != nil {
+		return err
+	}
+
+	if err := initHTTPCheckTable(); err != nil {
+		return err
+	}
+
+	if err := initCaptureGapTable(); err != nil {
+		return err
+	}
+
+	if err := initSegmentBandwidthTable(); err != nil {
+		return err
+	}
+
+	if err := initEncapsulationTable(); err != nil {
+		return err
+	}
+
+	if err := initCaptureStatsTable(); err != nil {
+		return err
+	}
+
+	if err := initSamplingTable(); err != nil {
+		return err
+	}
+
+	if err := initInterfaceHealthTables(); err != nil {
+		return err
+	}
+
+	if err := initAlertTable(); err != nil {
+		return err
+	}
+
+	if err := initProcessTrafficTable(); err != nil {
+		return err
+	}
+
+	if err := initContainerTrafficTable(); err != nil {
+		return err
+	}
+
+	if err := initRemoteTrafficTables(); err != nil {
+		return err
+	}
+
+	if err := initHostnameTrafficTable(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -145,13 +219,13 @@ func UpdateClientLastSeen(clientID string) error {
 	return nil
 }
 
-// SaveBandwidthData 保存带宽数据
-func SaveBandwidthData(clientID string, timestamp time.Time, uploadSpeed, downloadSpeed, avgUploadPacketSize, avgDownloadPacketSize float64) error {
+// SaveBandwidthData 保存带宽数据，lossy表示该周期内抓包有丢包，带宽统计偏低
+func SaveBandwidthData(clientID string, timestamp time.Time, uploadSpeed, downloadSpeed, avgUploadPacketSize, avgDownloadPacketSize, internalSpeed float64, lossy bool) error {
 	sql := `
 		INSERT INTO bandwidth_stats (
 			client_id, timestamp, upload_speed, download_speed, 
-			avg_upload_packet_size, avg_download_packet_size
-		) VALUES ($1, $2, $3, $4, $5, $6)
+			avg_upload_packet_size, avg_download_packet_size, internal_speed, lossy
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 	`
 
 	_, err := Pool.Exec(ctx, sql,
@@ -160,7 +234,9 @@ func SaveBandwidthData(clientID string, timestamp time.Time, uploadSpeed, downlo
 		uploadSpeed,
 		downloadSpeed,
 		avgUploadPacketSize,
-		avgDownloadPacketSize)
+		avgDownloadPacketSize,
+		internalSpeed,
+		lossy)
 
 	if err != nil {
 		return fmt.Errorf("保存带宽数据失败: %v", err)
@@ -174,7 +250,7 @@ func SaveBandwidthData(clientID string, timestamp time.Time, uploadSpeed, downlo
 func GetBandwidthStats(clientID string, startTime, endTime time.Time) ([]BandwidthStat, error) {
 	sql := `
 		SELECT timestamp, upload_speed, download_speed, 
-			   avg_upload_packet_size, avg_download_packet_size
+			   avg_upload_packet_size, avg_download_packet_size, internal_speed, lossy
 		FROM bandwidth_stats
 		WHERE client_id = $1 AND timestamp BETWEEN $2 AND $3
 		ORDER BY timestamp DESC
@@ -195,6 +271,8 @@ func GetBandwidthStats(clientID string, startTime, endTime time.Time) ([]Bandwid
 			&stat.DownloadSpeed,
 			&stat.AvgUploadPacketSize,
 			&stat.AvgDownloadPacketSize,
+			&stat.InternalSpeed,
+			&stat.Lossy,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("解析带宽数据失败: %v", err)
@@ -243,16 +321,44 @@ func startCleanupTask() {
 	}
 }
 
+// retentionTables 需要定期清理的时序数据表
+var retentionTables = []string{
+	"bandwidth_stats",
+	"interface_bandwidth_stats",
+	"tcp_health_stats",
+	"tcp_rtt_stats",
+	"probe_results",
+	"dns_stats",
+	"dns_probe_results",
+	"http_check_results",
+	"capture_gaps",
+	"segment_bandwidth_stats",
+	"encapsulation_stats",
+	"capture_stats",
+	"sampling_stats",
+	"interface_health_stats",
+	"interface_link_changes",
+	"alerts",
+	"process_traffic",
+	"container_traffic",
+	"remote_traffic",
+	"remote_peer_traffic",
+	"remote_group_traffic",
+	"hostname_traffic",
+}
+
 // cleanupOldData 清理超过一周的数据
 func cleanupOldData() error {
-	sql := `
-		DELETE FROM bandwidth_stats
+	for _, table := range retentionTables {
+		sql := fmt.Sprintf(`
+		DELETE FROM %s
 		WHERE timestamp < NOW() - INTERVAL '7 days'
-	`
+	`, table)
 
-	_, err := Pool.Exec(ctx, sql)
-	if err != nil {
-		return fmt.Errorf("清理旧数据失败: %v", err)
+		_, err := Pool.Exec(ctx, sql)
+		if err != nil {
+			return fmt.Errorf("清理旧数据失败: %v", err)
+		}
 	}
 
 	log.Println("已清理超过一周的数据")
@@ -274,6 +380,9 @@ type BandwidthStat struct {
 	DownloadSpeed         float64   `json:"download_speed"`
 	AvgUploadPacketSize   float64   `json:"avg_upload_packet_size"`
 	AvgDownloadPacketSize float64   `json:"avg_download_packet_size"`
+	InternalSpeed         float64   `json:"internal_speed"`
+	// 该周期内抓包有丢包，带宽统计偏低
+	Lossy bool `json:"lossy"`
 }
 
 // ClientInfo 客户端信息结构
@@ -0,0 +1,164 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DNSStat 被动DNS统计
+type DNSStat struct {
+	Queries     uint64     `json:"queries"`
+	Responses   uint64     `json:"responses"`
+	NoError     uint64     `json:"noerror"`
+	NXDomain    uint64     `json:"nxdomain"`
+	ServFail    uint64     `json:"servfail"`
+	OtherErrors uint64     `json:"other_errors"`
+	Timeouts    uint64     `json:"timeouts"`
+	Latency     RTTSummary `json:"latency"`
+	// 客户端采样时的采样率，计数只来自被采样的数据包、未放大，不统计超时
+	SampleRate int `json:"sample_rate,omitempty"`
+}
+
+// DNSProbeResult DNS解析探测结果
+type DNSProbeResult struct {
+	Name      string    `json:"name"`
+	Resolver  string    `json:"resolver"`
+	Query     string    `json:"query"`
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	Latency   float64   `json:"latency_ms"`
+	Rcode     string    `json:"rcode,omitempty"`
+	Answers   []string  `json:"answers,omitempty"`
+	Success   bool      `json:"success"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// initDNSTables 创建DNS统计表和DNS探测结果表
+func initDNSTables() error {
+	createDNSStatsTableSQL := `
+	CREATE TABLE IF NOT EXISTS dns_stats (
+		id SERIAL PRIMARY KEY,
+		client_id VARCHAR(64) NOT NULL,
+		timestamp TIMESTAMP NOT NULL,
+		queries BIGINT NOT NULL,
+		responses BIGINT NOT NULL,
+		noerror BIGINT NOT NULL,
+		nxdomain BIGINT NOT NULL,
+		servfail BIGINT NOT NULL,
+		other_errors BIGINT NOT NULL,
+		timeouts BIGINT NOT NULL,
+		latency_count INTEGER NOT NULL,
+		latency_avg_ms DOUBLE PRECISION NOT NULL,
+		latency_p50_ms DOUBLE PRECISION NOT NULL,
+		latency_p90_ms DOUBLE PRECISION NOT NULL,
+		latency_p99_ms DOUBLE PRECISION NOT NULL,
+		latency_max_ms DOUBLE PRECISION NOT NULL,
+		sample_rate INTEGER NOT NULL DEFAULT 1,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (client_id) REFERENCES clients(client_id) ON DELETE CASCADE
+	);
+
+	-- 旧版本创建的表补充采样率字段
+	ALTER TABLE dns_stats ADD COLUMN IF NOT EXISTS sample_rate INTEGER NOT NULL DEFAULT 1;
+
+	-- 创建时间和客户端ID的复合索引
+	CREATE INDEX IF NOT EXISTS idx_dns_stats_client_timestamp
+	ON dns_stats(client_id, timestamp DESC);
+	`
+
+	createDNSProbeTableSQL := `
+	CREATE TABLE IF NOT EXISTS dns_probe_results (
+		id SERIAL PRIMARY KEY,
+		client_id VARCHAR(64) NOT NULL,
+		timestamp TIMESTAMP NOT NULL,
+		name VARCHAR(128) NOT NULL,
+		resolver VARCHAR(256) NOT NULL,
+		query VARCHAR(256) NOT NULL,
+		query_type VARCHAR(16) NOT NULL,
+		latency_ms DOUBLE PRECISION NOT NULL,
+		rcode VARCHAR(16),
+		answers TEXT,
+		success BOOLEAN NOT NULL,
+		error TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (client_id) REFERENCES clients(client_id) ON DELETE CASCADE
+	);
+
+	-- 创建时间、客户端ID和目标名称的复合索引
+	CREATE INDEX IF NOT EXISTS idx_dns_probe_results_client_name_timestamp
+	ON dns_probe_results(client_id, name, timestamp DESC);
+	`
+
+	if _, err := Pool.Exec(ctx, createDNSStatsTableSQL); err != nil {
+		return fmt.Errorf("创建DNS统计表失败: %v", err)
+	}
+	if _, err := Pool.Exec(ctx, createDNSProbeTableSQL); err != nil {
+		return fmt.Errorf("创建DNS探测结果表失败: %v", err)
+	}
+	return nil
+}
+
+// SaveDNSStats 保存被动DNS统计
+func SaveDNSStats(clientID string, timestamp time.Time, stat *DNSStat) error {
+	sql := `
+		INSERT INTO dns_stats (
+			client_id, timestamp, queries, responses, noerror, nxdomain,
+			servfail, other_errors, timeouts, latency_count, latency_avg_ms,
+			latency_p50_ms, latency_p90_ms, latency_p99_ms, latency_max_ms, sample_rate
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+	`
+
+	_, err := Pool.Exec(ctx, sql,
+		clientID,
+		timestamp,
+		stat.Queries,
+		stat.Responses,
+		stat.NoError,
+		stat.NXDomain,
+		stat.ServFail,
+		stat.OtherErrors,
+		stat.Timeouts,
+		stat.Latency.Count,
+		stat.Latency.Avg,
+		stat.Latency.P50,
+		stat.Latency.P90,
+		stat.Latency.P99,
+		stat.Latency.Max,
+		sampleRate(stat.SampleRate))
+	if err != nil {
+		return fmt.Errorf("保存DNS统计失败: %v", err)
+	}
+
+	return nil
+}
+
+// SaveDNSProbeResults 保存DNS解析探测结果
+func SaveDNSProbeResults(clientID string, results []DNSProbeResult) error {
+	sql := `
+		INSERT INTO dns_probe_results (
+			client_id, timestamp, name, resolver, query, query_type,
+			latency_ms, rcode, answers, success, error
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`
+
+	for _, r := range results {
+		_, err := Pool.Exec(ctx, sql,
+			clientID,
+			r.Timestamp,
+			r.Name,
+			r.Resolver,
+			r.Query,
+			r.Type,
+			r.Latency,
+			r.Rcode,
+			strings.Join(r.Answers, ","),
+			r.Success,
+			r.Error)
+		if err != nil {
+			return fmt.Errorf("保存DNS探测结果失败: %v", err)
+		}
+	}
+
+	return nil
+}
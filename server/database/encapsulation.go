@@ -0,0 +1,103 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// VLANStat 单个VLAN的流量速率
+type VLANStat struct {
+	VLAN          uint16  `json:"vlan"`
+	UploadSpeed   float64 `json:"upload_speed"`
+	DownloadSpeed float64 `json:"download_speed"`
+	InternalSpeed float64 `json:"internal_speed"`
+}
+
+// TunnelStat 单个隧道（租户网络）的流量速率
+type TunnelStat struct {
+	// 隧道类型：vxlan、geneve、gre、ipip
+	Type          string  `json:"type"`
+	VNI           uint32  `json:"vni"`
+	UploadSpeed   float64 `json:"upload_speed"`
+	DownloadSpeed float64 `json:"download_speed"`
+	InternalSpeed float64 `json:"internal_speed"`
+}
+
+// EncapsulationStat 单个网卡按VLAN和隧道区分的流量
+type EncapsulationStat struct {
+	Interface string       `json:"interface"`
+	VLANs     []VLANStat   `json:"vlans,omitempty"`
+	Tunnels   []TunnelStat `json:"tunnels,omitempty"`
+}
+
+// initEncapsulationTable 创建VLAN和隧道流量统计表
+// type为vlan时network_id为VLAN ID，否则为隧道的VNI或GRE Key
+func initEncapsulationTable() error {
+	createEncapsulationTableSQL := `
+	CREATE TABLE IF NOT EXISTS encapsulation_stats (
+		id SERIAL PRIMARY KEY,
+		client_id VARCHAR(64) NOT NULL,
+		timestamp TIMESTAMP NOT NULL,
+		interface VARCHAR(64) NOT NULL,
+		type VARCHAR(16) NOT NULL,
+		network_id BIGINT NOT NULL,
+		upload_speed DOUBLE PRECISION NOT NULL,
+		download_speed DOUBLE PRECISION NOT NULL,
+		internal_speed DOUBLE PRECISION NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (client_id) REFERENCES clients(client_id) ON DELETE CASCADE
+	);
+
+	-- 创建客户端ID、封装类型、网络标识和时间的复合索引
+	CREATE INDEX IF NOT EXISTS idx_encapsulation_stats_client_type_network_timestamp
+	ON encapsulation_stats(client_id, type, network_id, timestamp DESC);
+	`
+
+	if _, err := Pool.Exec(ctx, createEncapsulationTableSQL); err != nil {
+		return fmt.Errorf("创建VLAN和隧道流量统计表失败: %v", err)
+	}
+	return nil
+}
+
+// SaveEncapsulation 保存各网卡按VLAN和隧道区分的流量
+func SaveEncapsulation(clientID string, timestamp time.Time, stats []EncapsulationStat) error {
+	sql := `
+		INSERT INTO encapsulation_stats (
+			client_id, timestamp, interface, type, network_id,
+			upload_speed, download_speed, internal_speed
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+
+	for _, stat := range stats {
+		for _, vlan := range stat.VLANs {
+			_, err := Pool.Exec(ctx, sql,
+				clientID,
+				timestamp,
+				stat.Interface,
+				"vlan",
+				int64(vlan.VLAN),
+				vlan.UploadSpeed,
+				vlan.DownloadSpeed,
+				vlan.InternalSpeed)
+			if err != nil {
+				return fmt.Errorf("保存VLAN流量统计失败: %v", err)
+			}
+		}
+		for _, tunnel := range stat.Tunnels {
+			_, err := Pool.Exec(ctx, sql,
+				clientID,
+				timestamp,
+				stat.Interface,
+				tunnel.Type,
+				int64(tunnel.VNI),
+				tunnel.UploadSpeed,
+				tunnel.DownloadSpeed,
+				tunnel.InternalSpeed)
+			if err != nil {
+				return fmt.Errorf("保存隧道流量统计失败: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// HostnameTraffic 客户端单个服务器名称（TLS SNI、HTTP Host）在一个上报周期内的流量（字节）
+// 无法识别时为反向解析缓存中的域名（source为dns或ptr），名称为空的记录为无法识别名称的流量
+type HostnameTraffic struct {
+	Hostname      string `json:"hostname"`
+	Source        string `json:"source,omitempty"`
+	Flows         int    `json:"flows"`
+	UploadBytes   uint64 `json:"upload_bytes"`
+	DownloadBytes uint64 `json:"download_bytes"`
+	InternalBytes uint64 `json:"internal_bytes"`
+}
+
+// initHostnameTrafficTable 创建服务器名称流量表
+func initHostnameTrafficTable() error {
+	createHostnameTrafficTableSQL := `
+	CREATE TABLE IF NOT EXISTS hostname_traffic (
+		id SERIAL PRIMARY KEY,
+		client_id VARCHAR(64) NOT NULL,
+		timestamp TIMESTAMP NOT NULL,
+		hostname VARCHAR(255) NOT NULL,
+		source VARCHAR(8) NOT NULL,
+		flows INTEGER NOT NULL,
+		upload_bytes BIGINT NOT NULL,
+		download_bytes BIGINT NOT NULL,
+		internal_bytes BIGINT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (client_id) REFERENCES clients(client_id) ON DELETE CASCADE
+	);
+
+	-- 创建客户端ID和时间的复合索引
+	CREATE INDEX IF NOT EXISTS idx_hostname_traffic_client_timestamp
+	ON hostname_traffic(client_id, timestamp DESC);
+	`
+
+	if _, err := Pool.Exec(ctx, createHostnameTrafficTableSQL); err != nil {
+		return fmt.Errorf("创建服务器名称流量表失败: %v", err)
+	}
+	return nil
+}
+
+// SaveHostnameTraffic 保存流量最大的服务器名称
+func SaveHostnameTraffic(clientID string, timestamp time.Time, hostnames []HostnameTraffic) error {
+	sql := `
+		INSERT INTO hostname_traffic (
+			client_id, timestamp, hostname, source, flows, upload_bytes, download_bytes, internal_bytes
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+
+	for _, hostname := range hostnames {
+		_, err := Pool.Exec(ctx, sql,
+			clientID,
+			timestamp,
+			hostname.Hostname,
+			hostname.Source,
+			hostname.Flows,
+			int64(hostname.UploadBytes),
+			int64(hostname.DownloadBytes),
+			int64(hostname.InternalBytes))
+		if err != nil {
+			return fmt.Errorf("保存服务器名称流量失败: %v", err)
+		}
+	}
+
+	return nil
+}
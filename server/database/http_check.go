@@ -0,0 +1,84 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// HTTPCheckResult 客户端执行HTTP拨测的结果
+type HTTPCheckResult struct {
+	Name       string    `json:"name"`
+	URL        string    `json:"url"`
+	Timestamp  time.Time `json:"timestamp"`
+	StatusCode int       `json:"status_code"`
+	DNS        float64   `json:"dns_ms"`
+	Connect    float64   `json:"connect_ms"`
+	TLS        float64   `json:"tls_ms"`
+	TTFB       float64   `json:"ttfb_ms"`
+	Total      float64   `json:"total_ms"`
+	Success    bool      `json:"success"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// initHTTPCheckTable 创建HTTP拨测结果表
+func initHTTPCheckTable() error {
+	createHTTPCheckTableSQL := `
+	CREATE TABLE IF NOT EXISTS http_check_results (
+		id SERIAL PRIMARY KEY,
+		client_id VARCHAR(64) NOT NULL,
+		timestamp TIMESTAMP NOT NULL,
+		name VARCHAR(128) NOT NULL,
+		url TEXT NOT NULL,
+		status_code INTEGER NOT NULL,
+		dns_ms DOUBLE PRECISION NOT NULL,
+		connect_ms DOUBLE PRECISION NOT NULL,
+		tls_ms DOUBLE PRECISION NOT NULL,
+		ttfb_ms DOUBLE PRECISION NOT NULL,
+		total_ms DOUBLE PRECISION NOT NULL,
+		success BOOLEAN NOT NULL,
+		error TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (client_id) REFERENCES clients(client_id) ON DELETE CASCADE
+	);
+
+	-- 创建时间、客户端ID和拨测名称的复合索引
+	CREATE INDEX IF NOT EXISTS idx_http_check_results_client_name_timestamp
+	ON http_check_results(client_id, name, timestamp DESC);
+	`
+
+	if _, err := Pool.Exec(ctx, createHTTPCheckTableSQL); err != nil {
+		return fmt.Errorf("创建HTTP拨测结果表失败: %v", err)
+	}
+	return nil
+}
+
+// SaveHTTPCheckResults 保存HTTP拨测结果
+func SaveHTTPCheckResults(clientID string, results []HTTPCheckResult) error {
+	sql := `
+		INSERT INTO http_check_results (
+			client_id, timestamp, name, url, status_code, dns_ms, connect_ms,
+			tls_ms, ttfb_ms, total_ms, success, error
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	`
+
+	for _, r := range results {
+		_, err := Pool.Exec(ctx, sql,
+			clientID,
+			r.Timestamp,
+			r.Name,
+			r.URL,
+			r.StatusCode,
+			r.DNS,
+			r.Connect,
+			r.TLS,
+			r.TTFB,
+			r.Total,
+			r.Success,
+			r.Error)
+		if err != nil {
+			return fmt.Errorf("保存HTTP拨测结果失败: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// InterfaceBandwidth 单个网卡的带宽统计
+type InterfaceBandwidth struct {
+	Interface             string  `json:"interface"`
+	UploadSpeed           float64 `json:"upload_speed"`
+	DownloadSpeed         float64 `json:"download_speed"`
+	AvgUploadPacketSize   float64 `json:"avg_upload_packet_size"`
+	AvgDownloadPacketSize float64 `json:"avg_download_packet_size"`
+	InternalSpeed         float64 `json:"internal_speed"`
+	// 按网关MAC区分的WAN/LAN带宽（客户端未获知网关MAC时为空）
+	Segments *SegmentStat `json:"segments,omitempty"`
+	// 数据来源：capture（抓包）、counters（网卡内核计数器，没有内网速率和WAN/LAN区分），旧版本客户端不上报
+	Source string `json:"source,omitempty"`
+	// 采样方式及误差范围（客户端不采样时为空）
+	Sampling *SamplingStat `json:"sampling,omitempty"`
+	// 该周期内网卡抓包有丢包，由服务端根据抓包统计设置
+	Lossy bool `json:"lossy"`
+}
+
+// initInterfaceBandwidthTable 创建网卡带宽统计表
+func initInterfaceBandwidthTable() error {
+	createInterfaceBandwidthTableSQL := `
+	CREATE TABLE IF NOT EXISTS interface_bandwidth_stats (
+		id SERIAL PRIMARY KEY,
+		client_id VARCHAR(64) NOT NULL,
+		timestamp TIMESTAMP NOT NULL,
+		interface VARCHAR(64) NOT NULL,
+		upload_speed DOUBLE PRECISION NOT NULL,
+		download_speed DOUBLE PRECISION NOT NULL,
+		avg_upload_packet_size DOUBLE PRECISION NOT NULL,
+		avg_download_packet_size DOUBLE PRECISION NOT NULL,
+		internal_speed DOUBLE PRECISION NOT NULL DEFAULT 0,
+		lossy BOOLEAN NOT NULL DEFAULT FALSE,
+		source VARCHAR(16) NOT NULL DEFAULT 'capture',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (client_id) REFERENCES clients(client_id) ON DELETE CASCADE
+	);
+
+	-- 旧版本创建的表补充内网速率、丢包标记和数据来源字段
+	ALTER TABLE interface_bandwidth_stats ADD COLUMN IF NOT EXISTS internal_speed DOUBLE PRECISION NOT NULL DEFAULT 0;
+	ALTER TABLE interface_bandwidth_stats ADD COLUMN IF NOT EXISTS lossy BOOLEAN NOT NULL DEFAULT FALSE;
+	ALTER TABLE interface_bandwidth_stats ADD COLUMN IF NOT EXISTS source VARCHAR(16) NOT NULL DEFAULT 'capture';
+
+	-- 创建客户端ID、网卡和时间的复合索引
+	CREATE INDEX IF NOT EXISTS idx_interface_bandwidth_stats_client_interface_timestamp
+	ON interface_bandwidth_stats(client_id, interface, timestamp DESC);
+	`
+
+	if _, err := Pool.Exec(ctx, createInterfaceBandwidthTableSQL); err != nil {
+		return fmt.Errorf("创建网卡带宽统计表失败: %v", err)
+	}
+	return nil
+}
+
+// SaveInterfaceBandwidth 保存各网卡的带宽统计
+func SaveInterfaceBandwidth(clientID string, timestamp time.Time, interfaces []InterfaceBandwidth) error {
+	sql := `
+		INSERT INTO interface_bandwidth_stats (
+			client_id, timestamp, interface, upload_speed, download_speed,
+			avg_upload_packet_size, avg_download_packet_size, internal_speed, lossy, source
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+
+	for _, iface := range interfaces {
+		source := iface.Source
+		if source == "" {
+			source = "capture"
+		}
+		_, err := Pool.Exec(ctx, sql,
+			clientID,
+			timestamp,
+			iface.Interface,
+			iface.UploadSpeed,
+			iface.DownloadSpeed,
+			iface.AvgUploadPacketSize,
+			iface.AvgDownloadPacketSize,
+			iface.InternalSpeed,
+			iface.Lossy,
+			source)
+		if err != nil {
+			return fmt.Errorf("保存网卡带宽统计失败: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// GetInterfaceBandwidth 获取指定客户端某个网卡的带宽统计
+func GetInterfaceBandwidth(clientID, iface string, startTime, endTime time.Time) ([]BandwidthStat, error) {
+	sql := `
+		SELECT timestamp, upload_speed, download_speed,
+			   avg_upload_packet_size, avg_download_packet_size, internal_speed, lossy
+		FROM interface_bandwidth_stats
+		WHERE client_id = $1 AND interface = $2 AND timestamp BETWEEN $3 AND $4
+		ORDER BY timestamp DESC
+	`
+
+	rows, err := Pool.Query(ctx, sql, clientID, iface, startTime, endTime)
+	if err != nil {
+		return nil, fmt.Errorf("查询网卡带宽统计失败: %v", err)
+	}
+	defer rows.Close()
+
+	var stats []BandwidthStat
+	for rows.Next() {
+		var stat BandwidthStat
+		err := rows.Scan(
+			&stat.Timestamp,
+			&stat.UploadSpeed,
+			&stat.DownloadSpeed,
+			&stat.AvgUploadPacketSize,
+			&stat.AvgDownloadPacketSize,
+			&stat.InternalSpeed,
+			&stat.Lossy,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("解析网卡带宽统计失败: %v", err)
+		}
+		stats = append(stats, stat)
+	}
+
+	return stats, nil
+}
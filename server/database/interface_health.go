@@ -0,0 +1,160 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// LinkChange 客户端网卡的链路状态、速率或双工模式变化
+type LinkChange struct {
+	Time      time.Time `json:"time"`
+	OperState string    `json:"oper_state"`
+	Speed     int       `json:"speed"`
+	Duplex    string    `json:"duplex"`
+}
+
+// InterfaceHealthStat 客户端单个网卡在一个上报周期内的错误、丢弃和冲突计数及链路状态
+type InterfaceHealthStat struct {
+	Interface string `json:"interface"`
+	// 统计时长（秒）
+	Interval        float64 `json:"interval"`
+	RxErrors        uint64  `json:"rx_errors"`
+	TxErrors        uint64  `json:"tx_errors"`
+	RxDropped       uint64  `json:"rx_dropped"`
+	TxDropped       uint64  `json:"tx_dropped"`
+	RxFifoErrors    uint64  `json:"rx_fifo_errors"`
+	RxFrameErrors   uint64  `json:"rx_frame_errors"`
+	TxFifoErrors    uint64  `json:"tx_fifo_errors"`
+	TxCarrierErrors uint64  `json:"tx_carrier_errors"`
+	Collisions      uint64  `json:"collisions"`
+	// 链路状态，速率单位为Mbps，客户端无法获取时为空
+	OperState      string       `json:"oper_state,omitempty"`
+	Speed          int          `json:"speed,omitempty"`
+	Duplex         string       `json:"duplex,omitempty"`
+	CarrierChanges uint64       `json:"carrier_changes"`
+	LinkChanges    []LinkChange `json:"link_changes,omitempty"`
+}
+
+// Errors 收发错误总数，FIFO、帧和载波错误已包含在收发错误中
+func (s *InterfaceHealthStat) Errors() uint64 {
+	return s.RxErrors + s.TxErrors
+}
+
+// Dropped 收发丢弃总数
+func (s *InterfaceHealthStat) Dropped() uint64 {
+	return s.RxDropped + s.TxDropped
+}
+
+// initInterfaceHealthTables 创建网卡错误计数表和链路状态变化表
+func initInterfaceHealthTables() error {
+	createInterfaceHealthTableSQL := `
+	CREATE TABLE IF NOT EXISTS interface_health_stats (
+		id SERIAL PRIMARY KEY,
+		client_id VARCHAR(64) NOT NULL,
+		timestamp TIMESTAMP NOT NULL,
+		interface VARCHAR(64) NOT NULL,
+		interval_seconds DOUBLE PRECISION NOT NULL,
+		rx_errors BIGINT NOT NULL,
+		tx_errors BIGINT NOT NULL,
+		rx_dropped BIGINT NOT NULL,
+		tx_dropped BIGINT NOT NULL,
+		rx_fifo_errors BIGINT NOT NULL,
+		rx_frame_errors BIGINT NOT NULL,
+		tx_fifo_errors BIGINT NOT NULL,
+		tx_carrier_errors BIGINT NOT NULL,
+		collisions BIGINT NOT NULL,
+		oper_state VARCHAR(16) NOT NULL DEFAULT '',
+		speed INTEGER NOT NULL DEFAULT 0,
+		duplex VARCHAR(8) NOT NULL DEFAULT '',
+		carrier_changes BIGINT NOT NULL DEFAULT 0,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (client_id) REFERENCES clients(client_id) ON DELETE CASCADE
+	);
+
+	-- 创建客户端ID、网卡和时间的复合索引
+	CREATE INDEX IF NOT EXISTS idx_interface_health_stats_client_interface_timestamp
+	ON interface_health_stats(client_id, interface, timestamp DESC);
+	`
+
+	createLinkChangeTableSQL := `
+	CREATE TABLE IF NOT EXISTS interface_link_changes (
+		id SERIAL PRIMARY KEY,
+		client_id VARCHAR(64) NOT NULL,
+		timestamp TIMESTAMP NOT NULL,
+		interface VARCHAR(64) NOT NULL,
+		oper_state VARCHAR(16) NOT NULL,
+		speed INTEGER NOT NULL,
+		duplex VARCHAR(8) NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (client_id) REFERENCES clients(client_id) ON DELETE CASCADE
+	);
+
+	-- 创建客户端ID、网卡和时间的复合索引
+	CREATE INDEX IF NOT EXISTS idx_interface_link_changes_client_interface_timestamp
+	ON interface_link_changes(client_id, interface, timestamp DESC);
+	`
+
+	if _, err := Pool.Exec(ctx, createInterfaceHealthTableSQL); err != nil {
+		return fmt.Errorf("创建网卡错误计数表失败: %v", err)
+	}
+	if _, err := Pool.Exec(ctx, createLinkChangeTableSQL); err != nil {
+		return fmt.Errorf("创建链路状态变化表失败: %v", err)
+	}
+	return nil
+}
+
+// SaveInterfaceHealth 保存各网卡的错误计数及链路状态变化
+func SaveInterfaceHealth(clientID string, timestamp time.Time, stats []InterfaceHealthStat) error {
+	statsSQL := `
+		INSERT INTO interface_health_stats (
+			client_id, timestamp, interface, interval_seconds,
+			rx_errors, tx_errors, rx_dropped, tx_dropped,
+			rx_fifo_errors, rx_frame_errors, tx_fifo_errors, tx_carrier_errors, collisions,
+			oper_state, speed, duplex, carrier_changes
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+	`
+	changeSQL := `
+		INSERT INTO interface_link_changes (
+			client_id, timestamp, interface, oper_state, speed, duplex
+		) VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	for _, stat := range stats {
+		_, err := Pool.Exec(ctx, statsSQL,
+			clientID,
+			timestamp,
+			stat.Interface,
+			stat.Interval,
+			int64(stat.RxErrors),
+			int64(stat.TxErrors),
+			int64(stat.RxDropped),
+			int64(stat.TxDropped),
+			int64(stat.RxFifoErrors),
+			int64(stat.RxFrameErrors),
+			int64(stat.TxFifoErrors),
+			int64(stat.TxCarrierErrors),
+			int64(stat.Collisions),
+			stat.OperState,
+			stat.Speed,
+			stat.Duplex,
+			int64(stat.CarrierChanges))
+		if err != nil {
+			return fmt.Errorf("保存网卡错误计数失败: %v", err)
+		}
+
+		for _, change := range stat.LinkChanges {
+			_, err := Pool.Exec(ctx, changeSQL,
+				clientID,
+				change.Time,
+				stat.Interface,
+				change.OperState,
+				change.Speed,
+				change.Duplex)
+			if err != nil {
+				return fmt.Errorf("保存链路状态变化失败: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
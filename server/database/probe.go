@@ -0,0 +1,130 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// ProbeResult 客户端主动探测结果
+type ProbeResult struct {
+	Name        string    `json:"name"`
+	Type        string    `json:"type"`
+	Target      string    `json:"target"`
+	Timestamp   time.Time `json:"timestamp"`
+	Sent        int       `json:"sent"`
+	Received    int       `json:"received"`
+	LossPercent float64   `json:"loss_percent"`
+	MinRTT      float64   `json:"min_rtt_ms"`
+	AvgRTT      float64   `json:"avg_rtt_ms"`
+	MaxRTT      float64   `json:"max_rtt_ms"`
+	Jitter      float64   `json:"jitter_ms"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// initProbeTable 创建探测结果表
+func initProbeTable() error {
+	createProbeTableSQL := `
+	CREATE TABLE IF NOT EXISTS probe_results (
+		id SERIAL PRIMARY KEY,
+		client_id VARCHAR(64) NOT NULL,
+		timestamp TIMESTAMP NOT NULL,
+		name VARCHAR(128) NOT NULL,
+		probe_type VARCHAR(16) NOT NULL,
+		target VARCHAR(256) NOT NULL,
+		sent INTEGER NOT NULL,
+		received INTEGER NOT NULL,
+		loss_percent DOUBLE PRECISION NOT NULL,
+		min_rtt_ms DOUBLE PRECISION NOT NULL,
+		avg_rtt_ms DOUBLE PRECISION NOT NULL,
+		max_rtt_ms DOUBLE PRECISION NOT NULL,
+		jitter_ms DOUBLE PRECISION NOT NULL,
+		error TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (client_id) REFERENCES clients(client_id) ON DELETE CASCADE
+	);
+
+	-- 创建时间、客户端ID和目标名称的复合索引
+	CREATE INDEX IF NOT EXISTS idx_probe_results_client_name_timestamp
+	ON probe_results(client_id, name, timestamp DESC);
+	`
+
+	if _, err := Pool.Exec(ctx, createProbeTableSQL); err != nil {
+		return fmt.Errorf("创建探测结果表失败: %v", err)
+	}
+	return nil
+}
+
+// SaveProbeResults 保存探测结果
+func SaveProbeResults(clientID string, results []ProbeResult) error {
+	sql := `
+		INSERT INTO probe_results (
+			client_id, timestamp, name, probe_type, target, sent, received,
+			loss_percent, min_rtt_ms, avg_rtt_ms, max_rtt_ms, jitter_ms, error
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	`
+
+	for _, r := range results {
+		_, err := Pool.Exec(ctx, sql,
+			clientID,
+			r.Timestamp,
+			r.Name,
+			r.Type,
+			r.Target,
+			r.Sent,
+			r.Received,
+			r.LossPercent,
+			r.MinRTT,
+			r.AvgRTT,
+			r.MaxRTT,
+			r.Jitter,
+			r.Error)
+		if err != nil {
+			return fmt.Errorf("保存探测结果失败: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// GetProbeResults 获取指定客户端的探测结果
+func GetProbeResults(clientID string, startTime, endTime time.Time) ([]ProbeResult, error) {
+	sql := `
+		SELECT timestamp, name, probe_type, target, sent, received,
+			   loss_percent, min_rtt_ms, avg_rtt_ms, max_rtt_ms, jitter_ms,
+			   COALESCE(error, '')
+		FROM probe_results
+		WHERE client_id = $1 AND timestamp BETWEEN $2 AND $3
+		ORDER BY timestamp DESC
+	`
+
+	rows, err := Pool.Query(ctx, sql, clientID, startTime, endTime)
+	if err != nil {
+		return nil, fmt.Errorf("查询探测结果失败: %v", err)
+	}
+	defer rows.Close()
+
+	var results []ProbeResult
+	for rows.Next() {
+		var r ProbeResult
+		err := rows.Scan(
+			&r.Timestamp,
+			&r.Name,
+			&r.Type,
+			&r.Target,
+			&r.Sent,
+			&r.Received,
+			&r.LossPercent,
+			&r.MinRTT,
+			&r.AvgRTT,
+			&r.MaxRTT,
+			&r.Jitter,
+			&r.Error,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("解析探测结果失败: %v", err)
+		}
+		results = append(results, r)
+	}
+
+	return results, nil
+}
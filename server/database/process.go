@@ -0,0 +1,98 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// ProcessTraffic 客户端单个进程在一个上报周期内的流量（字节），进程号0为无法归属到进程的流量
+type ProcessTraffic struct {
+	PID           int    `json:"pid"`
+	Comm          string `json:"comm,omitempty"`
+	Cmdline       string `json:"cmdline,omitempty"`
+	User          string `json:"user,omitempty"`
+	UploadBytes   uint64 `json:"upload_bytes"`
+	DownloadBytes uint64 `json:"download_bytes"`
+	InternalBytes uint64 `json:"internal_bytes"`
+	// 进程所在的cgroup、容器和网络命名空间（inode），旧版本客户端不上报
+	Cgroup           string `json:"cgroup,omitempty"`
+	ContainerID      string `json:"container_id,omitempty"`
+	ContainerName    string `json:"container_name,omitempty"`
+	ContainerRuntime string `json:"container_runtime,omitempty"`
+	NetNS            uint64 `json:"netns,omitempty"`
+}
+
+// initProcessTrafficTable 创建进程流量表
+func initProcessTrafficTable() error {
+	createProcessTrafficTableSQL := `
+	CREATE TABLE IF NOT EXISTS process_traffic (
+		id SERIAL PRIMARY KEY,
+		client_id VARCHAR(64) NOT NULL,
+		timestamp TIMESTAMP NOT NULL,
+		pid INTEGER NOT NULL,
+		comm VARCHAR(64) NOT NULL,
+		cmdline TEXT NOT NULL,
+		username VARCHAR(64) NOT NULL,
+		upload_bytes BIGINT NOT NULL,
+		download_bytes BIGINT NOT NULL,
+		internal_bytes BIGINT NOT NULL DEFAULT 0,
+		cgroup TEXT NOT NULL DEFAULT '',
+		container_id VARCHAR(64) NOT NULL DEFAULT '',
+		container_name VARCHAR(255) NOT NULL DEFAULT '',
+		container_runtime VARCHAR(16) NOT NULL DEFAULT '',
+		netns BIGINT NOT NULL DEFAULT 0,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (client_id) REFERENCES clients(client_id) ON DELETE CASCADE
+	);
+
+	-- 旧版本创建的表补充内网流量、cgroup、容器和网络命名空间字段
+	ALTER TABLE process_traffic ADD COLUMN IF NOT EXISTS internal_bytes BIGINT NOT NULL DEFAULT 0;
+	ALTER TABLE process_traffic ADD COLUMN IF NOT EXISTS cgroup TEXT NOT NULL DEFAULT '';
+	ALTER TABLE process_traffic ADD COLUMN IF NOT EXISTS container_id VARCHAR(64) NOT NULL DEFAULT '';
+	ALTER TABLE process_traffic ADD COLUMN IF NOT EXISTS container_name VARCHAR(255) NOT NULL DEFAULT '';
+	ALTER TABLE process_traffic ADD COLUMN IF NOT EXISTS container_runtime VARCHAR(16) NOT NULL DEFAULT '';
+	ALTER TABLE process_traffic ADD COLUMN IF NOT EXISTS netns BIGINT NOT NULL DEFAULT 0;
+
+	-- 创建客户端ID和时间的复合索引
+	CREATE INDEX IF NOT EXISTS idx_process_traffic_client_timestamp
+	ON process_traffic(client_id, timestamp DESC);
+	`
+
+	if _, err := Pool.Exec(ctx, createProcessTrafficTableSQL); err != nil {
+		return fmt.Errorf("创建进程流量表失败: %v", err)
+	}
+	return nil
+}
+
+// SaveProcessTraffic 保存流量最大的进程
+func SaveProcessTraffic(clientID string, timestamp time.Time, processes []ProcessTraffic) error {
+	sql := `
+		INSERT INTO process_traffic (
+			client_id, timestamp, pid, comm, cmdline, username, upload_bytes, download_bytes,
+			internal_bytes, cgroup, container_id, container_name, container_runtime, netns
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+	`
+
+	for _, process := range processes {
+		_, err := Pool.Exec(ctx, sql,
+			clientID,
+			timestamp,
+			process.PID,
+			process.Comm,
+			process.Cmdline,
+			process.User,
+			int64(process.UploadBytes),
+			int64(process.DownloadBytes),
+			int64(process.InternalBytes),
+			process.Cgroup,
+			process.ContainerID,
+			process.ContainerName,
+			process.ContainerRuntime,
+			int64(process.NetNS))
+		if err != nil {
+			return fmt.Errorf("保存进程流量失败: %v", err)
+		}
+	}
+
+	return nil
+}
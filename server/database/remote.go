@@ -0,0 +1,284 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// RemoteTraffic 客户端单个远端网段在一个上报周期内的流量（字节）
+type RemoteTraffic struct {
+	Prefix        string `json:"prefix"`
+	ASN           uint32 `json:"asn,omitempty"`
+	Organization  string `json:"organization,omitempty"`
+	Country       string `json:"country,omitempty"`
+	Label         string `json:"label,omitempty"`
+	UploadBytes   uint64 `json:"upload_bytes"`
+	DownloadBytes uint64 `json:"download_bytes"`
+}
+
+// RemotePeer 客户端单个远端地址在一个上报周期内的流量（字节）
+type RemotePeer struct {
+	Address string `json:"address"`
+	// 从DNS应答或PTR查询得到的名称，来源为dns或ptr
+	Name          string `json:"name,omitempty"`
+	NameSource    string `json:"name_source,omitempty"`
+	ASN           uint32 `json:"asn,omitempty"`
+	Organization  string `json:"organization,omitempty"`
+	Country       string `json:"country,omitempty"`
+	Label         string `json:"label,omitempty"`
+	UploadBytes   uint64 `json:"upload_bytes"`
+	DownloadBytes uint64 `json:"download_bytes"`
+}
+
+// RemoteGroupTraffic 客户端按ASN、国家或自定义分类汇总的远端流量（字节）
+type RemoteGroupTraffic struct {
+	// 汇总方式：asn、country、label
+	Kind string `json:"kind"`
+	// ASN号、国家代码或分类名称，地址数据库中没有的远端地址为空（ASN为0）
+	Key           string `json:"key"`
+	Name          string `json:"name,omitempty"`
+	Prefixes      int    `json:"prefixes"`
+	UploadBytes   uint64 `json:"upload_bytes"`
+	DownloadBytes uint64 `json:"download_bytes"`
+}
+
+// RemoteStats 客户端一个上报周期内流量最大的远端网段、远端地址及汇总结果
+type RemoteStats struct {
+	Prefixes []RemoteTraffic      `json:"prefixes"`
+	Peers    []RemotePeer         `json:"peers,omitempty"`
+	Groups   []RemoteGroupTraffic `json:"groups,omitempty"`
+}
+
+// initRemoteTrafficTables 创建远端网段流量表和汇总表
+func initRemoteTrafficTables() error {
+	createRemoteTrafficTablesSQL := `
+	CREATE TABLE IF NOT EXISTS remote_traffic (
+		id SERIAL PRIMARY KEY,
+		client_id VARCHAR(64) NOT NULL,
+		timestamp TIMESTAMP NOT NULL,
+		prefix VARCHAR(64) NOT NULL,
+		asn BIGINT NOT NULL,
+		organization VARCHAR(255) NOT NULL,
+		country VARCHAR(8) NOT NULL,
+		label VARCHAR(64) NOT NULL,
+		upload_bytes BIGINT NOT NULL,
+		download_bytes BIGINT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (client_id) REFERENCES clients(client_id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS remote_peer_traffic (
+		id SERIAL PRIMARY KEY,
+		client_id VARCHAR(64) NOT NULL,
+		timestamp TIMESTAMP NOT NULL,
+		address VARCHAR(64) NOT NULL,
+		name VARCHAR(255) NOT NULL,
+		name_source VARCHAR(8) NOT NULL,
+		asn BIGINT NOT NULL,
+		organization VARCHAR(255) NOT NULL,
+		country VARCHAR(8) NOT NULL,
+		label VARCHAR(64) NOT NULL,
+		upload_bytes BIGINT NOT NULL,
+		download_bytes BIGINT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (client_id) REFERENCES clients(client_id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS remote_group_traffic (
+		id SERIAL PRIMARY KEY,
+		client_id VARCHAR(64) NOT NULL,
+		timestamp TIMESTAMP NOT NULL,
+		kind VARCHAR(16) NOT NULL,
+		key VARCHAR(64) NOT NULL,
+		name VARCHAR(255) NOT NULL,
+		prefixes INTEGER NOT NULL,
+		upload_bytes BIGINT NOT NULL,
+		download_bytes BIGINT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (client_id) REFERENCES clients(client_id) ON DELETE CASCADE
+	);
+
+	-- 创建客户端ID和时间的复合索引
+	CREATE INDEX IF NOT EXISTS idx_remote_traffic_client_timestamp
+	ON remote_traffic(client_id, timestamp DESC);
+
+	CREATE INDEX IF NOT EXISTS idx_remote_peer_traffic_client_timestamp
+	ON remote_peer_traffic(client_id, timestamp DESC);
+
+	CREATE INDEX IF NOT EXISTS idx_remote_group_traffic_client_kind_timestamp
+	ON remote_group_traffic(client_id, kind, timestamp DESC);
+	`
+
+	if _, err := Pool.Exec(ctx, createRemoteTrafficTablesSQL); err != nil {
+		return fmt.Errorf("创建远端流量表失败: %v", err)
+	}
+	return nil
+}
+
+// SaveRemoteTraffic 保存流量最大的远端网段、远端地址及按ASN、国家、分类汇总的流量
+func SaveRemoteTraffic(clientID string, timestamp time.Time, stats *RemoteStats) error {
+	prefixSQL := `
+		INSERT INTO remote_traffic (
+			client_id, timestamp, prefix, asn, organization, country, label, upload_bytes, download_bytes
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+	for _, remote := range stats.Prefixes {
+		_, err := Pool.Exec(ctx, prefixSQL,
+			clientID,
+			timestamp,
+			remote.Prefix,
+			int64(remote.ASN),
+			remote.Organization,
+			remote.Country,
+			remote.Label,
+			int64(remote.UploadBytes),
+			int64(remote.DownloadBytes))
+		if err != nil {
+			return fmt.Errorf("保存远端网段流量失败: %v", err)
+		}
+	}
+
+	peerSQL := `
+		INSERT INTO remote_peer_traffic (
+			client_id, timestamp, address, name, name_source, asn, organization, country, label,
+			upload_bytes, download_bytes
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`
+	for _, peer := range stats.Peers {
+		_, err := Pool.Exec(ctx, peerSQL,
+			clientID,
+			timestamp,
+			peer.Address,
+			peer.Name,
+			peer.NameSource,
+			int64(peer.ASN),
+			peer.Organization,
+			peer.Country,
+			peer.Label,
+			int64(peer.UploadBytes),
+			int64(peer.DownloadBytes))
+		if err != nil {
+			return fmt.Errorf("保存远端地址流量失败: %v", err)
+		}
+	}
+
+	groupSQL := `
+		INSERT INTO remote_group_traffic (
+			client_id, timestamp, kind, key, name, prefixes, upload_bytes, download_bytes
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	for _, group := range stats.Groups {
+		_, err := Pool.Exec(ctx, groupSQL,
+			clientID,
+			timestamp,
+			group.Kind,
+			group.Key,
+			group.Name,
+			group.Prefixes,
+			int64(group.UploadBytes),
+			int64(group.DownloadBytes))
+		if err != nil {
+			return fmt.Errorf("保存远端汇总流量失败: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// GetRemoteTraffic 查询时间范围内流量最大的远端网段，各上报周期的流量按网段累加
+func GetRemoteTraffic(clientID string, startTime, endTime time.Time, limit int) ([]RemoteTraffic, error) {
+	sql := `
+		SELECT prefix, MAX(asn), MAX(organization), MAX(country), MAX(label),
+			   SUM(upload_bytes)::BIGINT, SUM(download_bytes)::BIGINT
+		FROM remote_traffic
+		WHERE client_id = $1 AND timestamp BETWEEN $2 AND $3
+		GROUP BY prefix
+		ORDER BY SUM(upload_bytes + download_bytes) DESC
+		LIMIT $4
+	`
+
+	rows, err := Pool.Query(ctx, sql, clientID, startTime, endTime, limit)
+	if err != nil {
+		return nil, fmt.Errorf("查询远端网段流量失败: %v", err)
+	}
+	defer rows.Close()
+
+	var results []RemoteTraffic
+	for rows.Next() {
+		var r RemoteTraffic
+		var asn, upload, download int64
+		if err := rows.Scan(&r.Prefix, &asn, &r.Organization, &r.Country, &r.Label, &upload, &download); err != nil {
+			return nil, fmt.Errorf("解析远端网段流量失败: %v", err)
+		}
+		r.ASN, r.UploadBytes, r.DownloadBytes = uint32(asn), uint64(upload), uint64(download)
+		results = append(results, r)
+	}
+
+	return results, nil
+}
+
+// GetRemotePeerTraffic 查询时间范围内流量最大的远端地址，各上报周期的流量按地址累加，名称取最近一次上报的名称
+func GetRemotePeerTraffic(clientID string, startTime, endTime time.Time, limit int) ([]RemotePeer, error) {
+	sql := `
+		SELECT address,
+			   (ARRAY_AGG(name ORDER BY timestamp DESC))[1], (ARRAY_AGG(name_source ORDER BY timestamp DESC))[1],
+			   MAX(asn), MAX(organization), MAX(country), MAX(label),
+			   SUM(upload_bytes)::BIGINT, SUM(download_bytes)::BIGINT
+		FROM remote_peer_traffic
+		WHERE client_id = $1 AND timestamp BETWEEN $2 AND $3
+		GROUP BY address
+		ORDER BY SUM(upload_bytes + download_bytes) DESC
+		LIMIT $4
+	`
+
+	rows, err := Pool.Query(ctx, sql, clientID, startTime, endTime, limit)
+	if err != nil {
+		return nil, fmt.Errorf("查询远端地址流量失败: %v", err)
+	}
+	defer rows.Close()
+
+	var results []RemotePeer
+	for rows.Next() {
+		var r RemotePeer
+		var asn, upload, download int64
+		if err := rows.Scan(&r.Address, &r.Name, &r.NameSource, &asn, &r.Organization, &r.Country, &r.Label,
+			&upload, &download); err != nil {
+			return nil, fmt.Errorf("解析远端地址流量失败: %v", err)
+		}
+		r.ASN, r.UploadBytes, r.DownloadBytes = uint32(asn), uint64(upload), uint64(download)
+		results = append(results, r)
+	}
+
+	return results, nil
+}
+
+// GetRemoteGroupTraffic 查询时间范围内按ASN、国家或分类汇总的远端流量，按流量从大到小排序
+// 网段数量为各上报周期之和，同一网段在多个周期出现时重复计数
+func GetRemoteGroupTraffic(clientID, kind string, startTime, endTime time.Time) ([]RemoteGroupTraffic, error) {
+	sql := `
+		SELECT key, MAX(name), SUM(prefixes)::BIGINT, SUM(upload_bytes)::BIGINT, SUM(download_bytes)::BIGINT
+		FROM remote_group_traffic
+		WHERE client_id = $1 AND kind = $2 AND timestamp BETWEEN $3 AND $4
+		GROUP BY key
+		ORDER BY SUM(upload_bytes + download_bytes) DESC
+	`
+
+	rows, err := Pool.Query(ctx, sql, clientID, kind, startTime, endTime)
+	if err != nil {
+		return nil, fmt.Errorf("查询远端汇总流量失败: %v", err)
+	}
+	defer rows.Close()
+
+	var results []RemoteGroupTraffic
+	for rows.Next() {
+		r := RemoteGroupTraffic{Kind: kind}
+		var prefixes, upload, download int64
+		if err := rows.Scan(&r.Key, &r.Name, &prefixes, &upload, &download); err != nil {
+			return nil, fmt.Errorf("解析远端汇总流量失败: %v", err)
+		}
+		r.Prefixes, r.UploadBytes, r.DownloadBytes = int(prefixes), uint64(upload), uint64(download)
+		results = append(results, r)
+	}
+
+	return results, nil
+}
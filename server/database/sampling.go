@@ -0,0 +1,76 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// SamplingStat 客户端的数据包采样方式及带宽估算的误差范围
+// 误差范围为95%置信区间的半宽（字节/秒）
+type SamplingStat struct {
+	Mode               string  `json:"mode"`
+	Rate               int     `json:"rate"`
+	UploadSpeedError   float64 `json:"upload_speed_error"`
+	DownloadSpeedError float64 `json:"download_speed_error"`
+	InternalSpeedError float64 `json:"internal_speed_error"`
+}
+
+// initSamplingTable 创建采样精度表
+func initSamplingTable() error {
+	createSamplingTableSQL := `
+	CREATE TABLE IF NOT EXISTS sampling_stats (
+		id SERIAL PRIMARY KEY,
+		client_id VARCHAR(64) NOT NULL,
+		timestamp TIMESTAMP NOT NULL,
+		interface VARCHAR(64) NOT NULL,
+		mode VARCHAR(16) NOT NULL,
+		rate INTEGER NOT NULL,
+		upload_speed_error DOUBLE PRECISION NOT NULL,
+		download_speed_error DOUBLE PRECISION NOT NULL,
+		internal_speed_error DOUBLE PRECISION NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (client_id) REFERENCES clients(client_id) ON DELETE CASCADE
+	);
+
+	-- 创建客户端ID、网卡和时间的复合索引
+	CREATE INDEX IF NOT EXISTS idx_sampling_stats_client_interface_timestamp
+	ON sampling_stats(client_id, interface, timestamp DESC);
+	`
+
+	if _, err := Pool.Exec(ctx, createSamplingTableSQL); err != nil {
+		return fmt.Errorf("创建采样精度表失败: %v", err)
+	}
+	return nil
+}
+
+// SaveSampling 保存采样方式和误差范围，主机汇总的网卡名称为"total"
+func SaveSampling(clientID string, timestamp time.Time, iface string, stat *SamplingStat) error {
+	sql := `
+		INSERT INTO sampling_stats (
+			client_id, timestamp, interface, mode, rate,
+			upload_speed_error, download_speed_error, internal_speed_error
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+
+	_, err := Pool.Exec(ctx, sql,
+		clientID,
+		timestamp,
+		iface,
+		stat.Mode,
+		stat.Rate,
+		stat.UploadSpeedError,
+		stat.DownloadSpeedError,
+		stat.InternalSpeedError)
+	if err != nil {
+		return fmt.Errorf("保存采样精度失败: %v", err)
+	}
+	return nil
+}
+
+// sampleRate 统计使用的采样率，客户端未采样时不上报采样率，按1保存
+func sampleRate(rate int) int {
+	if rate <= 1 {
+		return 1
+	}
+	return rate
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// SegmentStat 按网关MAC区分的WAN/LAN带宽
+type SegmentStat struct {
+	WANUploadSpeed   float64 `json:"wan_upload_speed"`
+	WANDownloadSpeed float64 `json:"wan_download_speed"`
+	LANUploadSpeed   float64 `json:"lan_upload_speed"`
+	LANDownloadSpeed float64 `json:"lan_download_speed"`
+}
+
+// initSegmentBandwidthTable 创建WAN/LAN带宽统计表
+func initSegmentBandwidthTable() error {
+	createSegmentBandwidthTableSQL := `
+	CREATE TABLE IF NOT EXISTS segment_bandwidth_stats (
+		id SERIAL PRIMARY KEY,
+		client_id VARCHAR(64) NOT NULL,
+		timestamp TIMESTAMP NOT NULL,
+		interface VARCHAR(64) NOT NULL,
+		wan_upload_speed DOUBLE PRECISION NOT NULL,
+		wan_download_speed DOUBLE PRECISION NOT NULL,
+		lan_upload_speed DOUBLE PRECISION NOT NULL,
+		lan_download_speed DOUBLE PRECISION NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (client_id) REFERENCES clients(client_id) ON DELETE CASCADE
+	);
+
+	-- 创建客户端ID、网卡和时间的复合索引
+	CREATE INDEX IF NOT EXISTS idx_segment_bandwidth_stats_client_interface_timestamp
+	ON segment_bandwidth_stats(client_id, interface, timestamp DESC);
+	`
+
+	if _, err := Pool.Exec(ctx, createSegmentBandwidthTableSQL); err != nil {
+		return fmt.Errorf("创建WAN/LAN带宽统计表失败: %v", err)
+	}
+	return nil
+}
+
+// SaveSegmentBandwidth 保存WAN/LAN带宽统计，主机汇总的网卡名称为"total"
+func SaveSegmentBandwidth(clientID string, timestamp time.Time, iface string, stat *SegmentStat) error {
+	sql := `
+		INSERT INTO segment_bandwidth_stats (
+			client_id, timestamp, interface, wan_upload_speed, wan_download_speed,
+			lan_upload_speed, lan_download_speed
+		) VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	_, err := Pool.Exec(ctx, sql,
+		clientID,
+		timestamp,
+		iface,
+		stat.WANUploadSpeed,
+		stat.WANDownloadSpeed,
+		stat.LANUploadSpeed,
+		stat.LANDownloadSpeed)
+	if err != nil {
+		return fmt.Errorf("保存WAN/LAN带宽统计失败: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// TCPDirectionStat 单方向TCP健康指标
+type TCPDirectionStat struct {
+	Retransmissions   uint64 `json:"retransmissions"`
+	ZeroWindows       uint64 `json:"zero_windows"`
+	Resets            uint64 `json:"resets"`
+	Syns              uint64 `json:"syns"`
+	SynAcks           uint64 `json:"syn_acks"`
+	FailedConnections uint64 `json:"failed_connections"`
+}
+
+// TCPHealthStat TCP健康指标（按上下行区分）
+type TCPHealthStat struct {
+	Upload   TCPDirectionStat `json:"upload"`
+	Download TCPDirectionStat `json:"download"`
+	// 客户端采样时的采样率，计数只来自被采样的数据包、未放大，不统计连接失败
+	SampleRate int `json:"sample_rate,omitempty"`
+}
+
+// initTCPHealthTable 创建TCP健康指标表
+func initTCPHealthTable() error {
+	createTCPHealthTableSQL := `
+	CREATE TABLE IF NOT EXISTS tcp_health_stats (
+		id SERIAL PRIMARY KEY,
+		client_id VARCHAR(64) NOT NULL,
+		timestamp TIMESTAMP NOT NULL,
+		direction VARCHAR(16) NOT NULL,
+		retransmissions BIGINT NOT NULL,
+		zero_windows BIGINT NOT NULL,
+		resets BIGINT NOT NULL,
+		syns BIGINT NOT NULL,
+		syn_acks BIGINT NOT NULL,
+		failed_connections BIGINT NOT NULL,
+		sample_rate INTEGER NOT NULL DEFAULT 1,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (client_id) REFERENCES clients(client_id) ON DELETE CASCADE
+	);
+
+	-- 旧版本创建的表补充采样率字段
+	ALTER TABLE tcp_health_stats ADD COLUMN IF NOT EXISTS sample_rate INTEGER NOT NULL DEFAULT 1;
+
+	-- 创建时间和客户端ID的复合索引
+	CREATE INDEX IF NOT EXISTS idx_tcp_health_stats_client_timestamp
+	ON tcp_health_stats(client_id, timestamp DESC);
+	`
+
+	if _, err := Pool.Exec(ctx, createTCPHealthTableSQL); err != nil {
+		return fmt.Errorf("创建TCP健康指标表失败: %v", err)
+	}
+	return nil
+}
+
+// SaveTCPHealth 保存TCP健康指标，上下行各保存一行
+func SaveTCPHealth(clientID string, timestamp time.Time, stat *TCPHealthStat) error {
+	sql := `
+		INSERT INTO tcp_health_stats (
+			client_id, timestamp, direction, retransmissions, zero_windows,
+			resets, syns, syn_acks, failed_connections, sample_rate
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+
+	directions := []struct {
+		name string
+		stat TCPDirectionStat
+	}{
+		{"upload", stat.Upload},
+		{"download", stat.Download},
+	}
+	for _, d := range directions {
+		_, err := Pool.Exec(ctx, sql,
+			clientID,
+			timestamp,
+			d.name,
+			d.stat.Retransmissions,
+			d.stat.ZeroWindows,
+			d.stat.Resets,
+			d.stat.Syns,
+			d.stat.SynAcks,
+			d.stat.FailedConnections,
+			sampleRate(stat.SampleRate))
+		if err != nil {
+			return fmt.Errorf("保存TCP健康指标失败: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// RTTSummary RTT样本统计（单位：毫秒）
+type RTTSummary struct {
+	Count int     `json:"count"`
+	Min   float64 `json:"min_ms"`
+	Avg   float64 `json:"avg_ms"`
+	P50   float64 `json:"p50_ms"`
+	P90   float64 `json:"p90_ms"`
+	P99   float64 `json:"p99_ms"`
+	Max   float64 `json:"max_ms"`
+}
+
+// SubnetRTT 远端子网的RTT统计
+type SubnetRTT struct {
+	Subnet string `json:"subnet"`
+	RTTSummary
+}
+
+// TCPRTTStat 基于TCP握手的被动RTT统计
+type TCPRTTStat struct {
+	Total   RTTSummary  `json:"total"`
+	Subnets []SubnetRTT `json:"subnets,omitempty"`
+}
+
+// 汇总行使用的子网标识
+const totalSubnet = "all"
+
+// initTCPRTTTable 创建RTT统计表
+func initTCPRTTTable() error {
+	createTCPRTTTableSQL := `
+	CREATE TABLE IF NOT EXISTS tcp_rtt_stats (
+		id SERIAL PRIMARY KEY,
+		client_id VARCHAR(64) NOT NULL,
+		timestamp TIMESTAMP NOT NULL,
+		subnet VARCHAR(64) NOT NULL,
+		sample_count INTEGER NOT NULL,
+		min_ms DOUBLE PRECISION NOT NULL,
+		avg_ms DOUBLE PRECISION NOT NULL,
+		p50_ms DOUBLE PRECISION NOT NULL,
+		p90_ms DOUBLE PRECISION NOT NULL,
+		p99_ms DOUBLE PRECISION NOT NULL,
+		max_ms DOUBLE PRECISION NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (client_id) REFERENCES clients(client_id) ON DELETE CASCADE
+	);
+
+	-- 创建时间和客户端ID的复合索引
+	CREATE INDEX IF NOT EXISTS idx_tcp_rtt_stats_client_timestamp
+	ON tcp_rtt_stats(client_id, timestamp DESC);
+	`
+
+	if _, err := Pool.Exec(ctx, createTCPRTTTableSQL); err != nil {
+		return fmt.Errorf("创建RTT统计表失败: %v", err)
+	}
+	return nil
+}
+
+// SaveTCPRTT 保存RTT统计，汇总行的子网为"all"
+func SaveTCPRTT(clientID string, timestamp time.Time, stat *TCPRTTStat) error {
+	rows := []SubnetRTT{{Subnet: totalSubnet, RTTSummary: stat.Total}}
+	rows = append(rows, stat.Subnets...)
+
+	sql := `
+		INSERT INTO tcp_rtt_stats (
+			client_id, timestamp, subnet, sample_count,
+			min_ms, avg_ms, p50_ms, p90_ms, p99_ms, max_ms
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+
+	for _, row := range rows {
+		_, err := Pool.Exec(ctx, sql,
+			clientID,
+			timestamp,
+			row.Subnet,
+			row.Count,
+			row.Min,
+			row.Avg,
+			row.P50,
+			row.P90,
+			row.P99,
+			row.Max)
+		if err != nil {
+			return fmt.Errorf("保存RTT统计失败: %v", err)
+		}
+	}
+
+	return nil
+}
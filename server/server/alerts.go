@@ -0,0 +1,103 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+
+	"network-monitor-server/config"
+	"network-monitor-server/database"
+)
+
+// 告警类型
+const (
+	alertInterfaceErrors     = "interface_errors"
+	alertInterfaceDrops      = "interface_drops"
+	alertInterfaceCollisions = "interface_collisions"
+	alertLinkFlap            = "link_flap"
+	alertLinkDown            = "link_down"
+	alertHalfDuplex          = "half_duplex"
+)
+
+// alertTracker 记录各客户端网卡正在触发的告警，只在触发和解除时产生记录，避免每个上报周期重复告警
+type alertTracker struct {
+	mutex  sync.Mutex
+	active map[string]bool
+}
+
+// update 更新告警状态，状态变化时返回需要记录的告警
+func (t *alertTracker) update(clientID string, alert database.Alert, firing bool) (database.Alert, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.active == nil {
+		t.active = make(map[string]bool)
+	}
+	key := clientID + "/" + alert.Interface + "/" + alert.Kind
+	if t.active[key] == firing {
+		return alert, false
+	}
+	if firing {
+		t.active[key] = true
+	} else {
+		delete(t.active, key)
+		alert.Resolved = true
+	}
+	return alert, true
+}
+
+// checkInterfaceHealth 按配置的阈值检查各网卡的错误、丢弃、冲突速率和链路状态
+func (t *alertTracker) checkInterfaceHealth(clientID string, stats []database.InterfaceHealthStat) []database.Alert {
+	thresholds := config.Config.Alerts.Interface
+	var alerts []database.Alert
+	check := func(alert database.Alert, firing bool) {
+		if alert, changed := t.update(clientID, alert, firing); changed {
+			alerts = append(alerts, alert)
+		}
+	}
+	checkRate := func(stat *database.InterfaceHealthStat, kind, name string, count uint64, threshold float64) {
+		if threshold <= 0 || stat.Interval <= 0 {
+			return
+		}
+		rate := float64(count) / stat.Interval
+		check(database.Alert{
+			Interface: stat.Interface,
+			Kind:      kind,
+			Value:     rate,
+			Threshold: threshold,
+			Message:   fmt.Sprintf("网卡 %s %s %.2f/秒（阈值 %.2f/秒）", stat.Interface, name, rate, threshold),
+		}, rate > threshold)
+	}
+
+	for i := range stats {
+		stat := &stats[i]
+		checkRate(stat, alertInterfaceErrors, "收发错误", stat.Errors(), thresholds.ErrorRate)
+		checkRate(stat, alertInterfaceDrops, "收发丢弃", stat.Dropped(), thresholds.DropRate)
+		checkRate(stat, alertInterfaceCollisions, "冲突", stat.Collisions, thresholds.CollisionRate)
+
+		if thresholds.CarrierChanges > 0 {
+			check(database.Alert{
+				Interface: stat.Interface,
+				Kind:      alertLinkFlap,
+				Value:     float64(stat.CarrierChanges),
+				Threshold: float64(thresholds.CarrierChanges),
+				Message:   fmt.Sprintf("网卡 %s 链路抖动，载波变化 %d 次", stat.Interface, stat.CarrierChanges),
+			}, stat.CarrierChanges >= uint64(thresholds.CarrierChanges))
+		}
+		// 客户端无法获取链路状态时不检查
+		if stat.OperState != "" {
+			check(database.Alert{
+				Interface: stat.Interface,
+				Kind:      alertLinkDown,
+				Message:   fmt.Sprintf("网卡 %s 链路状态为 %s", stat.Interface, stat.OperState),
+			}, stat.OperState == "down" || stat.OperState == "lowerlayerdown")
+		}
+		if stat.Duplex != "" {
+			check(database.Alert{
+				Interface: stat.Interface,
+				Kind:      alertHalfDuplex,
+				Message:   fmt.Sprintf("网卡 %s 工作在半双工模式（%dMbps），可能是双工协商失败或线缆问题", stat.Interface, stat.Speed),
+			}, stat.Duplex == "half")
+		}
+	}
+	return alerts
+}
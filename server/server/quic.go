@@ -15,6 +15,7 @@ import (
 	"sync"
 	"time"
 
+	"network-monitor-server/config"
 	"network-monitor-server/database"
 
 	"github.com/quic-go/quic-go"
@@ -29,6 +30,48 @@ type BandwidthData struct {
 	DownloadSpeed         float64   `json:"download_speed"`
 	AvgUploadPacketSize   float64   `json:"avg_upload_packet_size"`
 	AvgDownloadPacketSize float64   `json:"avg_download_packet_size"`
+	// 内网（东西向）流量速率（旧版本客户端不上报）
+	InternalSpeed float64 `json:"internal_speed"`
+	// 按网关MAC区分的主机WAN/LAN带宽
+	Segments *database.SegmentStat `json:"segments,omitempty"`
+	// 各网卡的带宽统计，上面的速率字段为主机汇总（旧版本客户端不上报）
+	Interfaces []database.InterfaceBandwidth `json:"interfaces,omitempty"`
+	// TCP健康指标（旧版本客户端不上报）
+	TCPHealth *database.TCPHealthStat `json:"tcp_health,omitempty"`
+	// 基于TCP握手的被动RTT统计
+	TCPRTT *database.TCPRTTStat `json:"tcp_rtt,omitempty"`
+	// 主动探测结果（时延、抖动、丢包）
+	Probes []database.ProbeResult `json:"probes,omitempty"`
+	// 被动DNS统计
+	DNS *database.DNSStat `json:"dns,omitempty"`
+	// DNS解析探测结果
+	DNSProbes []database.DNSProbeResult `json:"dns_probes,omitempty"`
+	// HTTP拨测结果
+	HTTPChecks []database.HTTPCheckResult `json:"http_checks,omitempty"`
+	// 抓包中断事件
+	CaptureGaps []database.CaptureGap `json:"capture_gaps,omitempty"`
+	// 各网卡的抓包统计（旧版本客户端不上报）
+	CaptureStats []database.CaptureStat `json:"capture_stats,omitempty"`
+	// 各网卡按VLAN和隧道区分的流量
+	Encapsulation []database.EncapsulationStat `json:"encapsulation,omitempty"`
+	// 采样方式及主机汇总速率的误差范围（客户端不采样时为空），速率字段为按采样率放大的估算值
+	Sampling *database.SamplingStat `json:"sampling,omitempty"`
+	// 各网卡的错误、丢弃、冲突计数及链路状态（旧版本客户端不上报）
+	InterfaceHealth []database.InterfaceHealthStat `json:"interface_health,omitempty"`
+	// 流量最大的进程，进程号0为无法归属的流量（客户端开启按进程统计时上报）
+	Processes []database.ProcessTraffic `json:"processes,omitempty"`
+	// 按容器（不在容器内时按cgroup）和网络命名空间汇总的进程流量
+	Containers []database.ContainerTraffic `json:"containers,omitempty"`
+	// 流量最大的远端网段及按ASN、国家、自定义分类汇总的流量（客户端开启按远端统计时上报）
+	Remotes *database.RemoteStats `json:"remotes,omitempty"`
+	// 流量最大的服务器名称（TLS SNI、HTTP Host），名称为空的为无法识别的流量（客户端开启时上报）
+	Hostnames []database.HostnameTraffic `json:"hostnames,omitempty"`
+}
+
+// ServerMessage 服务器在上报数据流上返回给客户端的消息
+type ServerMessage struct {
+	// 客户端需要执行的HTTP拨测任务
+	HTTPChecks []config.HTTPCheck `json:"http_checks,omitempty"`
 }
 
 type QuicServer struct {
@@ -39,6 +82,7 @@ type QuicServer struct {
 	cancel      context.CancelFunc
 	connections sync.WaitGroup
 	clients     sync.Map // 存储活跃的客户端连接
+	alerts      alertTracker
 }
 
 type ClientConnection struct {
@@ -200,7 +244,8 @@ func (s *QuicServer) handleStream(stream quic.Stream, conn quic.Connection, clie
 	}
 
 	// 验证和更新客户端信息
-	if *clientID == "" {
+	newClient := *clientID == ""
+	if newClient {
 		*clientID = bandwidthData.ClientID
 		*alias = bandwidthData.Alias
 
@@ -226,12 +271,34 @@ func (s *QuicServer) handleStream(stream quic.Stream, conn quic.Connection, clie
 		client.(*ClientConnection).LastSeen = time.Now()
 	}
 
+	// 每次上报都下发完整的HTTP拨测任务列表（为空时客户端停止已有拨测），发送后关闭发送方向，客户端不需要等待数据入库
+	message := ServerMessage{HTTPChecks: config.Config.HTTPChecks}
+	if err := json.NewEncoder(stream).Encode(message); err != nil {
+		log.Printf("Failed to send HTTP checks to client %s: %v", *clientID, err)
+	}
+	stream.Close()
+
 	// 验证数据有效性
 	if bandwidthData.Timestamp.IsZero() {
 		log.Printf("Invalid bandwidth data: timestamp is zero")
 		return
 	}
 
+	// 根据抓包统计标记有丢包的样本
+	lossy := false
+	lossyInterfaces := make(map[string]bool)
+	for _, stat := range bandwidthData.CaptureStats {
+		if stat.Lossy() {
+			lossy = true
+			lossyInterfaces[stat.Interface] = true
+			log.Printf("客户端 %s 网卡 %s 抓包丢包: 内核丢弃 %d，网卡丢弃 %d，丢包率 %.2f%%",
+				*clientID, stat.Interface, stat.Dropped, stat.IfDropped, stat.LossRatio*100)
+		}
+	}
+	for i := range bandwidthData.Interfaces {
+		bandwidthData.Interfaces[i].Lossy = lossyInterfaces[bandwidthData.Interfaces[i].Interface]
+	}
+
 	// 保存带宽数据
 	err = database.SaveBandwidthData(
 		*clientID,
@@ -239,12 +306,171 @@ func (s *QuicServer) handleStream(stream quic.Stream, conn quic.Connection, clie
 		bandwidthData.UploadSpeed,
 		bandwidthData.DownloadSpeed,
 		bandwidthData.AvgUploadPacketSize,
-		bandwidthData.AvgDownloadPacketSize)
+		bandwidthData.AvgDownloadPacketSize,
+		bandwidthData.InternalSpeed,
+		lossy)
 	if err != nil {
 		log.Printf("Failed to save bandwidth data: %v", err)
 		return
 	}
 
+	// 保存各网卡的带宽统计
+	if len(bandwidthData.Interfaces) > 0 {
+		if err := database.SaveInterfaceBandwidth(*clientID, bandwidthData.Timestamp, bandwidthData.Interfaces); err != nil {
+			log.Printf("Failed to save interface bandwidth data: %v", err)
+		}
+	}
+
+	// 保存WAN/LAN带宽统计
+	if bandwidthData.Segments != nil {
+		if err := database.SaveSegmentBandwidth(*clientID, bandwidthData.Timestamp, "total", bandwidthData.Segments); err != nil {
+			log.Printf("Failed to save segment bandwidth data: %v", err)
+		}
+	}
+	for _, iface := range bandwidthData.Interfaces {
+		if iface.Segments == nil {
+			continue
+		}
+		if err := database.SaveSegmentBandwidth(*clientID, bandwidthData.Timestamp, iface.Interface, iface.Segments); err != nil {
+			log.Printf("Failed to save segment bandwidth data: %v", err)
+		}
+	}
+
+	// 保存采样方式和误差范围
+	if bandwidthData.Sampling != nil {
+		if err := database.SaveSampling(*clientID, bandwidthData.Timestamp, "total", bandwidthData.Sampling); err != nil {
+			log.Printf("Failed to save sampling stats: %v", err)
+		}
+	}
+	for _, iface := range bandwidthData.Interfaces {
+		if iface.Sampling == nil {
+			continue
+		}
+		if err := database.SaveSampling(*clientID, bandwidthData.Timestamp, iface.Interface, iface.Sampling); err != nil {
+			log.Printf("Failed to save sampling stats: %v", err)
+		}
+	}
+
+	// 保存抓包统计
+	if len(bandwidthData.CaptureStats) > 0 {
+		if err := database.SaveCaptureStats(*clientID, bandwidthData.Timestamp, bandwidthData.CaptureStats); err != nil {
+			log.Printf("Failed to save capture stats: %v", err)
+		}
+	}
+
+	// 保存VLAN和隧道流量统计
+	if len(bandwidthData.Encapsulation) > 0 {
+		if err := database.SaveEncapsulation(*clientID, bandwidthData.Timestamp, bandwidthData.Encapsulation); err != nil {
+			log.Printf("Failed to save encapsulation data: %v", err)
+		}
+	}
+
+	// 保存网卡错误计数和链路状态变化，并按阈值检查告警
+	if len(bandwidthData.InterfaceHealth) > 0 {
+		if err := database.SaveInterfaceHealth(*clientID, bandwidthData.Timestamp, bandwidthData.InterfaceHealth); err != nil {
+			log.Printf("Failed to save interface health data: %v", err)
+		}
+		for _, stat := range bandwidthData.InterfaceHealth {
+			for _, change := range stat.LinkChanges {
+				log.Printf("客户端 %s 网卡 %s 链路状态变化: %s %dMbps %s", *clientID, stat.Interface, change.OperState, change.Speed, change.Duplex)
+			}
+		}
+		if alerts := s.alerts.checkInterfaceHealth(*clientID, bandwidthData.InterfaceHealth); len(alerts) > 0 {
+			for _, alert := range alerts {
+				if alert.Resolved {
+					log.Printf("客户端 %s 告警解除: %s", *clientID, alert.Message)
+				} else {
+					log.Printf("客户端 %s 告警: %s", *clientID, alert.Message)
+				}
+			}
+			if err := database.SaveAlerts(*clientID, bandwidthData.Timestamp, alerts); err != nil {
+				log.Printf("Failed to save alerts: %v", err)
+			}
+		}
+	}
+
+	// 保存进程流量
+	if len(bandwidthData.Processes) > 0 {
+		if err := database.SaveProcessTraffic(*clientID, bandwidthData.Timestamp, bandwidthData.Processes); err != nil {
+			log.Printf("Failed to save process traffic: %v", err)
+		}
+	}
+
+	// 保存容器流量
+	if len(bandwidthData.Containers) > 0 {
+		if err := database.SaveContainerTraffic(*clientID, bandwidthData.Timestamp, bandwidthData.Containers); err != nil {
+			log.Printf("Failed to save container traffic: %v", err)
+		}
+	}
+
+	// 保存远端网段流量
+	if bandwidthData.Remotes != nil {
+		if err := database.SaveRemoteTraffic(*clientID, bandwidthData.Timestamp, bandwidthData.Remotes); err != nil {
+			log.Printf("Failed to save remote traffic: %v", err)
+		}
+	}
+
+	// 保存服务器名称流量
+	if len(bandwidthData.Hostnames) > 0 {
+		if err := database.SaveHostnameTraffic(*clientID, bandwidthData.Timestamp, bandwidthData.Hostnames); err != nil {
+			log.Printf("Failed to save hostname traffic: %v", err)
+		}
+	}
+
+	// 保存TCP健康指标
+	if bandwidthData.TCPHealth != nil {
+		if err := database.SaveTCPHealth(*clientID, bandwidthData.Timestamp, bandwidthData.TCPHealth); err != nil {
+			log.Printf("Failed to save TCP health data: %v", err)
+		}
+	}
+
+	// 保存握手RTT统计
+	if bandwidthData.TCPRTT != nil && bandwidthData.TCPRTT.Total.Count > 0 {
+		if err := database.SaveTCPRTT(*clientID, bandwidthData.Timestamp, bandwidthData.TCPRTT); err != nil {
+			log.Printf("Failed to save TCP RTT data: %v", err)
+		}
+	}
+
+	// 保存主动探测结果
+	if len(bandwidthData.Probes) > 0 {
+		if err := database.SaveProbeResults(*clientID, bandwidthData.Probes); err != nil {
+			log.Printf("Failed to save probe results: %v", err)
+		}
+	}
+
+	// 保存DNS统计和DNS探测结果
+	if bandwidthData.DNS != nil {
+		if err := database.SaveDNSStats(*clientID, bandwidthData.Timestamp, bandwidthData.DNS); err != nil {
+			log.Printf("Failed to save DNS stats: %v", err)
+		}
+	}
+	if len(bandwidthData.DNSProbes) > 0 {
+		if err := database.SaveDNSProbeResults(*clientID, bandwidthData.DNSProbes); err != nil {
+			log.Printf("Failed to save DNS probe results: %v", err)
+		}
+	}
+
+	// 保存HTTP拨测结果
+	if len(bandwidthData.HTTPChecks) > 0 {
+		if err := database.SaveHTTPCheckResults(*clientID, bandwidthData.HTTPChecks); err != nil {
+			log.Printf("Failed to save HTTP check results: %v", err)
+		}
+	}
+
+	// 保存抓包中断事件
+	if len(bandwidthData.CaptureGaps) > 0 {
+		for _, gap := range bandwidthData.CaptureGaps {
+			if gap.End == nil {
+				log.Printf("客户端 %s 网卡 %s 抓包中断: %s", *clientID, gap.Interface, gap.Reason)
+			} else {
+				log.Printf("客户端 %s 网卡 %s 抓包恢复，中断 %.1f 秒", *clientID, gap.Interface, gap.Duration)
+			}
+		}
+		if err := database.SaveCaptureGaps(*clientID, bandwidthData.CaptureGaps); err != nil {
+			log.Printf("Failed to save capture gaps: %v", err)
+		}
+	}
+
 	log.Printf("数据接受成功 - 上行: %.2f Mbps, 下行: %.2f Mbps, 平均上行包大小: %.2f 字节, 平均下行包大小: %.2f 字节, %s (%s)", bandwidthData.UploadSpeed*8/1048576, bandwidthData.DownloadSpeed*8/1048576, bandwidthData.AvgUploadPacketSize, bandwidthData.AvgDownloadPacketSize, *clientID, *alias)
 }
 